@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -113,6 +116,8 @@ type Shard struct {
 	Store string `json:"store"`
 	IP    string `json:"ip"`
 	Node  string `json:"node"`
+
+	UnassignedReason string `json:"unassigned.reason"`
 }
 
 // Holds information about overlapping shards for a given set of cluster nodes
@@ -149,6 +154,7 @@ type ShardRecovery struct {
 	TranslogOps          int    `json:"translog_ops,string"`
 	TranslogOpsRecovered int    `json:"translog_ops_recovered,string"`
 	TranslogOpsPercent   string `json:"translog_ops_percent"`
+	StartTimeMillis      int64  `json:"start_time_millis,string"`
 }
 
 // Holds information about an Elasticsearch alias, based on the _cat/aliases
@@ -161,31 +167,61 @@ type Alias struct {
 	RoutingSearch string `json:"routing.search"`
 }
 
-// Represent the two possible aliases actions: add or remove
+// Represent the possible aliases actions: add or remove an alias, or remove an index
 type AliasActionType string
 
 const (
 	AddAlias    AliasActionType = "add"
 	RemoveAlias AliasActionType = "remove"
+	RemoveIndex AliasActionType = "remove_index"
 )
 
 // Holds information needed to perform an alias modification, based on the aliases
-// API: https://www.elastic.co/guide/en/elasticsearch/reference/5.6/indices-aliases.html
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-aliases.html
 type AliasAction struct {
 	ActionType AliasActionType
 	IndexName  string `json:"index"`
 	AliasName  string `json:"alias"`
+
+	// Query limiting the documents the alias can access, i.e. {"term": {"user": "octocat"}}.
+	Filter map[string]interface{}
+
+	// Routing value for both indexing and search operations, or each of them.
+	Routing       string
+	IndexRouting  string
+	SearchRouting string
+
+	// Whether the index is the write index of the alias, and whether the alias is hidden.
+	IsWriteIndex *bool
+	IsHidden     *bool
+
+	// Fail to remove the alias if it does not exist. Requires Elasticsearch 7.9 or later.
+	MustExist *bool
 }
 
 func (ac *AliasAction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(
 		&map[AliasActionType]struct {
-			IndexName string `json:"index"`
-			AliasName string `json:"alias"`
+			IndexName     string                 `json:"index"`
+			AliasName     string                 `json:"alias,omitempty"`
+			Filter        map[string]interface{} `json:"filter,omitempty"`
+			Routing       string                 `json:"routing,omitempty"`
+			IndexRouting  string                 `json:"index_routing,omitempty"`
+			SearchRouting string                 `json:"search_routing,omitempty"`
+			IsWriteIndex  *bool                  `json:"is_write_index,omitempty"`
+			IsHidden      *bool                  `json:"is_hidden,omitempty"`
+			MustExist     *bool                  `json:"must_exist,omitempty"`
 		}{
 			ac.ActionType: {
-				IndexName: ac.IndexName,
-				AliasName: ac.AliasName,
+				IndexName:     ac.IndexName,
+				AliasName:     ac.AliasName,
+				Filter:        ac.Filter,
+				Routing:       ac.Routing,
+				IndexRouting:  ac.IndexRouting,
+				SearchRouting: ac.SearchRouting,
+				IsWriteIndex:  ac.IsWriteIndex,
+				IsHidden:      ac.IsHidden,
+				MustExist:     ac.MustExist,
 			},
 		},
 	)
@@ -266,6 +302,7 @@ type Snapshot struct {
 		NodeID  string `json:"node_id"`
 		Status  string `json:"status"`
 	} `json:"failures"`
+	Metadata map[string]interface{} `json:"metadata"`
 }
 
 // Holds information about an Elasticsearch snapshot repository.
@@ -909,6 +946,139 @@ func (c *Client) GetClusterSettings() (ClusterSettings, error) {
 	return clusterSettings, nil
 }
 
+// DiskWatermarks holds the effective disk watermark settings of the cluster,
+// as percentages ("85%"), ratios ("0.85") or free space ("500mb").
+type DiskWatermarks struct {
+	Low        string
+	High       string
+	FloodStage string
+}
+
+// Get the effective disk watermarks, taking transient settings over persistent
+// settings over the defaults.
+//
+// Use case: You want to know how much disk the nodes can use before Elasticsearch stops allocating shards to them.
+func (c *Client) GetDiskWatermarks() (DiskWatermarks, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("%s?include_defaults=true&flat_settings=true", clusterSettingsPath)))
+	if err != nil {
+		return DiskWatermarks{}, err
+	}
+
+	return diskWatermarksFromSettings(body), nil
+}
+
+// Names of the allocation settings of `AllocationSettings`.
+const (
+	SettingWatermarkLow               = "cluster.routing.allocation.disk.watermark.low"
+	SettingWatermarkHigh              = "cluster.routing.allocation.disk.watermark.high"
+	SettingWatermarkFloodStage        = "cluster.routing.allocation.disk.watermark.flood_stage"
+	SettingNodeConcurrentRecoveries   = "cluster.routing.allocation.node_concurrent_recoveries"
+	SettingClusterConcurrentRebalance = "cluster.routing.allocation.cluster_concurrent_rebalance"
+	SettingRecoveryMaxBytesPerSec     = "indices.recovery.max_bytes_per_sec"
+)
+
+// AllocationSettings holds the effective values of the settings controlling
+// where shards go and how fast they recover.
+type AllocationSettings struct {
+	DiskWatermarks             DiskWatermarks
+	NodeConcurrentRecoveries   int
+	ClusterConcurrentRebalance int
+	RecoveryMaxBytesPerSec     string
+
+	// Where each setting comes from, by setting name: "transient", "persistent" or "defaults".
+	Sources map[string]string
+}
+
+// AllocationSettingsUpdate holds the allocation settings to change, nil fields are left alone.
+type AllocationSettingsUpdate struct {
+	WatermarkLow               *string
+	WatermarkHigh              *string
+	WatermarkFloodStage        *string
+	NodeConcurrentRecoveries   *int
+	ClusterConcurrentRebalance *int
+	RecoveryMaxBytesPerSec     *string
+
+	// Names of the settings to reset, i.e. SettingWatermarkLow. They are
+	// removed from the transient or persistent settings, falling back to the
+	// other scope or the defaults.
+	Reset []string
+
+	// Store the settings as persistent rather than transient settings.
+	Persistent bool
+}
+
+// Get the effective allocation settings and where each comes from, taking
+// transient settings over persistent settings over the defaults.
+//
+// Use case: You want to know the disk watermarks and recovery throttling the cluster is actually using.
+func (c *Client) GetAllocationSettings() (AllocationSettings, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("%s?include_defaults=true&flat_settings=true", clusterSettingsPath)))
+	if err != nil {
+		return AllocationSettings{}, err
+	}
+
+	return allocationSettingsFromJSON(body)
+}
+
+// Update allocation settings and return the resulting effective settings.
+//
+// Use case: You want to speed up recoveries during a maintenance window by raising `indices.recovery.max_bytes_per_sec` and the concurrent recoveries.
+func (c *Client) SetAllocationSettings(update AllocationSettingsUpdate) (AllocationSettings, error) {
+	settings := map[string]interface{}{}
+	for name, value := range map[string]*string{
+		SettingWatermarkLow:           update.WatermarkLow,
+		SettingWatermarkHigh:          update.WatermarkHigh,
+		SettingWatermarkFloodStage:    update.WatermarkFloodStage,
+		SettingRecoveryMaxBytesPerSec: update.RecoveryMaxBytesPerSec,
+	} {
+		if value != nil {
+			settings[name] = *value
+		}
+	}
+	for name, value := range map[string]*int{
+		SettingNodeConcurrentRecoveries:   update.NodeConcurrentRecoveries,
+		SettingClusterConcurrentRebalance: update.ClusterConcurrentRebalance,
+	} {
+		if value != nil {
+			settings[name] = *value
+		}
+	}
+
+	for _, name := range update.Reset {
+		switch name {
+		case SettingWatermarkLow, SettingWatermarkHigh, SettingWatermarkFloodStage, SettingNodeConcurrentRecoveries, SettingClusterConcurrentRebalance, SettingRecoveryMaxBytesPerSec:
+		default:
+			return AllocationSettings{}, fmt.Errorf(`Unknown allocation setting "%s"`, name)
+		}
+
+		if _, ok := settings[name]; ok {
+			return AllocationSettings{}, fmt.Errorf(`Allocation setting "%s" can't be both set and reset`, name)
+		}
+
+		settings[name] = nil
+	}
+
+	if len(settings) == 0 {
+		return AllocationSettings{}, errors.New("No allocation setting to update")
+	}
+
+	scope := "transient"
+	if update.Persistent {
+		scope = "persistent"
+	}
+
+	agent := c.buildPutRequest(clusterSettingsPath).
+		Set("Content-Type", "application/json").
+		Send(map[string]interface{}{scope: settings})
+
+	_, err := handleErrWithBytes(agent)
+	if err != nil {
+		return AllocationSettings{}, err
+	}
+
+	return c.GetAllocationSettings()
+}
+
 // Enables or disables allocation for the cluster.
 //
 // Use case: You are performing an operation the cluster where nodes may be dropping in and out. Elasticsearch will typically try to rebalance immediately but you want the cluster to hold off rebalancing until you complete your task. Calling `SetAllocation("disable")` will disable allocation so Elasticsearch won't move/relocate any shards. Once you complete your task, calling `SetAllocation("enable")` will allow Elasticsearch to relocate shards again.
@@ -1209,6 +1379,49 @@ func (c *Client) SnapshotAllIndicesWithBodyParams(repository string, snapshot st
 //
 // Use case: You want to restore a particular index or indices onto your cluster with a new name.
 func (c *Client) RestoreSnapshotIndices(repository string, snapshot string, indices []string, restoredIndexPrefix string, indexSettings map[string]interface{}) error {
+	return c.RestoreSnapshot(repository, snapshot, RestoreOptions{
+		Indices:           indices,
+		RenamePattern:     "(.+)",
+		RenameReplacement: fmt.Sprintf("%s$1", restoredIndexPrefix),
+		IndexSettings:     indexSettings,
+	})
+}
+
+// Holds the options of a snapshot restore, based on the restore
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/restore-snapshot-api.html
+type RestoreOptions struct {
+	// Indices, index patterns and data streams to restore. Restores all
+	// regular indices and data streams of the snapshot if empty.
+	Indices []string
+
+	// Regular expression matched against the names of restored indices and
+	// data streams, and the replacement of the match, i.e. "(.+)" and
+	// "restored_$1". Capture groups can be referenced with $1, $2 and so on.
+	RenamePattern     string
+	RenameReplacement string
+
+	// Index settings to override or to reset to their defaults on restored indices.
+	IndexSettings       map[string]interface{}
+	IgnoreIndexSettings []string
+
+	// Restore the cluster state, i.e. persistent settings, templates and ILM policies.
+	IncludeGlobalState bool
+
+	// Restore the aliases of restored indices. Elasticsearch restores them
+	// unless this is set to false.
+	IncludeAliases *bool
+
+	// Restore indices with missing primary shards instead of failing.
+	Partial bool
+
+	// Feature states to restore, i.e. "security". Requires Elasticsearch 7.12 or later.
+	FeatureStates []string
+}
+
+// Restore indices and data streams from a snapshot with the given options.
+//
+// Use case: You want to restore data streams from a snapshot without their aliases and with replicas disabled.
+func (c *Client) RestoreSnapshot(repository string, snapshot string, opts RestoreOptions) error {
 	if repository == "" {
 		return errors.New("Empty string for repository is not allowed")
 	}
@@ -1218,15 +1431,25 @@ func (c *Client) RestoreSnapshotIndices(repository string, snapshot string, indi
 	}
 
 	request := struct {
-		Indices           string                 `json:"indices"`
-		RenamePattern     string                 `json:"rename_pattern"`
-		RenameReplacement string                 `json:"rename_replacement"`
-		IndexSettings     map[string]interface{} `json:"index_settings,omitempty"`
+		Indices             string                 `json:"indices,omitempty"`
+		RenamePattern       string                 `json:"rename_pattern,omitempty"`
+		RenameReplacement   string                 `json:"rename_replacement,omitempty"`
+		IndexSettings       map[string]interface{} `json:"index_settings,omitempty"`
+		IgnoreIndexSettings []string               `json:"ignore_index_settings,omitempty"`
+		IncludeGlobalState  bool                   `json:"include_global_state,omitempty"`
+		IncludeAliases      *bool                  `json:"include_aliases,omitempty"`
+		Partial             bool                   `json:"partial,omitempty"`
+		FeatureStates       []string               `json:"feature_states,omitempty"`
 	}{
-		Indices:           strings.Join(indices, ","),
-		RenamePattern:     "(.+)",
-		RenameReplacement: fmt.Sprintf("%s$1", restoredIndexPrefix),
-		IndexSettings:     indexSettings,
+		Indices:             strings.Join(opts.Indices, ","),
+		RenamePattern:       opts.RenamePattern,
+		RenameReplacement:   opts.RenameReplacement,
+		IndexSettings:       opts.IndexSettings,
+		IgnoreIndexSettings: opts.IgnoreIndexSettings,
+		IncludeGlobalState:  opts.IncludeGlobalState,
+		IncludeAliases:      opts.IncludeAliases,
+		Partial:             opts.Partial,
+		FeatureStates:       opts.FeatureStates,
 	}
 
 	agent := c.buildPostRequest(fmt.Sprintf("_snapshot/%s/%s/_restore", repository, snapshot)).
@@ -1238,6 +1461,35 @@ func (c *Client) RestoreSnapshotIndices(repository string, snapshot string, indi
 	return err
 }
 
+// Restore an index from a snapshot over the existing index of the same name.
+// The existing index is closed first if it is open, and must have the same
+// number of primary shards as the index in the snapshot.
+//
+// Use case: An index got corrupted or bad data was written to it and you want to roll it back to a snapshot.
+func (c *Client) RestoreSnapshotInPlace(repository string, snapshot string, index string, opts RestoreOptions) error {
+	indices, err := c.GetIndices(index)
+	if err != nil {
+		return err
+	}
+
+	if len(indices) != 1 || indices[0].Name != index {
+		return fmt.Errorf(`Expected a single existing index named "%s" to restore over, found %d`, index, len(indices))
+	}
+
+	if indices[0].Status != "close" {
+		err = c.CloseIndex(index)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.Indices = []string{index}
+	opts.RenamePattern = ""
+	opts.RenameReplacement = ""
+
+	return c.RestoreSnapshot(repository, snapshot, opts)
+}
+
 // Call the analyze API with sample text and an analyzer. https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-analyze.html
 //
 // Use case: You want to see how Elasticsearch will break up sample text given a specific analyzer.
@@ -1398,7 +1650,7 @@ func (c *Client) GetPrettyIndexSegments(index string) (string, error) {
 // Use case: You can view shard information on all nodes or a subset.
 func (c *Client) GetShards(nodes []string) ([]Shard, error) {
 	var allShards []Shard
-	req := c.buildGetRequest("_cat/shards")
+	req := c.buildGetRequest("_cat/shards?h=index,shard,prirep,state,docs,store,ip,node,unassigned.reason")
 	err := handleErrWithStruct(req, &allShards)
 
 	if err != nil {
@@ -1497,10 +1749,11 @@ func (c *Client) GetShardOverlap(nodes []string) (map[string]ShardOverlap, error
 // Use case: You can view the shard recovery progress of the cluster.
 func (c *Client) GetShardRecovery(nodes []string, onlyActive bool) ([]ShardRecovery, error) {
 	var allRecoveries []ShardRecovery
-	uri := "_cat/recovery"
+	// The start time is not a default column, ask for it along with the default ones.
+	uri := "_cat/recovery?h=index,shard,time,type,stage,source_host,source_node,target_host,target_node,repository,snapshot,files,files_recovered,files_percent,files_total,bytes,bytes_recovered,bytes_percent,bytes_total,translog_ops,translog_ops_recovered,translog_ops_percent,start_time_millis"
 
 	if onlyActive {
-		uri = fmt.Sprintf("%s?active_only=true", uri)
+		uri = fmt.Sprintf("%s&active_only=true", uri)
 	}
 
 	req := c.buildGetRequest(uri)
@@ -1743,13 +1996,353 @@ func (c *Client) ClusterAllocationExplainWithQueryParams(req *ClusterAllocationE
 	return string(body), nil
 }
 
+// AllocationDecider holds the outcome of one allocation decider.
+type AllocationDecider struct {
+	Decider     string `json:"decider"`
+	Decision    string `json:"decision"`
+	Explanation string `json:"explanation"`
+}
+
+// UnassignedInfo holds why and since when a shard is unassigned.
+type UnassignedInfo struct {
+	Reason                   string `json:"reason"`
+	At                       string `json:"at"`
+	Details                  string `json:"details"`
+	LastAllocationStatus     string `json:"last_allocation_status"`
+	FailedAllocationAttempts int    `json:"failed_allocation_attempts"`
+}
+
+// AllocationNode identifies the node currently holding a shard.
+type AllocationNode struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	TransportAddress string            `json:"transport_address"`
+	Attributes       map[string]string `json:"attributes"`
+	WeightRanking    int               `json:"weight_ranking"`
+}
+
+// ShardStoreInfo describes the copy of a shard found on a node, if any.
+type ShardStoreInfo struct {
+	Found               bool   `json:"found"`
+	InSync              bool   `json:"in_sync"`
+	AllocationID        string `json:"allocation_id"`
+	MatchingSizeInBytes int64  `json:"matching_size_in_bytes"`
+	StoreException      string `json:"store_exception"`
+}
+
+// NodeAllocationDecision holds whether a shard could go to a given node and the deciders behind it.
+type NodeAllocationDecision struct {
+	NodeID           string              `json:"node_id"`
+	NodeName         string              `json:"node_name"`
+	TransportAddress string              `json:"transport_address"`
+	NodeAttributes   map[string]string   `json:"node_attributes"`
+	NodeDecision     string              `json:"node_decision"`
+	WeightRanking    int                 `json:"weight_ranking"`
+	Store            *ShardStoreInfo     `json:"store"`
+	Deciders         []AllocationDecider `json:"deciders"`
+}
+
+// AllocationExplanation is the typed response of `_cluster/allocation/explain`.
+// Decisions are the strings returned by Elasticsearch, i.e. "yes", "no", "throttled" or "awaiting_info".
+type AllocationExplanation struct {
+	Index        string          `json:"index"`
+	Shard        int             `json:"shard"`
+	Primary      bool            `json:"primary"`
+	CurrentState string          `json:"current_state"`
+	CurrentNode  *AllocationNode `json:"current_node"`
+
+	UnassignedInfo *UnassignedInfo `json:"unassigned_info"`
+
+	CanAllocate         string `json:"can_allocate"`
+	AllocateExplanation string `json:"allocate_explanation"`
+
+	CanRemainOnCurrentNode string              `json:"can_remain_on_current_node"`
+	CanRemainDecisions     []AllocationDecider `json:"can_remain_decisions"`
+
+	CanRebalanceCluster          string              `json:"can_rebalance_cluster"`
+	CanRebalanceClusterDecisions []AllocationDecider `json:"can_rebalance_cluster_decisions"`
+	CanRebalanceToOtherNode      string              `json:"can_rebalance_to_other_node"`
+	RebalanceExplanation         string              `json:"rebalance_explanation"`
+
+	CanMoveToOtherNode string `json:"can_move_to_other_node"`
+	MoveExplanation    string `json:"move_explanation"`
+
+	NodeAllocationDecisions []NodeAllocationDecision `json:"node_allocation_decisions"`
+}
+
+// Get a typed explanation for a shard's current allocation. A nil request
+// explains the first unassigned shard Elasticsearch finds.
+//
+// Use case: You want to act programmatically on why a shard is unassigned or cannot move.
+func (c *Client) GetAllocationExplanation(req *ClusterAllocationExplainRequest) (AllocationExplanation, error) {
+	var explanation AllocationExplanation
+
+	agent := c.buildGetRequest("_cluster/allocation/explain")
+	if req != nil {
+		agent.Set("Content-Type", "application/json").Send(req)
+	}
+
+	err := handleErrWithStruct(agent, &explanation)
+	if err != nil {
+		return AllocationExplanation{}, err
+	}
+
+	return explanation, nil
+}
+
+// ShardRemediation names the library call likely to fix an unassigned shard.
+type ShardRemediation string
+
+const (
+	// No remediation is known, the deciders have to be addressed by hand.
+	RemediationNone ShardRemediation = ""
+	// Allocation is throttled or delayed, wait for Elasticsearch to assign the shard.
+	RemediationWait ShardRemediation = "wait"
+	// Allocation gave up after too many failures, use `RerouteWithRetryFailed`.
+	RemediationRetryFailed ShardRemediation = "retry_failed"
+	// Only stale copies of the primary are left, use `AllocateStalePrimaryShard` on RemediationNode.
+	RemediationAllocateStalePrimary ShardRemediation = "allocate_stale_primary"
+)
+
+// UnassignedShard holds an unassigned shard with its allocation explanation.
+type UnassignedShard struct {
+	Shard       Shard
+	Explanation AllocationExplanation
+
+	Remediation ShardRemediation
+	// The node holding the copy to allocate, for RemediationAllocateStalePrimary.
+	RemediationNode string
+}
+
+// UnassignedShardGroup holds unassigned shards sharing the same allocation outcome.
+type UnassignedShardGroup struct {
+	CanAllocate string
+	// Sorted names of the deciders that said NO or THROTTLE on at least one node.
+	Deciders []string
+	Shards   []UnassignedShard
+}
+
+// Explain every unassigned shard of the cluster and group them by allocation
+// decision and blocking deciders, largest group first. Each shard carries the
+// suggested remediation.
+//
+// Use case: During a red cluster incident you want to know at once why all the unassigned shards are stuck.
+func (c *Client) ExplainUnassignedShards() ([]UnassignedShardGroup, error) {
+	shards, err := c.GetShards(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	unassigned := []UnassignedShard{}
+	for _, shard := range shards {
+		if shard.State != "UNASSIGNED" {
+			continue
+		}
+
+		shardID, err := strconv.Atoi(shard.Shard)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected shard number %s for index %s", shard.Shard, shard.Index)
+		}
+
+		explanation, err := c.GetAllocationExplanation(&ClusterAllocationExplainRequest{
+			Index:   shard.Index,
+			Shard:   &shardID,
+			Primary: shard.Type == "p",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error explaining shard %s of %s: %s", shard.Shard, shard.Index, err)
+		}
+
+		remediation, node := suggestRemediation(explanation)
+		unassigned = append(unassigned, UnassignedShard{
+			Shard:           shard,
+			Explanation:     explanation,
+			Remediation:     remediation,
+			RemediationNode: node,
+		})
+	}
+
+	return groupUnassignedShards(unassigned), nil
+}
+
+// BalanceReportOptions holds the thresholds of a balance report.
+type BalanceReportOptions struct {
+	// Flag nodes whose disk usage is within this many percentage points of a watermark.
+	WatermarkMargin float64
+}
+
+// NodeBalance holds the shards and disk usage of a data node.
+type NodeBalance struct {
+	Name      string
+	Shards    int
+	Primaries int
+	// Bytes of the shard copies on the node, from the index stats.
+	ShardBytes int64
+	// Relative difference between the shards of the node and the mean, i.e. 0.25 for 25% more shards.
+	ShardDeviation float64
+
+	DiskPercent float64
+	// Difference in percentage points between the disk usage of the node and the mean.
+	DiskDeviation float64
+
+	// The highest watermark, "low", "high" or "flood_stage", the disk usage is close to or over.
+	Watermark         string
+	WatermarkExceeded bool
+}
+
+// IndexConcentration flags an index with several primaries, or more than its fair share of copies, on one node.
+type IndexConcentration struct {
+	Index     string
+	Node      string
+	Primaries int
+	Copies    int
+	// Copies each data node would hold if the index was spread evenly, rounded up.
+	FairShare int
+}
+
+// BalanceReport holds how evenly shards and disk usage are spread across data nodes.
+type BalanceReport struct {
+	Nodes      []NodeBalance
+	Watermarks DiskWatermarks
+
+	MeanShards float64
+	// Difference between the most and least loaded nodes relative to the mean.
+	ShardSkew float64
+
+	MeanDiskPercent float64
+	// Difference in percentage points between the fullest and emptiest nodes.
+	DiskSkew float64
+
+	Concentrations []IndexConcentration
+}
+
+// Analyze how shards and disk usage are spread across the data nodes: shard
+// count skew, indices concentrated on a node and nodes close to the disk
+// watermarks.
+//
+// Use case: You want to find hot spots the built-in balancer left behind.
+func (c *Client) GetBalanceReport(opts BalanceReportOptions) (BalanceReport, error) {
+	nodes, err := c.GetNodeAllocations()
+	if err != nil {
+		return BalanceReport{}, err
+	}
+
+	shards, err := c.GetShards(nil)
+	if err != nil {
+		return BalanceReport{}, err
+	}
+
+	stats, err := c.GetIndexStats("")
+	if err != nil {
+		return BalanceReport{}, err
+	}
+
+	watermarks, err := c.GetDiskWatermarks()
+	if err != nil {
+		return BalanceReport{}, err
+	}
+
+	return buildBalanceReport(nodes, shards, stats, watermarks, opts), nil
+}
+
 type RerouteRequest struct {
 	// The commands to perform (move, cancel, allocate, etc)
 	Commands []RerouteCommand `json:"commands,omitempty"`
 }
 
+// RerouteCommand holds a single reroute command, only one of its fields should be set.
 type RerouteCommand struct {
-	AllocateStalePrimary AllocateStalePrimary `json:"allocate_stale_primary,omitempty"`
+	Move                 *MoveShard            `json:"move,omitempty"`
+	Cancel               *CancelShard          `json:"cancel,omitempty"`
+	AllocateReplica      *AllocateReplica      `json:"allocate_replica,omitempty"`
+	AllocateStalePrimary AllocateStalePrimary  `json:"allocate_stale_primary,omitempty"`
+	AllocateEmptyPrimary *AllocateEmptyPrimary `json:"allocate_empty_primary,omitempty"`
+}
+
+// Leaves out AllocateStalePrimary when it is not set, which omitempty doesn't do for structs.
+func (c RerouteCommand) MarshalJSON() ([]byte, error) {
+	var stalePrimary *AllocateStalePrimary
+	if c.hasAllocateStalePrimary() {
+		stalePrimary = &c.AllocateStalePrimary
+	}
+
+	return json.Marshal(struct {
+		Move                 *MoveShard            `json:"move,omitempty"`
+		Cancel               *CancelShard          `json:"cancel,omitempty"`
+		AllocateReplica      *AllocateReplica      `json:"allocate_replica,omitempty"`
+		AllocateStalePrimary *AllocateStalePrimary `json:"allocate_stale_primary,omitempty"`
+		AllocateEmptyPrimary *AllocateEmptyPrimary `json:"allocate_empty_primary,omitempty"`
+	}{
+		Move:                 c.Move,
+		Cancel:               c.Cancel,
+		AllocateReplica:      c.AllocateReplica,
+		AllocateStalePrimary: stalePrimary,
+		AllocateEmptyPrimary: c.AllocateEmptyPrimary,
+	})
+}
+
+func (c RerouteCommand) hasAllocateStalePrimary() bool {
+	return c.AllocateStalePrimary != AllocateStalePrimary{}
+}
+
+// Returns the name of the command as used by Elasticsearch, i.e. "move".
+func (c RerouteCommand) Name() string {
+	switch {
+	case c.Move != nil:
+		return "move"
+	case c.Cancel != nil:
+		return "cancel"
+	case c.AllocateReplica != nil:
+		return "allocate_replica"
+	case c.hasAllocateStalePrimary():
+		return "allocate_stale_primary"
+	case c.AllocateEmptyPrimary != nil:
+		return "allocate_empty_primary"
+	default:
+		return ""
+	}
+}
+
+// Returns whether the command may lose data, as allocating a stale or empty primary
+// or cancelling a primary does.
+func (c RerouteCommand) DataLoss() bool {
+	return c.hasAllocateStalePrimary() || c.AllocateEmptyPrimary != nil || (c.Cancel != nil && c.Cancel.AllowPrimary)
+}
+
+// MoveShard moves a started shard from one node to another.
+type MoveShard struct {
+	Index    string `json:"index"`
+	Shard    int    `json:"shard"`
+	FromNode string `json:"from_node"`
+	ToNode   string `json:"to_node"`
+}
+
+// CancelShard cancels the allocation or recovery of a shard on a node.
+type CancelShard struct {
+	Index string `json:"index"`
+	Shard int    `json:"shard"`
+	Node  string `json:"node"`
+
+	// Needed to cancel the allocation of a primary, which loses its data if no replica is in sync.
+	AllowPrimary bool `json:"allow_primary,omitempty"`
+}
+
+// AllocateReplica allocates an unassigned replica shard to a node.
+type AllocateReplica struct {
+	Index string `json:"index"`
+	Shard int    `json:"shard"`
+	Node  string `json:"node"`
+}
+
+// AllocateEmptyPrimary allocates an empty primary shard to a node, losing
+// all the data of the shard.
+type AllocateEmptyPrimary struct {
+	Index string `json:"index"`
+	Shard int    `json:"shard"`
+	Node  string `json:"node"`
+
+	// Must be true, any data of the shard found later on will be deleted.
+	AcceptDataLoss bool `json:"accept_data_loss"`
 }
 
 type AllocateStalePrimary struct {
@@ -1810,47 +2403,3171 @@ func (c *Client) AllocateStalePrimaryShard(node, index string, shard int) error
 	return nil
 }
 
-// RemoveIndexILMPolicy removes the ILM policy from the index
-func (c *Client) RemoveIndexILMPolicy(index string) error {
-	agent := c.buildPostRequest(fmt.Sprintf("%s/_ilm/remove", index))
+// RerouteOptions holds the query parameters of a reroute request.
+type RerouteOptions struct {
+	// Only simulate the commands, the cluster state is not changed.
+	DryRun bool
 
-	_, err := handleErrWithBytes(agent)
-	if err != nil {
-		return err
+	// Return the decisions of the deciders for each command.
+	Explain bool
+
+	// Also retry the allocation of shards that failed too many times.
+	RetryFailed bool
+}
+
+// RerouteExplanation holds the decisions for one reroute command.
+type RerouteExplanation struct {
+	Command    string                 `json:"command"`
+	Parameters map[string]interface{} `json:"parameters"`
+	Decisions  []AllocationDecider    `json:"decisions"`
+}
+
+// RerouteResult holds the response of a reroute request. Explanations are only set when requested.
+type RerouteResult struct {
+	Acknowledged bool                 `json:"acknowledged"`
+	Explanations []RerouteExplanation `json:"explanations"`
+}
+
+// Run reroute commands in one request. Use opts.DryRun and opts.Explain to
+// preview what the deciders think of the commands without changing anything.
+// Elasticsearch rejects the whole batch if any command is not allowed.
+//
+// Use case: You want to move, cancel or force allocate shards by hand.
+func (c *Client) Reroute(commands []RerouteCommand, opts RerouteOptions) (RerouteResult, error) {
+	var result RerouteResult
+
+	queryStrings := []string{"metric=none"}
+	if opts.DryRun {
+		queryStrings = append(queryStrings, "dry_run=true")
+	}
+	if opts.Explain {
+		queryStrings = append(queryStrings, "explain=true")
+	}
+	if opts.RetryFailed {
+		queryStrings = append(queryStrings, "retry_failed=true")
 	}
 
-	ilmHistoryIndices, err := c.GetHiddenIndices(fmt.Sprintf("%s*.ds-ilm-history-*", index))
+	agent := c.buildPostRequest(fmt.Sprintf("_cluster/reroute?%s", strings.Join(queryStrings, "&")))
+	agent.Set("Content-Type", "application/json").Send(RerouteRequest{Commands: commands})
+
+	err := handleErrWithStruct(agent, &result)
 	if err != nil {
-		return err
+		return RerouteResult{}, err
 	}
 
-	for _, ilmHistoryIndex := range ilmHistoryIndices {
-		err = c.DeleteIndex(ilmHistoryIndex.Name)
-		if err != nil {
-			return err
-		}
-	}
+	return result, nil
+}
 
-	return nil
+// NodeInfo holds the identity, roles and attributes of a node, from the nodes info API.
+type NodeInfo struct {
+	ID         string
+	Name       string
+	Host       string
+	IP         string
+	Roles      []string
+	Attributes map[string]string
 }
 
-// LicenseCluster takes in the Elasticsearch license encoded as a string
-func (c *Client) LicenseCluster(license string) error {
-	// If the license is empty, return an error
-	if license == "" {
-		return errors.New("license is required")
+// Get the identity, roles and custom attributes of all the nodes.
+//
+// Use case: You want to know which nodes match allocation filtering or awareness rules.
+func (c *Client) GetNodesInfo() ([]NodeInfo, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest("_nodes?filter_path=nodes.*.name,nodes.*.host,nodes.*.ip,nodes.*.roles,nodes.*.attributes"))
+	if err != nil {
+		return nil, err
 	}
 
-	// Build the request to apply the license to the cluster
-	agent := c.buildPutRequest("_license").
-		Set("Content-Type", "application/json").
-		Send(license)
+	nodes := []NodeInfo{}
+	gjson.GetBytes(body, "nodes").ForEach(func(id, value gjson.Result) bool {
+		node := NodeInfo{
+			ID:         id.String(),
+			Name:       value.Get("name").String(),
+			Host:       value.Get("host").String(),
+			IP:         value.Get("ip").String(),
+			Roles:      []string{},
+			Attributes: map[string]string{},
+		}
+		for _, role := range value.Get("roles").Array() {
+			node.Roles = append(node.Roles, role.String())
+		}
+		value.Get("attributes").ForEach(func(name, attribute gjson.Result) bool {
+			node.Attributes[name.String()] = attribute.String()
+			return true
+		})
 
-	// Execute the request
-	_, err := handleErrWithBytes(agent)
-	if err != nil {
-		return err
-	}
+		nodes = append(nodes, node)
+		return true
+	})
 
-	return nil
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	return nodes, nil
+}
+
+// BalanceMetric is what a rebalancing plan evens out across nodes.
+type BalanceMetric string
+
+const (
+	// Even out the number of shards per node.
+	BalanceShards BalanceMetric = "shards"
+	// Even out the disk usage percentage per node.
+	BalanceDisk BalanceMetric = "disk"
+)
+
+// RebalancePlanOptions holds the parameters of a rebalancing plan.
+type RebalancePlanOptions struct {
+	Metric BalanceMetric
+
+	// Maximum number of moves to plan. No limit if 0.
+	MaxMoves int
+
+	// Stop once the most and least loaded nodes differ by at most this many
+	// shards or disk percentage points.
+	Tolerance float64
+}
+
+// ShardMove moves a shard copy from one node to another.
+type ShardMove struct {
+	Index    string
+	Shard    int
+	Primary  bool
+	Bytes    int64
+	FromNode string
+	ToNode   string
+}
+
+// Returns the reroute command performing the move.
+func (m ShardMove) RerouteCommand() RerouteCommand {
+	return RerouteCommand{Move: &MoveShard{Index: m.Index, Shard: m.Shard, FromNode: m.FromNode, ToNode: m.ToNode}}
+}
+
+// NodeLoad holds the shards and disk usage of a data node.
+type NodeLoad struct {
+	Name           string
+	Shards         int
+	DiskUsedBytes  int64
+	DiskTotalBytes int64
+}
+
+// Returns the disk usage of the node as a percentage.
+func (l NodeLoad) DiskPercent() float64 {
+	if l.DiskTotalBytes <= 0 {
+		return 0
+	}
+
+	return float64(l.DiskUsedBytes) / float64(l.DiskTotalBytes) * 100
+}
+
+// RebalancePlan holds the moves evening out the load of the data nodes, with
+// the load of the nodes before and after them.
+type RebalancePlan struct {
+	Metric BalanceMetric
+	Moves  []ShardMove
+	Before []NodeLoad
+	After  []NodeLoad
+}
+
+// Plan the shard moves evening out the number of shards or the disk usage of
+// the data nodes. Moves only started shards, each at most once, and respects
+// allocation filtering, total shards per node limits, awareness attributes,
+// the low disk watermark and never puts two copies of a shard on one node.
+//
+// Use case: The built-in balancer left hot nodes and you want to move shards by hand.
+func (c *Client) PlanRebalance(opts RebalancePlanOptions) (RebalancePlan, error) {
+	if opts.Metric != BalanceShards && opts.Metric != BalanceDisk {
+		return RebalancePlan{}, fmt.Errorf("Unsupported balance metric %q, use %q or %q", opts.Metric, BalanceShards, BalanceDisk)
+	}
+
+	nodes, err := c.GetNodeAllocations()
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+
+	infos, err := c.GetNodesInfo()
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+
+	shards, err := c.GetShards(nil)
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+
+	clusterSettings, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("%s?include_defaults=true&flat_settings=true", clusterSettingsPath)))
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+
+	indexSettings, err := handleErrWithBytes(c.buildGetRequest("_all/_settings/index.routing.allocation.*?flat_settings=true"))
+	if err != nil {
+		return RebalancePlan{}, err
+	}
+
+	rules := allocationRulesFromSettings(clusterSettings, indexSettings)
+	return planRebalance(nodes, infos, shards, rules, diskWatermarksFromSettings(clusterSettings), opts), nil
+}
+
+// RebalanceApplyOptions holds how a rebalancing plan is applied.
+type RebalanceApplyOptions struct {
+	// Number of moves sent together. Defaults to 1.
+	BatchSize int
+
+	// How often to check on the recoveries of a batch. Defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// How long to wait for the shards of a batch to be started on their new
+	// nodes. Defaults to 1 hour for each batch.
+	Timeout time.Duration
+}
+
+// RebalanceProgress holds the state of the batch being applied.
+type RebalanceProgress struct {
+	Batch   int
+	Batches int
+	Moves   []ShardMove
+	// Active recoveries of the moved shards.
+	Recoveries []ShardRecovery
+}
+
+// Apply the moves of a rebalancing plan in batches, waiting for the
+// recoveries of a batch to complete and every moved shard to be started on its
+// new node before sending the next one. The optional progress function is
+// called after every poll.
+//
+// Use case: You want to move many shards by hand without flooding the cluster with recoveries.
+func (c *Client) ApplyRebalancePlan(plan RebalancePlan, opts RebalanceApplyOptions, progress func(RebalanceProgress)) error {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Hour
+	}
+	batches := (len(plan.Moves) + batchSize - 1) / batchSize
+
+	for batch := 0; batch < batches; batch++ {
+		end := (batch + 1) * batchSize
+		if end > len(plan.Moves) {
+			end = len(plan.Moves)
+		}
+		moves := plan.Moves[batch*batchSize : end]
+
+		commands := make([]RerouteCommand, 0, len(moves))
+		for _, move := range moves {
+			commands = append(commands, move.RerouteCommand())
+		}
+
+		_, err := c.Reroute(commands, RerouteOptions{})
+		if err != nil {
+			return fmt.Errorf("Error moving shards of batch %d/%d: %s", batch+1, batches, err)
+		}
+
+		start := time.Now()
+		for {
+			time.Sleep(opts.PollInterval)
+
+			recoveries, err := c.GetShardRecovery(nil, true)
+			if err != nil {
+				return err
+			}
+
+			active := movesRecoveries(moves, recoveries)
+			if progress != nil {
+				progress(RebalanceProgress{Batch: batch + 1, Batches: batches, Moves: moves, Recoveries: active})
+			}
+
+			if len(active) == 0 {
+				shards, err := c.GetShards(nil)
+				if err != nil {
+					return err
+				}
+
+				pending := pendingMoves(moves, shards)
+				if len(pending) == 0 {
+					break
+				}
+
+				if time.Since(start) > opts.Timeout {
+					return fmt.Errorf("Timed out waiting for the shards of batch %d/%d to move, not started on their new node: %s", batch+1, batches, strings.Join(pending, ", "))
+				}
+
+				continue
+			}
+
+			if time.Since(start) > opts.Timeout {
+				return fmt.Errorf("Timed out waiting for the recoveries of batch %d/%d to complete", batch+1, batches)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RemoveIndexILMPolicy removes the ILM policy from the index
+func (c *Client) RemoveIndexILMPolicy(index string) error {
+	agent := c.buildPostRequest(fmt.Sprintf("%s/_ilm/remove", index))
+
+	_, err := handleErrWithBytes(agent)
+	if err != nil {
+		return err
+	}
+
+	ilmHistoryIndices, err := c.GetHiddenIndices(fmt.Sprintf("%s*.ds-ilm-history-*", index))
+	if err != nil {
+		return err
+	}
+
+	for _, ilmHistoryIndex := range ilmHistoryIndices {
+		err = c.DeleteIndex(ilmHistoryIndex.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LicenseCluster takes in the Elasticsearch license encoded as a string
+func (c *Client) LicenseCluster(license string) error {
+	// If the license is empty, return an error
+	if license == "" {
+		return errors.New("license is required")
+	}
+
+	// Build the request to apply the license to the cluster
+	agent := c.buildPutRequest("_license").
+		Set("Content-Type", "application/json").
+		Send(license)
+
+	// Execute the request
+	_, err := handleErrWithBytes(agent)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Holds the optional settings and aliases applied to the target index of a
+// shrink, split or clone operation, based on the resize index
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-shrink-index.html
+type ResizeIndexRequest struct {
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
+}
+
+type resizeIndexResponse struct {
+	Acknowledged       bool   `json:"acknowledged"`
+	ShardsAcknowledged bool   `json:"shards_acknowledged"`
+	Index              string `json:"index"`
+}
+
+func (c *Client) resizeIndex(action, source, target string, request *ResizeIndexRequest) error {
+	if source == "" {
+		return errors.New("Empty string for source index is not allowed")
+	}
+
+	if target == "" {
+		return errors.New("Empty string for target index is not allowed")
+	}
+
+	agent := c.buildPostRequest(fmt.Sprintf("%s/%s/%s", source, action, target))
+	if request != nil {
+		agent.Set("Content-Type", "application/json").Send(request)
+	}
+
+	var response resizeIndexResponse
+	err := handleErrWithStruct(agent, &response)
+	if err != nil {
+		return err
+	}
+
+	if !response.Acknowledged {
+		return fmt.Errorf(`Request to %s index "%s" into "%s" was not acknowledged. %+v`, strings.TrimPrefix(action, "_"), source, target, response)
+	}
+
+	return nil
+}
+
+// Shrink an index into a new index with fewer primary shards.
+//
+// Use case: You have an old index with more primary shards than it needs. The
+// source index must be read-only and a copy of every shard must reside on the
+// same node. See `PrepareAndShrinkIndex` for a workflow that handles this.
+func (c *Client) ShrinkIndex(source, target string, request *ResizeIndexRequest) error {
+	return c.resizeIndex("_shrink", source, target, request)
+}
+
+// Split an index into a new index with more primary shards.
+//
+// Use case: An index has outgrown its primary shards and you want to spread it
+// over more of them. The source index must be read-only.
+func (c *Client) SplitIndex(source, target string, request *ResizeIndexRequest) error {
+	return c.resizeIndex("_split", source, target, request)
+}
+
+// Clone an index into a new index with the same number of primary shards.
+//
+// Use case: You want a copy of a read-only index, for example to experiment
+// with settings without touching the original.
+func (c *Client) CloneIndex(source, target string, request *ResizeIndexRequest) error {
+	return c.resizeIndex("_clone", source, target, request)
+}
+
+// Holds the options for the `PrepareAndShrinkIndex` workflow.
+type ShrinkOptions struct {
+	// The number of primary shards of the target index. Must be a factor of
+	// the number of primary shards of the source index.
+	Shards int
+
+	// The node to gather a copy of every shard on. If empty, the node already
+	// holding the most shards of the source index is used.
+	Node string
+
+	// Move every alias of the source index to the target index once the target is green.
+	SwapAliases bool
+
+	// Delete the source index once the target is green. Otherwise the source
+	// index is made writable again and is no longer pinned to the node.
+	DeleteSource bool
+
+	// How often to poll the cluster while waiting. Defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// How long to wait for relocation and for the target to become green.
+	// Defaults to 1 hour for each.
+	Timeout time.Duration
+}
+
+// Holds the outcome of the `PrepareAndShrinkIndex` workflow.
+type ShrinkResult struct {
+	Source         string
+	Target         string
+	Node           string
+	MovedAliases   []string
+	DeletedSource  bool
+	RelocationTime time.Duration
+	RecoveryTime   time.Duration
+}
+
+// Shrink an index, performing all the preparation and cleanup steps.
+//
+// The source index is made read-only and a copy of every shard is pinned to a
+// single node. Once relocation is done the index is shrunk, with the write
+// block and the allocation filter removed from the target. When the target is
+// green, aliases are optionally moved to it and the source is either deleted or
+// restored to its previous state.
+//
+// Use case: You want to reduce the number of shards of an old index without
+// babysitting each step.
+func (c *Client) PrepareAndShrinkIndex(source, target string, opts ShrinkOptions) (result ShrinkResult, err error) {
+	result = ShrinkResult{Source: source, Target: target}
+
+	if opts.Shards < 1 {
+		return result, errors.New("Target number of shards must be at least 1")
+	}
+
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Hour
+	}
+
+	node := opts.Node
+	if node == "" {
+		shards, err := c.GetShards(nil)
+		if err != nil {
+			return result, err
+		}
+
+		node = nodeWithMostShards(shards, source)
+		if node == "" {
+			return result, fmt.Errorf(`No started shards found for index "%s"`, source)
+		}
+	}
+	result.Node = node
+
+	previousBlock, _, err := c.SetIndexSetting(source, "blocks.write", "true")
+	if err != nil {
+		return result, err
+	}
+
+	// Settings putting the source index back in its previous state, nil once restored.
+	restore := map[string]interface{}{"blocks.write": settingOrNull(previousBlock)}
+	defer func() {
+		if err == nil || restore == nil {
+			return
+		}
+
+		restoreErr := c.setIndexSettings(source, restore)
+		if restoreErr != nil {
+			err = fmt.Errorf(`%s. Restoring the settings of index "%s" also failed: %s`, err, source, restoreErr)
+		}
+	}()
+
+	previousNode, _, err := c.SetIndexSetting(source, "routing.allocation.require._name", node)
+	if err != nil {
+		return result, err
+	}
+	restore["routing.allocation.require._name"] = settingOrNull(previousNode)
+
+	start := time.Now()
+	for {
+		shards, err := c.GetShards(nil)
+		if err != nil {
+			return result, err
+		}
+
+		if shardsGatheredOnNode(shards, source, node) {
+			break
+		}
+
+		if time.Since(start) > opts.Timeout {
+			return result, fmt.Errorf(`Timed out waiting for a copy of every shard of "%s" to relocate to node "%s"`, source, node)
+		}
+
+		time.Sleep(opts.PollInterval)
+	}
+	result.RelocationTime = time.Since(start)
+
+	request := &ResizeIndexRequest{
+		Settings: map[string]interface{}{
+			"index.number_of_shards":                 opts.Shards,
+			"index.routing.allocation.require._name": nil,
+			"index.blocks.write":                     nil,
+		},
+	}
+
+	err = c.ShrinkIndex(source, target, request)
+	if err != nil {
+		return result, err
+	}
+
+	start = time.Now()
+	for {
+		status, err := c.getIndexHealthStatus(target)
+		if err != nil {
+			return result, err
+		}
+
+		if status == "green" {
+			break
+		}
+
+		if time.Since(start) > opts.Timeout {
+			return result, fmt.Errorf(`Timed out waiting for index "%s" to become green`, target)
+		}
+
+		time.Sleep(opts.PollInterval)
+	}
+	result.RecoveryTime = time.Since(start)
+
+	if opts.SwapAliases {
+		body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("%s/_alias", source)))
+		if err != nil {
+			return result, err
+		}
+
+		actions, aliases := aliasMoveActions(body, source, target)
+		if len(actions) > 0 {
+			err = c.ModifyAliases(actions)
+			if err != nil {
+				return result, err
+			}
+		}
+		result.MovedAliases = aliases
+	}
+
+	if opts.DeleteSource {
+		err = c.DeleteIndex(source)
+		if err != nil {
+			return result, err
+		}
+		result.DeletedSource = true
+
+		return result, nil
+	}
+
+	err = c.setIndexSettings(source, restore)
+	if err != nil {
+		return result, err
+	}
+	restore = nil
+
+	return result, nil
+}
+
+// Set several settings of an index at once, nil values resetting them to their default.
+func (c *Client) setIndexSettings(index string, settings map[string]interface{}) error {
+	agent := c.buildPutRequest(fmt.Sprintf("%s/_settings", index)).
+		Set("Content-Type", "application/json").
+		Send(map[string]interface{}{"index": settings})
+
+	_, err := handleErrWithBytes(agent)
+	return err
+}
+
+// Get the health status of a single index or index pattern.
+func (c *Client) getIndexHealthStatus(index string) (string, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("_cluster/health/%s", index)))
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.GetBytes(body, "status").String(), nil
+}
+
+// Holds the conditions under which an alias is rolled over, based on the
+// rollover API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-rollover-index.html
+// Empty conditions are omitted. With no conditions at all the rollover is unconditional.
+type RolloverConditions struct {
+	MaxAge              string `json:"max_age,omitempty"`
+	MaxDocs             int    `json:"max_docs,omitempty"`
+	MaxSize             string `json:"max_size,omitempty"`
+	MaxPrimaryShardSize string `json:"max_primary_shard_size,omitempty"`
+}
+
+// Holds the result of a rollover request.
+type RolloverResult struct {
+	Acknowledged       bool            `json:"acknowledged"`
+	ShardsAcknowledged bool            `json:"shards_acknowledged"`
+	OldIndex           string          `json:"old_index"`
+	NewIndex           string          `json:"new_index"`
+	RolledOver         bool            `json:"rolled_over"`
+	DryRun             bool            `json:"dry_run"`
+	Conditions         map[string]bool `json:"conditions"`
+}
+
+// MetConditions returns the conditions that were met, sorted by name.
+func (r RolloverResult) MetConditions() []string {
+	met := []string{}
+	for condition, ok := range r.Conditions {
+		if ok {
+			met = append(met, condition)
+		}
+	}
+	sort.Strings(met)
+	return met
+}
+
+// Roll over an alias to a new index when any of the given conditions is met.
+//
+// Use case: You manage time-based indices behind a write alias and want to
+// start writing to a new index once the current one is too old or too big.
+// With `dryRun` the conditions are checked without rolling over.
+func (c *Client) Rollover(alias string, conditions RolloverConditions, dryRun bool) (RolloverResult, error) {
+	return c.RolloverToIndex(alias, "", conditions, dryRun)
+}
+
+// Roll over an alias to a new index with the given name when any of the given conditions is met.
+//
+// Use case: Your indices don't follow the `-000001` naming pattern, so you want
+// to choose the name of the new index.
+func (c *Client) RolloverToIndex(alias, newIndex string, conditions RolloverConditions, dryRun bool) (RolloverResult, error) {
+	if alias == "" {
+		return RolloverResult{}, errors.New("Empty string for alias is not allowed")
+	}
+
+	path := fmt.Sprintf("%s/_rollover", alias)
+	if newIndex != "" {
+		path = fmt.Sprintf("%s/%s", path, newIndex)
+	}
+
+	if dryRun {
+		path = fmt.Sprintf("%s?dry_run=true", path)
+	}
+
+	agent := c.buildPostRequest(path)
+	if conditions != (RolloverConditions{}) {
+		request := struct {
+			Conditions RolloverConditions `json:"conditions"`
+		}{
+			Conditions: conditions,
+		}
+		agent.Set("Content-Type", "application/json").Send(request)
+	}
+
+	var result RolloverResult
+	err := handleErrWithStruct(agent, &result)
+	if err != nil {
+		return RolloverResult{}, err
+	}
+
+	return result, nil
+}
+
+// Holds the shard summary returned by broadcast operations such as refresh,
+// flush and cache clear.
+type ShardOperationResult struct {
+	Shards struct {
+		Total      int `json:"total"`
+		Successful int `json:"successful"`
+		Failed     int `json:"failed"`
+	} `json:"_shards"`
+}
+
+// Holds the options of a force merge, based on the force merge
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-forcemerge.html
+type ForceMergeOptions struct {
+	// The number of segments to merge to. Zero lets Elasticsearch decide.
+	MaxNumSegments int
+
+	// Only expunge segments containing deleted documents.
+	OnlyExpungeDeletes bool
+}
+
+// Holds which caches to clear, based on the clear cache
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-clearcache.html
+// If no cache is selected, all caches are cleared.
+type ClearCacheOptions struct {
+	Query     bool
+	Fielddata bool
+	Request   bool
+
+	// Limit the fielddata cache clearing to these fields.
+	Fields []string
+}
+
+// Holds information about a task, based on the task management
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/tasks.html
+type TaskStatus struct {
+	ID          string
+	Completed   bool
+	Action      string
+	Description string
+	StartTime   time.Time
+	RunningTime time.Duration
+	Error       string
+}
+
+// Force merge the segments of an index or index pattern. The merge runs in the
+// background and the ID of the task is returned so it can be tracked with
+// `GetTask` or `WaitForTask`.
+//
+// Use case: An index is no longer written to and you want to reduce its number
+// of segments or get rid of deleted documents. This can take hours.
+func (c *Client) ForceMerge(index string, opts ForceMergeOptions) (string, error) {
+	queryStrings := []string{"wait_for_completion=false"}
+
+	if opts.MaxNumSegments > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("max_num_segments=%d", opts.MaxNumSegments))
+	}
+
+	if opts.OnlyExpungeDeletes {
+		queryStrings = append(queryStrings, "only_expunge_deletes=true")
+	}
+
+	agent := c.buildPostRequest(fmt.Sprintf("%s/_forcemerge?%s", index, strings.Join(queryStrings, "&")))
+
+	body, err := handleErrWithBytes(agent)
+	if err != nil {
+		return "", err
+	}
+
+	task := gjson.GetBytes(body, "task").String()
+	if task == "" {
+		return "", fmt.Errorf(`No task returned when force merging "%s": %s`, index, body)
+	}
+
+	return task, nil
+}
+
+// Refresh an index or index pattern, making recent changes visible to search.
+//
+// Use case: You have bulk loaded data with refreshes disabled and want it to be searchable.
+func (c *Client) RefreshIndex(index string) (ShardOperationResult, error) {
+	var result ShardOperationResult
+	err := handleErrWithStruct(c.buildPostRequest(fmt.Sprintf("%s/_refresh", index)), &result)
+	if err != nil {
+		return ShardOperationResult{}, err
+	}
+
+	return result, nil
+}
+
+// Flush an index or index pattern, committing the transaction log to disk.
+//
+// Use case: You are about to restart nodes and want shard recoveries to need
+// as little transaction log replay as possible.
+func (c *Client) FlushIndex(index string, force bool) (ShardOperationResult, error) {
+	path := fmt.Sprintf("%s/_flush", index)
+	if force {
+		path = fmt.Sprintf("%s?force=true", path)
+	}
+
+	var result ShardOperationResult
+	err := handleErrWithStruct(c.buildPostRequest(path), &result)
+	if err != nil {
+		return ShardOperationResult{}, err
+	}
+
+	return result, nil
+}
+
+// Clear the caches of an index or index pattern.
+//
+// Use case: Fielddata is taking too much heap and you want to release it.
+func (c *Client) ClearIndexCache(index string, opts ClearCacheOptions) (ShardOperationResult, error) {
+	queryStrings := []string{}
+
+	if opts.Query {
+		queryStrings = append(queryStrings, "query=true")
+	}
+
+	if opts.Fielddata {
+		queryStrings = append(queryStrings, "fielddata=true")
+	}
+
+	if opts.Request {
+		queryStrings = append(queryStrings, "request=true")
+	}
+
+	if len(opts.Fields) > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("fields=%s", strings.Join(opts.Fields, ",")))
+	}
+
+	path := fmt.Sprintf("%s/_cache/clear", index)
+	if len(queryStrings) > 0 {
+		path = fmt.Sprintf("%s?%s", path, strings.Join(queryStrings, "&"))
+	}
+
+	var result ShardOperationResult
+	err := handleErrWithStruct(c.buildPostRequest(path), &result)
+	if err != nil {
+		return ShardOperationResult{}, err
+	}
+
+	return result, nil
+}
+
+// Get the status of a task.
+//
+// Use case: You have started a long running operation such as a force merge
+// and want to know whether it has completed.
+func (c *Client) GetTask(taskID string) (TaskStatus, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("_tasks/%s", taskID)))
+	if err != nil {
+		return TaskStatus{}, err
+	}
+
+	task := TaskStatus{
+		ID:          taskID,
+		Completed:   gjson.GetBytes(body, "completed").Bool(),
+		Action:      gjson.GetBytes(body, "task.action").String(),
+		Description: gjson.GetBytes(body, "task.description").String(),
+		StartTime:   time.Unix(0, gjson.GetBytes(body, "task.start_time_in_millis").Int()*int64(time.Millisecond)),
+		RunningTime: time.Duration(gjson.GetBytes(body, "task.running_time_in_nanos").Int()),
+	}
+
+	if taskError := gjson.GetBytes(body, "error"); taskError.Exists() {
+		task.Error = fmt.Sprintf("%s: %s", taskError.Get("type").String(), taskError.Get("reason").String())
+	}
+
+	return task, nil
+}
+
+// Wait for a task to complete, polling it at the given interval, every 10
+// seconds if 0. The optional progress function is called with the status of
+// the task after every poll. Returns an error once the timeout has passed.
+// Waits without limit if the timeout is 0.
+//
+// Use case: You want to block until a force merge has finished.
+func (c *Client) WaitForTask(taskID string, pollInterval time.Duration, timeout time.Duration, progress func(TaskStatus)) (TaskStatus, error) {
+	if pollInterval == 0 {
+		pollInterval = 10 * time.Second
+	}
+
+	start := time.Now()
+	for {
+		task, err := c.GetTask(taskID)
+		if err != nil {
+			return TaskStatus{}, err
+		}
+
+		if progress != nil {
+			progress(task)
+		}
+
+		if task.Completed {
+			if task.Error != "" {
+				return task, fmt.Errorf(`Task "%s" failed: %s`, taskID, task.Error)
+			}
+			return task, nil
+		}
+
+		if timeout != 0 && time.Since(start) > timeout {
+			return task, fmt.Errorf(`Timed out waiting for task "%s" to complete`, taskID)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Holds information about a Lucene segment of a shard, based on the index segments
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-segments.html
+type Segment struct {
+	Name        string
+	Generation  int   `json:"generation"`
+	NumDocs     int   `json:"num_docs"`
+	DeletedDocs int   `json:"deleted_docs"`
+	SizeBytes   int64 `json:"size_in_bytes"`
+	Committed   bool  `json:"committed"`
+	Searchable  bool  `json:"search"`
+	Compound    bool  `json:"compound"`
+}
+
+// Holds the segments of a single shard copy.
+type ShardSegments struct {
+	Index                string
+	Shard                int
+	Primary              bool
+	State                string
+	Node                 string
+	NumCommittedSegments int
+	NumSearchSegments    int
+	Segments             []Segment
+}
+
+// Get the number of documents, deleted documents and bytes across all segments of the shard.
+func (s ShardSegments) Totals() (docs int, deletedDocs int, sizeBytes int64) {
+	for _, segment := range s.Segments {
+		docs += segment.NumDocs
+		deletedDocs += segment.DeletedDocs
+		sizeBytes += segment.SizeBytes
+	}
+	return docs, deletedDocs, sizeBytes
+}
+
+// Holds the thresholds used to flag force merge candidates in a segment report.
+type SegmentReportOptions struct {
+	// Flag indices having a shard with more segments than this. Defaults to 50.
+	MaxSegmentsPerShard int
+
+	// Flag indices where deleted documents make up more than this ratio of
+	// all documents. Defaults to 0.2.
+	MaxDeletedDocsRatio float64
+}
+
+// Holds segment statistics of the primary shards of an index and whether it
+// is a candidate for a force merge.
+type IndexSegmentReport struct {
+	Index               string
+	Shards              int
+	Segments            int
+	MaxSegmentsPerShard int
+	Docs                int
+	DeletedDocs         int
+	DeletedDocsRatio    float64
+	SizeBytes           int64
+	ForceMergeCandidate bool
+	Reasons             []string
+}
+
+// Get the segments of every shard copy of an index or index pattern.
+//
+// Use case: You want to know how fragmented the shards of an index are.
+func (c *Client) GetIndexSegments(index string) ([]ShardSegments, error) {
+	var response struct {
+		Indices map[string]struct {
+			Shards map[string][]struct {
+				Routing struct {
+					State   string `json:"state"`
+					Primary bool   `json:"primary"`
+					Node    string `json:"node"`
+				} `json:"routing"`
+				NumCommittedSegments int                `json:"num_committed_segments"`
+				NumSearchSegments    int                `json:"num_search_segments"`
+				Segments             map[string]Segment `json:"segments"`
+			} `json:"shards"`
+		} `json:"indices"`
+	}
+
+	err := handleErrWithStruct(c.buildGetRequest(fmt.Sprintf("%s/_segments", index)), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	shardSegments := []ShardSegments{}
+	for indexName, indexSegments := range response.Indices {
+		for shardNumber, copies := range indexSegments.Shards {
+			shard, err := strconv.Atoi(shardNumber)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected shard number %q: %w", shardNumber, err)
+			}
+
+			for _, shardCopy := range copies {
+				segments := make([]Segment, 0, len(shardCopy.Segments))
+				for name, segment := range shardCopy.Segments {
+					segment.Name = name
+					segments = append(segments, segment)
+				}
+				sort.Slice(segments, func(i, j int) bool {
+					return segments[i].Generation < segments[j].Generation
+				})
+
+				shardSegments = append(shardSegments, ShardSegments{
+					Index:                indexName,
+					Shard:                shard,
+					Primary:              shardCopy.Routing.Primary,
+					State:                shardCopy.Routing.State,
+					Node:                 shardCopy.Routing.Node,
+					NumCommittedSegments: shardCopy.NumCommittedSegments,
+					NumSearchSegments:    shardCopy.NumSearchSegments,
+					Segments:             segments,
+				})
+			}
+		}
+	}
+
+	sort.Slice(shardSegments, func(i, j int) bool {
+		if shardSegments[i].Index != shardSegments[j].Index {
+			return shardSegments[i].Index < shardSegments[j].Index
+		}
+		if shardSegments[i].Shard != shardSegments[j].Shard {
+			return shardSegments[i].Shard < shardSegments[j].Shard
+		}
+		return shardSegments[i].Primary && !shardSegments[j].Primary
+	})
+
+	return shardSegments, nil
+}
+
+// Get a per index segment report of an index or index pattern, flagging
+// indices with too many segments or too many deleted documents.
+//
+// Use case: You want to find which indices would benefit from a force merge.
+func (c *Client) GetSegmentReport(index string, opts SegmentReportOptions) ([]IndexSegmentReport, error) {
+	shardSegments, err := c.GetIndexSegments(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSegmentReport(shardSegments, opts), nil
+}
+
+// Holds a subset of the metrics of the index stats
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-stats.html
+// Counters are cumulative since the shards were started.
+type IndexStatsMetrics struct {
+	DocsCount             int64
+	DocsDeleted           int64
+	StoreSizeBytes        int64
+	IndexingTotal         int64
+	IndexingTimeMillis    int64
+	SearchQueryTotal      int64
+	SearchQueryTimeMillis int64
+	SearchFetchTotal      int64
+	GetTotal              int64
+	GetTimeMillis         int64
+	QueryCacheMemoryBytes int64
+	QueryCacheHitCount    int64
+	QueryCacheMissCount   int64
+	QueryCacheEvictions   int64
+	FielddataMemoryBytes  int64
+	FielddataEvictions    int64
+	SegmentsCount         int64
+	SegmentsMemoryBytes   int64
+	RefreshTotal          int64
+	RefreshTimeMillis     int64
+	FlushTotal            int64
+	FlushTimeMillis       int64
+}
+
+var indexStatsMetricFields = map[string]func(IndexStatsMetrics) int64{
+	"docs.count":              func(m IndexStatsMetrics) int64 { return m.DocsCount },
+	"docs.deleted":            func(m IndexStatsMetrics) int64 { return m.DocsDeleted },
+	"store.size":              func(m IndexStatsMetrics) int64 { return m.StoreSizeBytes },
+	"indexing.total":          func(m IndexStatsMetrics) int64 { return m.IndexingTotal },
+	"indexing.time":           func(m IndexStatsMetrics) int64 { return m.IndexingTimeMillis },
+	"search.query_total":      func(m IndexStatsMetrics) int64 { return m.SearchQueryTotal },
+	"search.query_time":       func(m IndexStatsMetrics) int64 { return m.SearchQueryTimeMillis },
+	"search.fetch_total":      func(m IndexStatsMetrics) int64 { return m.SearchFetchTotal },
+	"get.total":               func(m IndexStatsMetrics) int64 { return m.GetTotal },
+	"get.time":                func(m IndexStatsMetrics) int64 { return m.GetTimeMillis },
+	"query_cache.memory_size": func(m IndexStatsMetrics) int64 { return m.QueryCacheMemoryBytes },
+	"query_cache.hit_count":   func(m IndexStatsMetrics) int64 { return m.QueryCacheHitCount },
+	"query_cache.miss_count":  func(m IndexStatsMetrics) int64 { return m.QueryCacheMissCount },
+	"query_cache.evictions":   func(m IndexStatsMetrics) int64 { return m.QueryCacheEvictions },
+	"fielddata.memory_size":   func(m IndexStatsMetrics) int64 { return m.FielddataMemoryBytes },
+	"fielddata.evictions":     func(m IndexStatsMetrics) int64 { return m.FielddataEvictions },
+	"segments.count":          func(m IndexStatsMetrics) int64 { return m.SegmentsCount },
+	"segments.memory":         func(m IndexStatsMetrics) int64 { return m.SegmentsMemoryBytes },
+	"refresh.total":           func(m IndexStatsMetrics) int64 { return m.RefreshTotal },
+	"refresh.time":            func(m IndexStatsMetrics) int64 { return m.RefreshTimeMillis },
+	"flush.total":             func(m IndexStatsMetrics) int64 { return m.FlushTotal },
+	"flush.time":              func(m IndexStatsMetrics) int64 { return m.FlushTimeMillis },
+}
+
+// IndexStatsMetricNames returns the names accepted by `IndexStatsMetrics.Metric`, sorted.
+func IndexStatsMetricNames() []string {
+	names := make([]string, 0, len(indexStatsMetricFields))
+	for name := range indexStatsMetricFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Metric returns the value of a metric by name, i.e. "store.size" or "fielddata.memory_size".
+func (m IndexStatsMetrics) Metric(name string) (int64, error) {
+	field, ok := indexStatsMetricFields[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown index stats metric %q", name)
+	}
+	return field(m), nil
+}
+
+// Holds the stats of a single shard copy.
+type ShardStats struct {
+	Index   string
+	Shard   int
+	Primary bool
+	State   string
+	Node    string
+	Metrics IndexStatsMetrics
+}
+
+// Holds the stats of an index, for its primaries, for all shard copies and per shard copy.
+type IndexStats struct {
+	Name      string
+	Primaries IndexStatsMetrics
+	Total     IndexStatsMetrics
+	Shards    []ShardStats
+}
+
+// Holds per second rates of an index, computed from two samples of its stats.
+type IndexStatsRates struct {
+	Name              string
+	IndexingPerSecond float64
+	SearchPerSecond   float64
+	GetPerSecond      float64
+}
+
+// RatesSince computes the indexing, search and get rates of all shard copies
+// of the index from an earlier sample taken `elapsed` ago.
+func (s IndexStats) RatesSince(previous IndexStats, elapsed time.Duration) IndexStatsRates {
+	rates := IndexStatsRates{Name: s.Name}
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		return rates
+	}
+
+	rates.IndexingPerSecond = float64(s.Total.IndexingTotal-previous.Total.IndexingTotal) / seconds
+	rates.SearchPerSecond = float64(s.Total.SearchQueryTotal-previous.Total.SearchQueryTotal) / seconds
+	rates.GetPerSecond = float64(s.Total.GetTotal-previous.Total.GetTotal) / seconds
+	return rates
+}
+
+// Get typed stats for an index or index pattern, per index and per shard copy.
+//
+// Use case: You want to find the indices using the most disk, cache or
+// segments memory, or taking the most indexing and search traffic.
+func (c *Client) GetIndexStats(index string) ([]IndexStats, error) {
+	path := "_stats?level=shards"
+	if index != "" {
+		path = fmt.Sprintf("%s/%s", index, path)
+	}
+
+	body, err := handleErrWithBytes(c.buildGetRequest(path))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []IndexStats{}
+	var parseErr error
+	gjson.GetBytes(body, "indices").ForEach(func(name, value gjson.Result) bool {
+		indexStats := IndexStats{
+			Name:      name.String(),
+			Primaries: indexStatsMetricsFromJSON(value.Get("primaries")),
+			Total:     indexStatsMetricsFromJSON(value.Get("total")),
+		}
+
+		value.Get("shards").ForEach(func(shardNumber, copies gjson.Result) bool {
+			shard, err := strconv.Atoi(shardNumber.String())
+			if err != nil {
+				parseErr = fmt.Errorf("unexpected shard number %q: %w", shardNumber.String(), err)
+				return false
+			}
+
+			for _, shardCopy := range copies.Array() {
+				indexStats.Shards = append(indexStats.Shards, ShardStats{
+					Index:   indexStats.Name,
+					Shard:   shard,
+					Primary: shardCopy.Get("routing.primary").Bool(),
+					State:   shardCopy.Get("routing.state").String(),
+					Node:    shardCopy.Get("routing.node").String(),
+					Metrics: indexStatsMetricsFromJSON(shardCopy),
+				})
+			}
+			return true
+		})
+
+		if parseErr != nil {
+			return false
+		}
+
+		sort.Slice(indexStats.Shards, func(i, j int) bool {
+			if indexStats.Shards[i].Shard != indexStats.Shards[j].Shard {
+				return indexStats.Shards[i].Shard < indexStats.Shards[j].Shard
+			}
+			return indexStats.Shards[i].Primary && !indexStats.Shards[j].Primary
+		})
+
+		stats = append(stats, indexStats)
+		return true
+	})
+
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats, nil
+}
+
+// Get the version of Elasticsearch the cluster is running, i.e. "7.10.2".
+//
+// Use case: You want to use an API that is only available on recent versions of Elasticsearch.
+func (c *Client) GetClusterVersion() (string, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(""))
+	if err != nil {
+		return "", err
+	}
+
+	version := gjson.GetBytes(body, "version.number").String()
+	if version == "" {
+		return "", fmt.Errorf("No version number found in response: %s", body)
+	}
+
+	return version, nil
+}
+
+// Check that the cluster runs at least the given major and minor version of Elasticsearch.
+func (c *Client) clusterVersionAtLeast(major, minor int) (bool, error) {
+	version, err := c.GetClusterVersion()
+	if err != nil {
+		return false, err
+	}
+
+	return versionAtLeast(version, major, minor), nil
+}
+
+var (
+	ErrComposableTemplatesUnsupported = errors.New("Composable index and component templates require Elasticsearch 7.8 or later")
+	ErrSimulateIndexUnsupported       = errors.New("Simulating index templates requires Elasticsearch 7.9 or later")
+)
+
+// Holds the settings, mappings and aliases applied by an index template or component template.
+type TemplateContent struct {
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Mappings map[string]interface{} `json:"mappings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
+}
+
+// Holds a legacy index template, based on the index template
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/7.10/indices-templates-v1.html
+type LegacyIndexTemplate struct {
+	Name          string                 `json:"-"`
+	IndexPatterns []string               `json:"index_patterns"`
+	Order         int                    `json:"order"`
+	Version       *int                   `json:"version,omitempty"`
+	Settings      map[string]interface{} `json:"settings,omitempty"`
+	Mappings      map[string]interface{} `json:"mappings,omitempty"`
+	Aliases       map[string]interface{} `json:"aliases,omitempty"`
+}
+
+// Holds a composable index template, based on the index template
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/index-templates.html
+type ComposableIndexTemplate struct {
+	Name          string                 `json:"-"`
+	IndexPatterns []string               `json:"index_patterns"`
+	ComposedOf    []string               `json:"composed_of,omitempty"`
+	Priority      *int                   `json:"priority,omitempty"`
+	Version       *int                   `json:"version,omitempty"`
+	Template      *TemplateContent       `json:"template,omitempty"`
+	DataStream    *DataStreamTemplate    `json:"data_stream,omitempty"`
+	Meta          map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// Marks a composable index template as creating data streams instead of regular indices.
+type DataStreamTemplate struct {
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// Holds a component template, based on the component template
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/indices-component-template.html
+type ComponentTemplate struct {
+	Name     string                 `json:"-"`
+	Template TemplateContent        `json:"template"`
+	Version  *int                   `json:"version,omitempty"`
+	Meta     map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// Holds the template configuration a new index with a given name would get.
+type SimulatedIndexTemplate struct {
+	// The composable template the index would match, empty if none matches.
+	MatchedTemplate string
+
+	// The legacy templates the index would match, in the order they are applied.
+	// Only used when no composable template matches.
+	MatchedLegacyTemplates []string
+
+	Template TemplateContent
+
+	// Lower priority composable templates that also match the index name.
+	Overlapping []struct {
+		Name          string   `json:"name"`
+		IndexPatterns []string `json:"index_patterns"`
+	}
+}
+
+// List the legacy index templates matching the name or wildcard expression, or all of them if empty.
+//
+// Use case: You want to see which legacy templates exist on the cluster.
+func (c *Client) GetLegacyIndexTemplates(name string) ([]LegacyIndexTemplate, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_template/%s", name), "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []LegacyIndexTemplate{}
+	var parseErr error
+	gjson.ParseBytes(body).ForEach(func(key, value gjson.Result) bool {
+		var template LegacyIndexTemplate
+		parseErr = json.Unmarshal([]byte(value.Raw), &template)
+		if parseErr != nil {
+			parseErr = fmt.Errorf("failed to unmarshal template %s: %w", key.String(), parseErr)
+			return false
+		}
+
+		// Elasticsearch 5 uses a single "template" pattern
+		if len(template.IndexPatterns) == 0 && value.Get("template").Exists() {
+			template.IndexPatterns = []string{value.Get("template").String()}
+		}
+
+		template.Name = key.String()
+		templates = append(templates, template)
+		return true
+	})
+
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates, nil
+}
+
+// Create or update a legacy index template.
+//
+// Use case: You want new indices matching a pattern to get specific settings
+// on a cluster that doesn't support composable templates.
+func (c *Client) PutLegacyIndexTemplate(template LegacyIndexTemplate) error {
+	if template.Name == "" {
+		return errors.New("Template name is required")
+	}
+
+	var request interface{} = template
+
+	versionSupportsPatterns, err := c.clusterVersionAtLeast(6, 0)
+	if err != nil {
+		return err
+	}
+
+	// Elasticsearch 5 uses a single "template" pattern
+	if !versionSupportsPatterns {
+		request = struct {
+			LegacyIndexTemplate
+			IndexPatterns []string `json:"index_patterns,omitempty"`
+			Template      string   `json:"template"`
+		}{
+			LegacyIndexTemplate: template,
+			Template:            strings.Join(template.IndexPatterns, ","),
+		}
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_template/%s", template.Name)).
+		Set("Content-Type", "application/json").
+		Send(request)
+
+	return handleAcknowledged(agent, fmt.Sprintf(`put template "%s"`, template.Name))
+}
+
+// Delete a legacy index template.
+//
+// Use case: You want to stop a legacy template from applying to new indices.
+func (c *Client) DeleteLegacyIndexTemplate(name string) error {
+	if name == "" {
+		return errors.New("Template name is required")
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_template/%s", name)), fmt.Sprintf(`delete template "%s"`, name))
+}
+
+// List the composable index templates matching the name or wildcard expression, or all of them if empty.
+//
+// Use case: You want to see which composable templates exist on the cluster.
+func (c *Client) GetComposableIndexTemplates(name string) ([]ComposableIndexTemplate, error) {
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return nil, ErrComposableTemplatesUnsupported
+	}
+
+	var response struct {
+		IndexTemplates []struct {
+			Name          string                  `json:"name"`
+			IndexTemplate ComposableIndexTemplate `json:"index_template"`
+		} `json:"index_templates"`
+	}
+
+	err = handleErrWithStruct(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_index_template/%s", name), "/")), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]ComposableIndexTemplate, 0, len(response.IndexTemplates))
+	for _, t := range response.IndexTemplates {
+		template := t.IndexTemplate
+		template.Name = t.Name
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates, nil
+}
+
+// Create or update a composable index template.
+//
+// Use case: You want new indices or data streams matching a pattern to get specific settings and mappings.
+func (c *Client) PutComposableIndexTemplate(template ComposableIndexTemplate) error {
+	if template.Name == "" {
+		return errors.New("Template name is required")
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrComposableTemplatesUnsupported
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_index_template/%s", template.Name)).
+		Set("Content-Type", "application/json").
+		Send(template)
+
+	return handleAcknowledged(agent, fmt.Sprintf(`put index template "%s"`, template.Name))
+}
+
+// Delete a composable index template.
+//
+// Use case: You want to stop a composable template from applying to new indices.
+func (c *Client) DeleteComposableIndexTemplate(name string) error {
+	if name == "" {
+		return errors.New("Template name is required")
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrComposableTemplatesUnsupported
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_index_template/%s", name)), fmt.Sprintf(`delete index template "%s"`, name))
+}
+
+// List the component templates matching the name or wildcard expression, or all of them if empty.
+//
+// Use case: You want to see the building blocks your composable templates are made of.
+func (c *Client) GetComponentTemplates(name string) ([]ComponentTemplate, error) {
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supported {
+		return nil, ErrComposableTemplatesUnsupported
+	}
+
+	var response struct {
+		ComponentTemplates []struct {
+			Name              string            `json:"name"`
+			ComponentTemplate ComponentTemplate `json:"component_template"`
+		} `json:"component_templates"`
+	}
+
+	err = handleErrWithStruct(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_component_template/%s", name), "/")), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]ComponentTemplate, 0, len(response.ComponentTemplates))
+	for _, t := range response.ComponentTemplates {
+		template := t.ComponentTemplate
+		template.Name = t.Name
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates, nil
+}
+
+// Create or update a component template.
+//
+// Use case: You want to share settings or mappings between several composable templates.
+func (c *Client) PutComponentTemplate(template ComponentTemplate) error {
+	if template.Name == "" {
+		return errors.New("Template name is required")
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrComposableTemplatesUnsupported
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_component_template/%s", template.Name)).
+		Set("Content-Type", "application/json").
+		Send(template)
+
+	return handleAcknowledged(agent, fmt.Sprintf(`put component template "%s"`, template.Name))
+}
+
+// Delete a component template.
+//
+// Use case: You want to remove a component template that is no longer used by any composable template.
+func (c *Client) DeleteComponentTemplate(name string) error {
+	if name == "" {
+		return errors.New("Template name is required")
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 8)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrComposableTemplatesUnsupported
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_component_template/%s", name)), fmt.Sprintf(`delete component template "%s"`, name))
+}
+
+// Simulate which template configuration a new index with the given name would get.
+// On clusters without composable templates only the matching legacy templates are returned.
+//
+// Use case: You are about to create an index and want to check which template it will pick up.
+func (c *Client) SimulateIndexTemplate(indexName string) (SimulatedIndexTemplate, error) {
+	if indexName == "" {
+		return SimulatedIndexTemplate{}, errors.New("Empty string for index name is not allowed")
+	}
+
+	version, err := c.GetClusterVersion()
+	if err != nil {
+		return SimulatedIndexTemplate{}, err
+	}
+
+	var simulated SimulatedIndexTemplate
+
+	if versionAtLeast(version, 7, 8) {
+		composableTemplates, err := c.GetComposableIndexTemplates("")
+		if err != nil {
+			return SimulatedIndexTemplate{}, err
+		}
+		simulated.MatchedTemplate = matchComposableTemplate(composableTemplates, indexName)
+	}
+
+	if simulated.MatchedTemplate == "" {
+		legacyTemplates, err := c.GetLegacyIndexTemplates("")
+		if err != nil {
+			return SimulatedIndexTemplate{}, err
+		}
+		simulated.MatchedLegacyTemplates = matchLegacyTemplates(legacyTemplates, indexName)
+	}
+
+	if !versionAtLeast(version, 7, 9) {
+		return simulated, nil
+	}
+
+	var response struct {
+		Template    TemplateContent `json:"template"`
+		Overlapping []struct {
+			Name          string   `json:"name"`
+			IndexPatterns []string `json:"index_patterns"`
+		} `json:"overlapping"`
+	}
+
+	err = handleErrWithStruct(c.buildPostRequest(fmt.Sprintf("_index_template/_simulate_index/%s", indexName)), &response)
+	if err != nil {
+		return SimulatedIndexTemplate{}, err
+	}
+
+	simulated.Template = response.Template
+	simulated.Overlapping = response.Overlapping
+
+	return simulated, nil
+}
+
+func handleAcknowledged(agent *gorequest.SuperAgent, action string) error {
+	var response acknowledgedResponse
+	err := handleErrWithStruct(agent, &response)
+	if err != nil {
+		return err
+	}
+
+	if !response.Acknowledged {
+		return fmt.Errorf(`Request to %s was not acknowledged. %+v`, action, response)
+	}
+
+	return nil
+}
+
+var ErrDataStreamsUnsupported = errors.New("Data streams require Elasticsearch 7.9 or later")
+
+// Holds information about a data stream, based on the data stream
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/data-streams.html
+type DataStream struct {
+	Name           string
+	TimestampField string
+	BackingIndices []string
+	Generation     int
+	Status         string
+	Template       string
+	ILMPolicy      string
+	Hidden         bool
+	System         bool
+}
+
+// WriteIndex returns the backing index new documents are written to.
+func (d DataStream) WriteIndex() string {
+	if len(d.BackingIndices) == 0 {
+		return ""
+	}
+	return d.BackingIndices[len(d.BackingIndices)-1]
+}
+
+// Holds the stats of a data stream, based on the data stream stats
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/data-stream-stats-api.html
+type DataStreamStats struct {
+	Name             string `json:"data_stream"`
+	BackingIndices   int    `json:"backing_indices"`
+	StoreSizeBytes   int64  `json:"store_size_bytes"`
+	MaximumTimestamp int64  `json:"maximum_timestamp"`
+}
+
+func (c *Client) checkDataStreamsSupported() error {
+	supported, err := c.clusterVersionAtLeast(7, 9)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrDataStreamsUnsupported
+	}
+
+	return nil
+}
+
+// List the data streams matching the name or wildcard expression, or all of them if empty.
+//
+// Use case: You want to see the data streams of the cluster along with their backing indices.
+func (c *Client) GetDataStreams(name string) ([]DataStream, error) {
+	err := c.checkDataStreamsSupported()
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		DataStreams []struct {
+			Name           string `json:"name"`
+			TimestampField struct {
+				Name string `json:"name"`
+			} `json:"timestamp_field"`
+			Indices []struct {
+				IndexName string `json:"index_name"`
+			} `json:"indices"`
+			Generation int    `json:"generation"`
+			Status     string `json:"status"`
+			Template   string `json:"template"`
+			ILMPolicy  string `json:"ilm_policy"`
+			Hidden     bool   `json:"hidden"`
+			System     bool   `json:"system"`
+		} `json:"data_streams"`
+	}
+
+	err = handleErrWithStruct(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_data_stream/%s", name), "/")), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	dataStreams := make([]DataStream, 0, len(response.DataStreams))
+	for _, d := range response.DataStreams {
+		backingIndices := make([]string, 0, len(d.Indices))
+		for _, index := range d.Indices {
+			backingIndices = append(backingIndices, index.IndexName)
+		}
+
+		dataStreams = append(dataStreams, DataStream{
+			Name:           d.Name,
+			TimestampField: d.TimestampField.Name,
+			BackingIndices: backingIndices,
+			Generation:     d.Generation,
+			Status:         d.Status,
+			Template:       d.Template,
+			ILMPolicy:      d.ILMPolicy,
+			Hidden:         d.Hidden,
+			System:         d.System,
+		})
+	}
+
+	return dataStreams, nil
+}
+
+// Create a data stream. A composable index template with data streams enabled must match its name.
+//
+// Use case: You want to create a data stream before any document is written to it.
+func (c *Client) CreateDataStream(name string) error {
+	if name == "" {
+		return errors.New("Empty string for data stream name is not allowed")
+	}
+
+	err := c.checkDataStreamsSupported()
+	if err != nil {
+		return err
+	}
+
+	return handleAcknowledged(c.buildPutRequest(fmt.Sprintf("_data_stream/%s", name)), fmt.Sprintf(`create data stream "%s"`, name))
+}
+
+// Delete a data stream and all of its backing indices.
+//
+// Use case: You want to remove a data stream and all of its data.
+func (c *Client) DeleteDataStream(name string) error {
+	if name == "" {
+		return errors.New("Empty string for data stream name is not allowed")
+	}
+
+	err := c.checkDataStreamsSupported()
+	if err != nil {
+		return err
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_data_stream/%s", name)), fmt.Sprintf(`delete data stream "%s"`, name))
+}
+
+// Roll over a data stream to a new write index when any of the given conditions is met.
+//
+// Use case: You changed the template of a data stream and want the change to apply right away.
+func (c *Client) RolloverDataStream(name string, conditions RolloverConditions, dryRun bool) (RolloverResult, error) {
+	err := c.checkDataStreamsSupported()
+	if err != nil {
+		return RolloverResult{}, err
+	}
+
+	return c.Rollover(name, conditions, dryRun)
+}
+
+// Get the stats of the data streams matching the name or wildcard expression, or all of them if empty.
+//
+// Use case: You want to see how much disk each data stream uses and when it last received data.
+func (c *Client) GetDataStreamStats(name string) ([]DataStreamStats, error) {
+	err := c.checkDataStreamsSupported()
+	if err != nil {
+		return nil, err
+	}
+
+	path := "_data_stream/_stats"
+	if name != "" {
+		path = fmt.Sprintf("_data_stream/%s/_stats", name)
+	}
+
+	var response struct {
+		DataStreams []DataStreamStats `json:"data_streams"`
+	}
+
+	err = handleErrWithStruct(c.buildGetRequest(path), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.DataStreams, nil
+}
+
+// Holds a phase of an ILM policy, based on the index lifecycle management
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/ilm-put-lifecycle.html
+type ILMPhase struct {
+	MinAge  string                 `json:"min_age,omitempty"`
+	Actions map[string]interface{} `json:"actions"`
+}
+
+// Holds an ILM policy.
+type ILMPolicy struct {
+	Name         string                 `json:"-"`
+	Version      int                    `json:"-"`
+	ModifiedDate string                 `json:"-"`
+	Phases       map[string]ILMPhase    `json:"phases"`
+	Meta         map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// Holds the ILM state of an index, based on the explain lifecycle
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/ilm-explain-lifecycle.html
+type ILMIndexExplain struct {
+	Index                string `json:"index"`
+	Managed              bool   `json:"managed"`
+	Policy               string `json:"policy"`
+	Age                  string `json:"age"`
+	Phase                string `json:"phase"`
+	Action               string `json:"action"`
+	Step                 string `json:"step"`
+	FailedStep           string `json:"failed_step"`
+	FailedStepRetryCount int    `json:"failed_step_retry_count"`
+	IsAutoRetryableError bool   `json:"is_auto_retryable_error"`
+	LifecycleDateMillis  int64  `json:"lifecycle_date_millis"`
+	PhaseTimeMillis      int64  `json:"phase_time_millis"`
+	ActionTimeMillis     int64  `json:"action_time_millis"`
+	StepTimeMillis       int64  `json:"step_time_millis"`
+	StepInfo             struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"step_info"`
+}
+
+// Failed reports whether the index is stuck in the ILM error step.
+func (e ILMIndexExplain) Failed() bool {
+	return e.Step == "ERROR"
+}
+
+// List the ILM policies matching the name, or all of them if empty.
+//
+// Use case: You want to see the lifecycle policies defined on the cluster.
+func (c *Client) GetILMPolicies(name string) ([]ILMPolicy, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_ilm/policy/%s", name), "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []ILMPolicy{}
+	var parseErr error
+	gjson.ParseBytes(body).ForEach(func(key, value gjson.Result) bool {
+		var policy ILMPolicy
+		parseErr = json.Unmarshal([]byte(value.Get("policy").Raw), &policy)
+		if parseErr != nil {
+			parseErr = fmt.Errorf("failed to unmarshal policy %s: %w", key.String(), parseErr)
+			return false
+		}
+
+		policy.Name = key.String()
+		policy.Version = int(value.Get("version").Int())
+		policy.ModifiedDate = value.Get("modified_date").String()
+		policies = append(policies, policy)
+		return true
+	})
+
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+
+	return policies, nil
+}
+
+// Create or update an ILM policy.
+//
+// Use case: You want to change when indices move to the warm phase or get deleted.
+func (c *Client) PutILMPolicy(policy ILMPolicy) error {
+	if policy.Name == "" {
+		return errors.New("Policy name is required")
+	}
+
+	request := struct {
+		Policy ILMPolicy `json:"policy"`
+	}{
+		Policy: policy,
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_ilm/policy/%s", policy.Name)).
+		Set("Content-Type", "application/json").
+		Send(request)
+
+	return handleAcknowledged(agent, fmt.Sprintf(`put ILM policy "%s"`, policy.Name))
+}
+
+// Delete an ILM policy. The policy must not be in use by any index.
+//
+// Use case: You want to remove a policy that is no longer used.
+func (c *Client) DeleteILMPolicy(name string) error {
+	if name == "" {
+		return errors.New("Policy name is required")
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_ilm/policy/%s", name)), fmt.Sprintf(`delete ILM policy "%s"`, name))
+}
+
+// Attach an ILM policy to an index or index pattern.
+//
+// Use case: You created indices without a template and want them managed by a policy.
+func (c *Client) SetIndexILMPolicy(index, policy string) error {
+	_, _, err := c.SetIndexSetting(index, "lifecycle.name", policy)
+	return err
+}
+
+// Explain the ILM state of an index or index pattern: its current phase,
+// action and step, and why a step failed. Patterns also match hidden and
+// closed indices, such as the .ds-* backing indices of data streams.
+//
+// Use case: An index is not rolling over or not being deleted and you want to know why.
+func (c *Client) ExplainILM(index string, onlyErrors bool) ([]ILMIndexExplain, error) {
+	path := fmt.Sprintf("%s/_ilm/explain?expand_wildcards=all", index)
+	if onlyErrors {
+		path = fmt.Sprintf("%s&only_errors=true", path)
+	}
+
+	var response struct {
+		Indices map[string]ILMIndexExplain `json:"indices"`
+	}
+
+	err := handleErrWithStruct(c.buildGetRequest(path), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	explains := make([]ILMIndexExplain, 0, len(response.Indices))
+	for _, explain := range response.Indices {
+		explains = append(explains, explain)
+	}
+
+	sort.Slice(explains, func(i, j int) bool {
+		return explains[i].Index < explains[j].Index
+	})
+
+	return explains, nil
+}
+
+// Retry the failed ILM step of an index or index pattern.
+//
+// Use case: You fixed the cause of a failed ILM step, i.e. freed disk space, and want ILM to continue.
+func (c *Client) RetryILM(index string) error {
+	return handleAcknowledged(c.buildPostRequest(fmt.Sprintf("%s/_ilm/retry", index)), fmt.Sprintf(`retry ILM on "%s"`, index))
+}
+
+// Start ILM on the cluster.
+//
+// Use case: You stopped ILM for maintenance and want it to manage indices again.
+func (c *Client) StartILM() error {
+	return handleAcknowledged(c.buildPostRequest("_ilm/start"), "start ILM")
+}
+
+// Stop ILM on the cluster. Running operations finish before ILM is stopped.
+//
+// Use case: You are performing maintenance and don't want ILM to move or delete indices in the meantime.
+func (c *Client) StopILM() error {
+	return handleAcknowledged(c.buildPostRequest("_ilm/stop"), "stop ILM")
+}
+
+// Get the ILM operation mode of the cluster: RUNNING, STOPPING or STOPPED.
+//
+// Use case: You want to check ILM is running before relying on it.
+func (c *Client) GetILMStatus() (string, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest("_ilm/status"))
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.GetBytes(body, "operation_mode").String(), nil
+}
+
+// Holds the retention of an SLM policy.
+type SLMRetention struct {
+	ExpireAfter string `json:"expire_after,omitempty"`
+	MinCount    int    `json:"min_count,omitempty"`
+	MaxCount    int    `json:"max_count,omitempty"`
+}
+
+// Holds an SLM policy, based on the snapshot lifecycle management
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/slm-api-put-policy.html
+type SLMPolicy struct {
+	Name         string                 `json:"-"`
+	Schedule     string                 `json:"schedule"`
+	SnapshotName string                 `json:"name"`
+	Repository   string                 `json:"repository"`
+	Config       map[string]interface{} `json:"config,omitempty"`
+	Retention    *SLMRetention          `json:"retention,omitempty"`
+}
+
+// Holds a snapshot taken, or attempted, by an SLM policy.
+type SLMInvocation struct {
+	SnapshotName string `json:"snapshot_name"`
+	TimeMillis   int64  `json:"time"`
+	Details      string `json:"details"`
+}
+
+// Time returns when the snapshot was taken.
+func (i SLMInvocation) Time() time.Time {
+	return time.Unix(0, i.TimeMillis*int64(time.Millisecond)).UTC()
+}
+
+// Holds the snapshot statistics of an SLM policy.
+type SLMPolicyStats struct {
+	Policy                   string `json:"policy"`
+	SnapshotsTaken           int    `json:"snapshots_taken"`
+	SnapshotsFailed          int    `json:"snapshots_failed"`
+	SnapshotsDeleted         int    `json:"snapshots_deleted"`
+	SnapshotDeletionFailures int    `json:"snapshot_deletion_failures"`
+}
+
+// Holds an SLM policy along with its execution history.
+type SLMPolicyDetails struct {
+	Policy              SLMPolicy
+	Version             int
+	ModifiedDateMillis  int64
+	NextExecutionMillis int64
+	LastSuccess         *SLMInvocation
+	LastFailure         *SLMInvocation
+	InProgress          string
+	Stats               SLMPolicyStats
+}
+
+// Holds the cluster wide SLM statistics, based on the snapshot lifecycle
+// stats API: https://www.elastic.co/guide/en/elasticsearch/reference/current/slm-api-get-stats.html
+type SLMStats struct {
+	RetentionRuns                 int              `json:"retention_runs"`
+	RetentionFailed               int              `json:"retention_failed"`
+	RetentionTimedOut             int              `json:"retention_timed_out"`
+	RetentionDeletionTimeMillis   int64            `json:"retention_deletion_time_millis"`
+	TotalSnapshotsTaken           int              `json:"total_snapshots_taken"`
+	TotalSnapshotsFailed          int              `json:"total_snapshots_failed"`
+	TotalSnapshotsDeleted         int              `json:"total_snapshots_deleted"`
+	TotalSnapshotDeletionFailures int              `json:"total_snapshot_deletion_failures"`
+	PolicyStats                   []SLMPolicyStats `json:"policy_stats"`
+}
+
+// List the SLM policies matching the name, or all of them if empty, with
+// their last successful and failed snapshots.
+//
+// Use case: You want to check that the scheduled snapshots of the cluster are being taken.
+func (c *Client) GetSLMPolicies(name string) ([]SLMPolicyDetails, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(strings.TrimSuffix(fmt.Sprintf("_slm/policy/%s", name), "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	policies := []SLMPolicyDetails{}
+	var parseErr error
+	gjson.ParseBytes(body).ForEach(func(key, value gjson.Result) bool {
+		details := SLMPolicyDetails{
+			Version:             int(value.Get("version").Int()),
+			ModifiedDateMillis:  value.Get("modified_date_millis").Int(),
+			NextExecutionMillis: value.Get("next_execution_millis").Int(),
+			InProgress:          value.Get("in_progress.name").String(),
+		}
+
+		parseErr = json.Unmarshal([]byte(value.Get("policy").Raw), &details.Policy)
+		if parseErr == nil && value.Get("last_success").Exists() {
+			details.LastSuccess = &SLMInvocation{}
+			parseErr = json.Unmarshal([]byte(value.Get("last_success").Raw), details.LastSuccess)
+		}
+		if parseErr == nil && value.Get("last_failure").Exists() {
+			details.LastFailure = &SLMInvocation{}
+			parseErr = json.Unmarshal([]byte(value.Get("last_failure").Raw), details.LastFailure)
+		}
+		if parseErr == nil && value.Get("stats").Exists() {
+			parseErr = json.Unmarshal([]byte(value.Get("stats").Raw), &details.Stats)
+		}
+		if parseErr != nil {
+			parseErr = fmt.Errorf("failed to unmarshal SLM policy %s: %w", key.String(), parseErr)
+			return false
+		}
+
+		details.Policy.Name = key.String()
+		policies = append(policies, details)
+		return true
+	})
+
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Policy.Name < policies[j].Policy.Name
+	})
+
+	return policies, nil
+}
+
+// Create or update an SLM policy.
+//
+// Use case: You want to schedule nightly snapshots of the cluster to a repository.
+func (c *Client) PutSLMPolicy(policy SLMPolicy) error {
+	if policy.Name == "" {
+		return errors.New("Policy name is required")
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_slm/policy/%s", policy.Name)).
+		Set("Content-Type", "application/json").
+		Send(policy)
+
+	return handleAcknowledged(agent, fmt.Sprintf(`put SLM policy "%s"`, policy.Name))
+}
+
+// Delete an SLM policy. Snapshots already taken by the policy are kept.
+//
+// Use case: You no longer want scheduled snapshots to a repository.
+func (c *Client) DeleteSLMPolicy(name string) error {
+	if name == "" {
+		return errors.New("Policy name is required")
+	}
+
+	return handleAcknowledged(c.buildDeleteRequest(fmt.Sprintf("_slm/policy/%s", name)), fmt.Sprintf(`delete SLM policy "%s"`, name))
+}
+
+// Take a snapshot with an SLM policy right away, outside of its schedule.
+// Returns the name of the snapshot being taken.
+//
+// Use case: You are about to perform risky maintenance and want a fresh snapshot first.
+func (c *Client) ExecuteSLMPolicy(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("Policy name is required")
+	}
+
+	body, err := handleErrWithBytes(c.buildPostRequest(fmt.Sprintf("_slm/policy/%s/_execute", name)))
+	if err != nil {
+		return "", err
+	}
+
+	return gjson.GetBytes(body, "snapshot_name").String(), nil
+}
+
+// Get the cluster wide SLM statistics, including per policy statistics.
+//
+// Use case: You want to know how many scheduled snapshots and retention runs failed.
+func (c *Client) GetSLMStats() (SLMStats, error) {
+	var stats SLMStats
+	err := handleErrWithStruct(c.buildGetRequest("_slm/stats"), &stats)
+	if err != nil {
+		return SLMStats{}, err
+	}
+
+	return stats, nil
+}
+
+// Run the SLM retention of all policies right away, deleting expired snapshots.
+//
+// Use case: A repository is running out of space and you don't want to wait for the scheduled retention.
+func (c *Client) ExecuteSLMRetention() error {
+	return handleAcknowledged(c.buildPostRequest("_slm/_execute_retention"), "execute SLM retention")
+}
+
+// Holds the progress of a running snapshot, based on the snapshot status
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/get-snapshot-status-api.html
+type SnapshotProgress struct {
+	Repository     string
+	Snapshot       string
+	State          string
+	ShardsDone     int
+	ShardsFailed   int
+	ShardsTotal    int
+	ProcessedBytes int64
+	TotalBytes     int64
+}
+
+// Done reports whether the snapshot reached a final state. An ABORTED snapshot
+// is still running until its shards have stopped.
+func (p SnapshotProgress) Done() bool {
+	return p.State == "SUCCESS" || p.State == "FAILED" || p.State == "PARTIAL"
+}
+
+// Get the progress of a snapshot: its state, how many shards are done and how many bytes were copied.
+//
+// Use case: You want to know how far along a long running snapshot is.
+func (c *Client) GetSnapshotProgress(repository string, snapshot string) (SnapshotProgress, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("_snapshot/%s/%s/_status", repository, snapshot)))
+	if err != nil {
+		return SnapshotProgress{}, err
+	}
+
+	status := gjson.GetBytes(body, "snapshots.0")
+	if !status.Exists() {
+		return SnapshotProgress{}, fmt.Errorf(`Snapshot "%s" not found in repository "%s"`, snapshot, repository)
+	}
+
+	progress := SnapshotProgress{
+		Repository:   status.Get("repository").String(),
+		Snapshot:     status.Get("snapshot").String(),
+		State:        status.Get("state").String(),
+		ShardsDone:   int(status.Get("shards_stats.done").Int()),
+		ShardsFailed: int(status.Get("shards_stats.failed").Int()),
+		ShardsTotal:  int(status.Get("shards_stats.total").Int()),
+	}
+
+	stats := snapshotFileStatsFromJSON(status.Get("stats"))
+	progress.ProcessedBytes = stats.BytesCopied
+	progress.TotalBytes = stats.TotalBytes
+
+	return progress, nil
+}
+
+// Wait for a snapshot to complete, polling its progress at the given interval,
+// every 10 seconds if 0. The optional progress function is called with the progress of the snapshot
+// after every poll. Returns the completed snapshot, whose state is SUCCESS,
+// PARTIAL or FAILED, or an error once the timeout has passed. Waits without
+// limit if the timeout is 0.
+//
+// Use case: You want to take a snapshot before maintenance and block until it has finished.
+func (c *Client) WaitForSnapshot(repository string, snapshot string, pollInterval time.Duration, timeout time.Duration, progress func(SnapshotProgress)) (Snapshot, error) {
+	if pollInterval == 0 {
+		pollInterval = 10 * time.Second
+	}
+
+	start := time.Now()
+	for {
+		status, err := c.GetSnapshotProgress(repository, snapshot)
+		if err != nil {
+			return Snapshot{}, err
+		}
+
+		if progress != nil {
+			progress(status)
+		}
+
+		if status.Done() {
+			// The status API reports partial snapshots as SUCCESS, so get the final state from the snapshot itself.
+			return c.GetSnapshotStatus(repository, snapshot)
+		}
+
+		if timeout != 0 && time.Since(start) > timeout {
+			return Snapshot{}, fmt.Errorf(`Timed out waiting for snapshot "%s" to complete`, snapshot)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Holds the options for `WaitForRestore`.
+type RestoreWaitOptions struct {
+	// Restored indices or index patterns to watch. All recoveries from the snapshot if empty.
+	Indices []string
+
+	// When the restore was started. Recoveries started earlier, left over from
+	// a previous restore of the same snapshot, are ignored. Compared to the
+	// start time reported by the nodes, so take it before starting the restore.
+	StartedAfter time.Time
+
+	// How often to poll the recoveries. Defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// How long to wait for the restore to complete. Waits without limit if 0.
+	Timeout time.Duration
+}
+
+// Wait for the restore of a snapshot to complete, polling the shard recoveries
+// of type snapshot. The optional progress function is called with the watched
+// recoveries after every poll.
+//
+// Use case: You want to restore an index and block until it can be searched.
+func (c *Client) WaitForRestore(repository string, snapshot string, opts RestoreWaitOptions, progress func([]ShardRecovery)) error {
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+
+	start := time.Now()
+	for {
+		allRecoveries, err := c.GetShardRecovery(nil, false)
+		if err != nil {
+			return err
+		}
+
+		recoveries, done := snapshotRecoveries(allRecoveries, repository, snapshot, opts.Indices, opts.StartedAfter)
+
+		if progress != nil {
+			progress(recoveries)
+		}
+
+		if done {
+			return nil
+		}
+
+		if opts.Timeout != 0 && time.Since(start) > opts.Timeout {
+			return fmt.Errorf(`Timed out waiting for the restore of snapshot "%s" to complete`, snapshot)
+		}
+
+		time.Sleep(opts.PollInterval)
+	}
+}
+
+// Holds the rules deciding which snapshots of a repository to keep. A snapshot
+// is kept if any rule keeps it. Only successful and partial snapshots count
+// toward the rules, running ones are left alone and failed and incompatible
+// ones are kept unless DeleteFailed is set.
+type SnapshotRetentionRules struct {
+	// Keep the N most recent snapshots.
+	KeepLast int
+
+	// Keep the most recent snapshot of each day for this many days.
+	KeepDailyDays int
+
+	// Keep the most recent snapshot of each week for this many weeks.
+	KeepWeeklyWeeks int
+
+	// Keep at least this many snapshots, even if no other rule keeps them.
+	MinCount int
+
+	// Keep at most this many snapshots, deleting the oldest ones kept by other rules. Unlimited if 0.
+	MaxCount int
+
+	// Only consider snapshots whose name matches this regular expression. All snapshots if empty.
+	NamePattern string
+
+	// Delete FAILED and INCOMPATIBLE snapshots.
+	DeleteFailed bool
+}
+
+// Holds whether a snapshot is kept or deleted by the retention rules, and why.
+type SnapshotRetentionDecision struct {
+	Snapshot Snapshot
+	Delete   bool
+	Reason   string
+}
+
+// Compute which snapshots of a repository to keep and delete according to the
+// retention rules. Decisions are sorted from the most recent snapshot to the oldest.
+//
+// Use case: You want to see which snapshots a retention policy would delete before pruning a repository.
+func (c *Client) PlanSnapshotRetention(repository string, rules SnapshotRetentionRules) ([]SnapshotRetentionDecision, error) {
+	if rules.KeepLast <= 0 && rules.KeepDailyDays <= 0 && rules.KeepWeeklyWeeks <= 0 && rules.MinCount <= 0 {
+		return nil, errors.New("At least one retention rule keeping snapshots is required")
+	}
+
+	var namePattern *regexp.Regexp
+	if rules.NamePattern != "" {
+		var err error
+		namePattern, err = regexp.Compile(rules.NamePattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapshots, err := c.GetSnapshots(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return planSnapshotRetention(snapshots, rules, namePattern, time.Now()), nil
+}
+
+// Delete the given snapshots one after the other, pausing between deletions so
+// the repository is not overloaded. The optional progress function is called
+// after every deletion.
+//
+// Use case: You want to apply the plan of `PlanSnapshotRetention` to a repository.
+func (c *Client) PruneSnapshots(repository string, snapshots []Snapshot, pause time.Duration, progress func(Snapshot)) error {
+	for i, snapshot := range snapshots {
+		if i > 0 {
+			time.Sleep(pause)
+		}
+
+		err := c.DeleteSnapshot(repository, snapshot.Name)
+		if err != nil {
+			return fmt.Errorf(`Error deleting snapshot "%s": %w`, snapshot.Name, err)
+		}
+
+		if progress != nil {
+			progress(snapshot)
+		}
+	}
+
+	return nil
+}
+
+// Holds the options to list the snapshots of a repository. Sorting and paging
+// are done by Elasticsearch on 7.14 or later, and the SLM policy filter on 7.16
+// or later. They are done on the client otherwise. The state, start time and
+// index filters are always done on the client, in which case paging is done on
+// the client as well.
+type SnapshotListOptions struct {
+	// Sort by name, start_time, duration, index_count, shard_count or
+	// failed_shard_count. Defaults to start_time.
+	Sort string
+
+	// Sort in asc or desc order. Defaults to asc.
+	Order string
+
+	// The maximum number of snapshots to return. All snapshots if 0.
+	Size int
+
+	// The cursor returned as `Next` by the previous page.
+	After string
+
+	// Only list snapshots taken by this SLM policy.
+	SLMPolicy string
+
+	// Only return the names, indices, data streams and state of snapshots,
+	// which is much faster on large repositories. Requires Elasticsearch 7.14 or later.
+	Brief bool
+
+	// Only list snapshots in this state, i.e. SUCCESS.
+	State string
+
+	// Only list snapshots started after this time.
+	Since time.Time
+
+	// Only list snapshots containing an index matching this name or pattern.
+	Index string
+}
+
+// Holds a page of snapshots.
+type SnapshotPage struct {
+	Snapshots []Snapshot
+
+	// The cursor to pass as `After` to get the next page. Empty on the last page.
+	Next string
+
+	// The number of snapshots matching the options, and how many are left after this page.
+	Total     int
+	Remaining int
+}
+
+// List the snapshots of a repository with filtering, sorting and paging.
+//
+// Use case: You want the most recent snapshots of a repository holding thousands of them, without fetching them all.
+func (c *Client) ListSnapshots(repository string, opts SnapshotListOptions) (SnapshotPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "start_time"
+	}
+
+	if opts.Order == "" {
+		opts.Order = "asc"
+	}
+
+	version, err := c.GetClusterVersion()
+	if err != nil {
+		return SnapshotPage{}, err
+	}
+
+	if !versionAtLeast(version, 7, 14) {
+		snapshots, err := c.GetSnapshots(repository)
+		if err != nil {
+			return SnapshotPage{}, err
+		}
+
+		return pageSnapshots(filterSnapshots(snapshots, opts, true), opts, true)
+	}
+
+	// The SLM policy filter was only added in Elasticsearch 7.16.
+	serverPolicyFilter := versionAtLeast(version, 7, 16)
+	clientPaging := opts.State != "" || !opts.Since.IsZero() || opts.Index != "" || (opts.SLMPolicy != "" && !serverPolicyFilter)
+
+	queryStrings := []string{
+		fmt.Sprintf("sort=%s", opts.Sort),
+		fmt.Sprintf("order=%s", opts.Order),
+	}
+
+	if opts.SLMPolicy != "" && serverPolicyFilter {
+		queryStrings = append(queryStrings, fmt.Sprintf("slm_policy_filter=%s", url.QueryEscape(opts.SLMPolicy)))
+	}
+
+	if opts.Brief {
+		queryStrings = append(queryStrings, "verbose=false")
+	}
+
+	if !clientPaging && opts.Size > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("size=%d", opts.Size))
+	}
+
+	if !clientPaging && opts.After != "" {
+		queryStrings = append(queryStrings, fmt.Sprintf("after=%s", url.QueryEscape(opts.After)))
+	}
+
+	var response struct {
+		Snapshots []Snapshot `json:"snapshots"`
+		Next      string     `json:"next"`
+		Total     int        `json:"total"`
+		Remaining int        `json:"remaining"`
+	}
+
+	err = handleErrWithStruct(c.buildGetRequest(fmt.Sprintf("_snapshot/%s/_all?%s", repository, strings.Join(queryStrings, "&"))), &response)
+	if err != nil {
+		return SnapshotPage{}, err
+	}
+
+	if clientPaging {
+		return pageSnapshots(filterSnapshots(response.Snapshots, opts, !serverPolicyFilter), opts, false)
+	}
+
+	return SnapshotPage{
+		Snapshots: response.Snapshots,
+		Next:      response.Next,
+		Total:     response.Total,
+		Remaining: response.Remaining,
+	}, nil
+}
+
+var ErrSnapshotCloneUnsupported = errors.New("Cloning snapshots requires Elasticsearch 7.10 or later")
+
+// Clone the given indices of a snapshot into a new snapshot in the same
+// repository. The clone shares the files of the source snapshot, so it is
+// cheap and fast.
+//
+// Use case: You want to hand a single index of a large snapshot to another team.
+func (c *Client) CloneSnapshot(repository string, source string, target string, indices []string) error {
+	if repository == "" {
+		return errors.New("Empty string for repository is not allowed")
+	}
+
+	if source == "" || target == "" {
+		return errors.New("Empty string for source or target snapshot is not allowed")
+	}
+
+	if len(indices) == 0 {
+		return errors.New("No indices provided to clone")
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 10)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrSnapshotCloneUnsupported
+	}
+
+	agent := c.buildPutRequest(fmt.Sprintf("_snapshot/%s/%s/_clone/%s", repository, source, target)).
+		Set("Content-Type", "application/json").
+		Send(fmt.Sprintf(`{"indices":"%s"}`, strings.Join(indices, ",")))
+
+	return handleAcknowledged(agent, fmt.Sprintf(`clone snapshot "%s" to "%s"`, source, target))
+}
+
+// Holds the options of the `CopySnapshot` workflow.
+type SnapshotCopyOptions struct {
+	SourceRepository string
+	SourceSnapshot   string
+	TargetRepository string
+	TargetSnapshot   string
+
+	// Indices or index patterns of the source snapshot to copy. All indices if empty.
+	Indices []string
+
+	// Delete the restored indices from the scratch cluster once the copy is verified.
+	DeleteRestored bool
+
+	// How often to poll the restore and the snapshot. Defaults to 10 seconds.
+	PollInterval time.Duration
+}
+
+// Holds the outcome of the `CopySnapshot` workflow.
+type SnapshotCopyResult struct {
+	Indices []string
+
+	// The number of shards of the copied indices in the source snapshot.
+	PrimaryShards  int
+	TargetSnapshot Snapshot
+}
+
+// Copy indices of a snapshot into a snapshot of another repository by
+// restoring them into a separate scratch cluster and taking a new snapshot of
+// them there. The source snapshot is read through this client, while the
+// restore and the new snapshot run on the scratch cluster, which must have
+// both repositories registered. The indices are restored under their own names
+// so must not exist on the scratch cluster. The copy fails unless every shard
+// of every copied index in the source snapshot is in the new snapshot.
+//
+// Use case: You want to move a few indices of a snapshot to a repository owned by another team.
+func (c *Client) CopySnapshot(scratch *Client, opts SnapshotCopyOptions) (SnapshotCopyResult, error) {
+	if opts.SourceRepository == "" || opts.SourceSnapshot == "" || opts.TargetRepository == "" || opts.TargetSnapshot == "" {
+		return SnapshotCopyResult{}, errors.New("Source and target repositories and snapshots are required")
+	}
+
+	if scratch == nil || (scratch.Host == c.Host && scratch.Port == c.Port && scratch.Path == c.Path) {
+		return SnapshotCopyResult{}, errors.New("A scratch cluster other than the source cluster is required to restore the indices")
+	}
+
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+
+	source, err := c.GetSnapshotDetailedStatus(opts.SourceRepository, opts.SourceSnapshot)
+	if err != nil {
+		return SnapshotCopyResult{}, err
+	}
+
+	result := SnapshotCopyResult{}
+	expected := map[string]int{}
+	for _, index := range source.Indices {
+		matches := len(opts.Indices) == 0
+		for _, pattern := range opts.Indices {
+			if matchesIndexPattern(pattern, index.Name) {
+				matches = true
+				break
+			}
+		}
+
+		if matches {
+			result.Indices = append(result.Indices, index.Name)
+			result.PrimaryShards += index.ShardsTotal
+			expected[index.Name] = index.ShardsTotal
+		}
+	}
+
+	if len(result.Indices) == 0 {
+		return result, fmt.Errorf(`No indices of snapshot "%s" match %v`, opts.SourceSnapshot, opts.Indices)
+	}
+
+	restoreStart := time.Now()
+	err = scratch.RestoreSnapshot(opts.SourceRepository, opts.SourceSnapshot, RestoreOptions{Indices: result.Indices})
+	if err != nil {
+		return result, err
+	}
+
+	err = scratch.WaitForRestore(opts.SourceRepository, opts.SourceSnapshot, RestoreWaitOptions{Indices: result.Indices, StartedAfter: restoreStart, PollInterval: opts.PollInterval}, nil)
+	if err != nil {
+		return result, err
+	}
+
+	err = scratch.SnapshotIndices(opts.TargetRepository, opts.TargetSnapshot, result.Indices)
+	if err != nil {
+		return result, err
+	}
+
+	result.TargetSnapshot, err = scratch.WaitForSnapshot(opts.TargetRepository, opts.TargetSnapshot, opts.PollInterval, 0, nil)
+	if err != nil {
+		return result, err
+	}
+
+	if result.TargetSnapshot.State != "SUCCESS" {
+		return result, fmt.Errorf(`Snapshot "%s" completed with state %s`, opts.TargetSnapshot, result.TargetSnapshot.State)
+	}
+
+	target, err := scratch.GetSnapshotDetailedStatus(opts.TargetRepository, opts.TargetSnapshot)
+	if err != nil {
+		return result, err
+	}
+
+	mismatches := snapshotCopyMismatches(expected, target)
+	if len(mismatches) > 0 {
+		return result, fmt.Errorf(`Snapshot "%s" does not match snapshot "%s": %s`, opts.TargetSnapshot, opts.SourceSnapshot, strings.Join(mismatches, ", "))
+	}
+
+	if opts.DeleteRestored {
+		for _, index := range result.Indices {
+			err = scratch.DeleteIndex(index)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+var (
+	ErrRepositoryCleanupUnsupported  = errors.New("Cleaning up repositories requires Elasticsearch 7.4 or later")
+	ErrRepositoryAnalysisUnsupported = errors.New("Analyzing repositories requires Elasticsearch 7.12 or later")
+)
+
+// Holds what was removed by a repository cleanup, based on the cleanup repository
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/clean-up-snapshot-repo-api.html
+type RepositoryCleanupResult struct {
+	DeletedBytes int64 `json:"deleted_bytes"`
+	DeletedBlobs int   `json:"deleted_blobs"`
+}
+
+// Remove the data of a repository no longer referenced by any snapshot, left
+// behind by failed or aborted snapshots and deletions.
+//
+// Use case: A repository uses more storage than its snapshots should and you want to reclaim the difference.
+func (c *Client) CleanupRepository(repository string) (RepositoryCleanupResult, error) {
+	if repository == "" {
+		return RepositoryCleanupResult{}, ErrRepositoryNameRequired
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 4)
+	if err != nil {
+		return RepositoryCleanupResult{}, err
+	}
+
+	if !supported {
+		return RepositoryCleanupResult{}, ErrRepositoryCleanupUnsupported
+	}
+
+	var response struct {
+		Results RepositoryCleanupResult `json:"results"`
+	}
+
+	err = handleErrWithStruct(c.buildPostRequest(fmt.Sprintf("_snapshot/%s/_cleanup", repository)).Timeout(10*time.Minute), &response)
+	if err != nil {
+		return RepositoryCleanupResult{}, err
+	}
+
+	return response.Results, nil
+}
+
+// Holds the options of a repository analysis. Elasticsearch defaults are used for unset options.
+type RepositoryAnalysisOptions struct {
+	// The number of blobs to write, i.e. 2000 for a thorough analysis.
+	BlobCount int
+
+	// The maximum size of a blob and of all blobs together, i.e. "2gb" and "1tb".
+	MaxBlobSize      string
+	MaxTotalDataSize string
+
+	// The number of write operations to run concurrently, and of nodes reading each blob.
+	Concurrency   int
+	ReadNodeCount int
+
+	// How long to wait for the analysis to complete, i.e. "1h".
+	Timeout string
+}
+
+// Holds the outcome of a repository analysis, based on the repository analysis
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/repo-analysis-api.html
+type RepositoryAnalysis struct {
+	Repository            string
+	CoordinatingNode      string
+	BlobCount             int
+	Concurrency           int
+	ReadNodeCount         int
+	MaxBlobSizeBytes      int64
+	MaxTotalDataSizeBytes int64
+	IssuesDetected        []string
+
+	WriteCount     int
+	WriteBytes     int64
+	WriteElapsed   time.Duration
+	WriteThrottled time.Duration
+
+	ReadCount     int
+	ReadBytes     int64
+	ReadElapsed   time.Duration
+	ReadWait      time.Duration
+	ReadMaxWait   time.Duration
+	ReadThrottled time.Duration
+
+	ListingElapsed time.Duration
+	DeleteElapsed  time.Duration
+}
+
+// WriteThroughput returns the bytes written per second, across concurrent writes.
+func (a RepositoryAnalysis) WriteThroughput() float64 {
+	if a.WriteElapsed <= 0 {
+		return 0
+	}
+	return float64(a.WriteBytes) / a.WriteElapsed.Seconds()
+}
+
+// ReadThroughput returns the bytes read per second, across concurrent reads.
+func (a RepositoryAnalysis) ReadThroughput() float64 {
+	if a.ReadElapsed <= 0 {
+		return 0
+	}
+	return float64(a.ReadBytes) / a.ReadElapsed.Seconds()
+}
+
+// Analyze a repository by writing, reading, listing and deleting blobs from
+// every node, checking the storage behaves correctly and measuring its
+// performance. Elasticsearch returns an error if the storage misbehaves.
+//
+// Use case: You set up a new repository and want to check the storage can sustain snapshots and restores.
+func (c *Client) AnalyzeRepository(repository string, opts RepositoryAnalysisOptions) (RepositoryAnalysis, error) {
+	if repository == "" {
+		return RepositoryAnalysis{}, ErrRepositoryNameRequired
+	}
+
+	supported, err := c.clusterVersionAtLeast(7, 12)
+	if err != nil {
+		return RepositoryAnalysis{}, err
+	}
+
+	if !supported {
+		return RepositoryAnalysis{}, ErrRepositoryAnalysisUnsupported
+	}
+
+	queryStrings := []string{}
+	if opts.BlobCount > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("blob_count=%d", opts.BlobCount))
+	}
+	if opts.MaxBlobSize != "" {
+		queryStrings = append(queryStrings, fmt.Sprintf("max_blob_size=%s", opts.MaxBlobSize))
+	}
+	if opts.MaxTotalDataSize != "" {
+		queryStrings = append(queryStrings, fmt.Sprintf("max_total_data_size=%s", opts.MaxTotalDataSize))
+	}
+	if opts.Concurrency > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("concurrency=%d", opts.Concurrency))
+	}
+	if opts.ReadNodeCount > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("read_node_count=%d", opts.ReadNodeCount))
+	}
+	if opts.Timeout != "" {
+		queryStrings = append(queryStrings, fmt.Sprintf("timeout=%s", opts.Timeout))
+	}
+
+	path := fmt.Sprintf("_snapshot/%s/_analyze", repository)
+	if len(queryStrings) > 0 {
+		path = fmt.Sprintf("%s?%s", path, strings.Join(queryStrings, "&"))
+	}
+
+	body, err := handleErrWithBytes(c.buildPostRequest(path).Timeout(time.Hour))
+	if err != nil {
+		return RepositoryAnalysis{}, err
+	}
+
+	response := gjson.ParseBytes(body)
+	nanos := func(path string) time.Duration {
+		return time.Duration(response.Get(path).Int())
+	}
+
+	analysis := RepositoryAnalysis{
+		Repository:            response.Get("repository").String(),
+		CoordinatingNode:      response.Get("coordinating_node.name").String(),
+		BlobCount:             int(response.Get("blob_count").Int()),
+		Concurrency:           int(response.Get("concurrency").Int()),
+		ReadNodeCount:         int(response.Get("read_node_count").Int()),
+		MaxBlobSizeBytes:      response.Get("max_blob_size_bytes").Int(),
+		MaxTotalDataSizeBytes: response.Get("max_total_data_size_bytes").Int(),
+		IssuesDetected:        []string{},
+		WriteCount:            int(response.Get("summary.write.count").Int()),
+		WriteBytes:            response.Get("summary.write.total_size_bytes").Int(),
+		WriteElapsed:          nanos("summary.write.total_elapsed_nanos"),
+		WriteThrottled:        nanos("summary.write.total_throttled_nanos"),
+		ReadCount:             int(response.Get("summary.read.count").Int()),
+		ReadBytes:             response.Get("summary.read.total_size_bytes").Int(),
+		ReadElapsed:           nanos("summary.read.total_elapsed_nanos"),
+		ReadWait:              nanos("summary.read.total_wait_nanos"),
+		ReadMaxWait:           nanos("summary.read.max_wait_nanos"),
+		ReadThrottled:         nanos("summary.read.total_throttled_nanos"),
+		ListingElapsed:        nanos("listing_elapsed_nanos"),
+		DeleteElapsed:         nanos("delete_elapsed_nanos"),
+	}
+
+	for _, issue := range response.Get("issues_detected").Array() {
+		analysis.IssuesDetected = append(analysis.IssuesDetected, issue.String())
+	}
+
+	return analysis, nil
+}
+
+// Holds the file statistics of a snapshot, index or shard. Only files changed
+// since the previous snapshot need to be copied to the repository.
+type SnapshotFileStats struct {
+	FilesToCopy int
+	FilesCopied int
+	BytesToCopy int64
+	BytesCopied int64
+	TotalBytes  int64
+	StartTime   time.Time
+	Elapsed     time.Duration
+}
+
+// Holds the status of a shard in a snapshot.
+type SnapshotShardStatus struct {
+	Index  string
+	Shard  int
+	Stage  string
+	NodeID string
+	Reason string
+	Stats  SnapshotFileStats
+}
+
+// Holds the status of an index in a snapshot and of its shards.
+type SnapshotIndexStatus struct {
+	Name         string
+	ShardsDone   int
+	ShardsFailed int
+	ShardsTotal  int
+	Stats        SnapshotFileStats
+	Shards       []SnapshotShardStatus
+}
+
+// Holds the detailed status of a snapshot, based on the snapshot status
+// API: https://www.elastic.co/guide/en/elasticsearch/reference/current/get-snapshot-status-api.html
+type SnapshotDetailedStatus struct {
+	SnapshotProgress
+	Stats   SnapshotFileStats
+	Indices []SnapshotIndexStatus
+}
+
+// Get the detailed status of a snapshot, with the stage, files and bytes
+// copied of every index and shard.
+//
+// Use case: A snapshot is taking much longer than usual and you want to find the shards holding it up.
+func (c *Client) GetSnapshotDetailedStatus(repository string, snapshot string) (SnapshotDetailedStatus, error) {
+	body, err := handleErrWithBytes(c.buildGetRequest(fmt.Sprintf("_snapshot/%s/%s/_status", repository, snapshot)))
+	if err != nil {
+		return SnapshotDetailedStatus{}, err
+	}
+
+	status := gjson.GetBytes(body, "snapshots.0")
+	if !status.Exists() {
+		return SnapshotDetailedStatus{}, fmt.Errorf(`Snapshot "%s" not found in repository "%s"`, snapshot, repository)
+	}
+
+	detailed := SnapshotDetailedStatus{
+		SnapshotProgress: SnapshotProgress{
+			Repository:   status.Get("repository").String(),
+			Snapshot:     status.Get("snapshot").String(),
+			State:        status.Get("state").String(),
+			ShardsDone:   int(status.Get("shards_stats.done").Int()),
+			ShardsFailed: int(status.Get("shards_stats.failed").Int()),
+			ShardsTotal:  int(status.Get("shards_stats.total").Int()),
+		},
+		Stats:   snapshotFileStatsFromJSON(status.Get("stats")),
+		Indices: []SnapshotIndexStatus{},
+	}
+	detailed.ProcessedBytes = detailed.Stats.BytesCopied
+	detailed.TotalBytes = detailed.Stats.TotalBytes
+
+	status.Get("indices").ForEach(func(name, index gjson.Result) bool {
+		indexStatus := SnapshotIndexStatus{
+			Name:         name.String(),
+			ShardsDone:   int(index.Get("shards_stats.done").Int()),
+			ShardsFailed: int(index.Get("shards_stats.failed").Int()),
+			ShardsTotal:  int(index.Get("shards_stats.total").Int()),
+			Stats:        snapshotFileStatsFromJSON(index.Get("stats")),
+			Shards:       []SnapshotShardStatus{},
+		}
+
+		index.Get("shards").ForEach(func(id, shard gjson.Result) bool {
+			shardID, _ := strconv.Atoi(id.String())
+			indexStatus.Shards = append(indexStatus.Shards, SnapshotShardStatus{
+				Index:  name.String(),
+				Shard:  shardID,
+				Stage:  shard.Get("stage").String(),
+				NodeID: shard.Get("node").String(),
+				Reason: shard.Get("reason").String(),
+				Stats:  snapshotFileStatsFromJSON(shard.Get("stats")),
+			})
+			return true
+		})
+
+		sort.Slice(indexStatus.Shards, func(i, j int) bool {
+			return indexStatus.Shards[i].Shard < indexStatus.Shards[j].Shard
+		})
+
+		detailed.Indices = append(detailed.Indices, indexStatus)
+		return true
+	})
+
+	sort.Slice(detailed.Indices, func(i, j int) bool {
+		return detailed.Indices[i].Name < detailed.Indices[j].Name
+	})
+
+	return detailed, nil
+}
+
+// Holds a shard failure of a snapshot correlated with the current state of
+// the cluster, and whether retrying the snapshot is likely to succeed.
+type SnapshotFailureDiagnosis struct {
+	Index        string
+	Shard        int
+	NodeID       string
+	Reason       string
+	Status       string
+	NodeName     string
+	NodePresent  bool
+	IndexExists  bool
+	PrimaryState string
+	Retry        bool
+	Suggestion   string
+}
+
+// Holds the diagnosis of the shard failures of a snapshot.
+type SnapshotDiagnosis struct {
+	Snapshot      Snapshot
+	ClusterStatus string
+	Failures      []SnapshotFailureDiagnosis
+}
+
+// Correlate every shard failure of a snapshot with the nodes, shards and
+// health of the cluster to tell whether to retry the snapshot or to
+// investigate the storage of the repository.
+//
+// Use case: A snapshot ended PARTIAL or FAILED and you want to know whether it is safe to just retry it.
+func (c *Client) DiagnoseSnapshot(repository string, snapshot string) (SnapshotDiagnosis, error) {
+	snap, err := c.GetSnapshotStatus(repository, snapshot)
+	if err != nil {
+		return SnapshotDiagnosis{}, err
+	}
+
+	// Snapshot failures hold full node IDs, which _cat/nodes abbreviates by default.
+	var nodes []Node
+	err = handleErrWithStruct(c.buildGetRequest("_cat/nodes?h=name,id&full_id=true"), &nodes)
+	if err != nil {
+		return SnapshotDiagnosis{}, err
+	}
+
+	shards, err := c.GetShards(nil)
+	if err != nil {
+		return SnapshotDiagnosis{}, err
+	}
+
+	health, err := c.GetHealth()
+	if err != nil {
+		return SnapshotDiagnosis{}, err
+	}
+
+	return SnapshotDiagnosis{
+		Snapshot:      snap,
+		ClusterStatus: health.Status,
+		Failures:      diagnoseSnapshotFailures(snap, nodes, shards),
+	}, nil
+}
+
+// Holds the options of `SwapAlias`.
+type SwapAliasOptions struct {
+	// Maximum relative difference between the document count of the new index
+	// and the total document count of the indices currently holding the
+	// alias, i.e. 0.05 for 5%. The check is skipped if 0. If the indices
+	// holding the alias have no documents, the new index must have none either.
+	MaxDocCountDifference float64
+
+	// Make the new index the write index of the alias.
+	WriteIndex bool
+
+	// Delete the indices currently holding the alias, in the same atomic
+	// request, instead of removing the alias from them.
+	RemoveOldIndices bool
+
+	// Only compute the actions, without modifying any alias.
+	DryRun bool
+}
+
+// Holds the outcome of `SwapAlias`.
+type SwapAliasResult struct {
+	PreviousIndices []string
+	PreviousDocs    int
+	NewDocs         int
+	Actions         []AliasAction
+}
+
+// Point an alias at a new index, removing it from every index currently
+// holding it, in a single atomic aliases request.
+//
+// Use case: You reindexed into a new index and want to cut searches over to it without downtime.
+func (c *Client) SwapAlias(alias string, toIndex string, opts SwapAliasOptions) (SwapAliasResult, error) {
+	if alias == "" || toIndex == "" {
+		return SwapAliasResult{}, errors.New("Alias and index are required")
+	}
+
+	aliases, err := c.GetAliases(alias)
+	if err != nil {
+		return SwapAliasResult{}, err
+	}
+
+	result := SwapAliasResult{PreviousIndices: []string{}}
+	for _, a := range aliases {
+		if a.Name == alias && a.IndexName != toIndex {
+			result.PreviousIndices = append(result.PreviousIndices, a.IndexName)
+		}
+	}
+	sort.Strings(result.PreviousIndices)
+
+	newIndices, err := c.GetIndices(toIndex)
+	if err != nil {
+		return result, err
+	}
+
+	if len(newIndices) != 1 || newIndices[0].Name != toIndex {
+		return result, fmt.Errorf(`Index "%s" not found`, toIndex)
+	}
+	result.NewDocs = newIndices[0].DocumentCount
+
+	if len(result.PreviousIndices) > 0 {
+		previousIndices, err := c.GetIndices(strings.Join(result.PreviousIndices, ","))
+		if err != nil {
+			return result, err
+		}
+
+		for _, index := range previousIndices {
+			result.PreviousDocs += index.DocumentCount
+		}
+
+		if opts.MaxDocCountDifference > 0 && result.PreviousDocs == 0 && result.NewDocs > 0 {
+			return result, fmt.Errorf(`Index "%s" has %d documents but %s have none to compare them to`, toIndex, result.NewDocs, strings.Join(result.PreviousIndices, ", "))
+		}
+
+		if opts.MaxDocCountDifference > 0 && result.PreviousDocs > 0 {
+			difference := math.Abs(float64(result.NewDocs-result.PreviousDocs)) / float64(result.PreviousDocs)
+			if difference > opts.MaxDocCountDifference {
+				return result, fmt.Errorf(`Index "%s" has %d documents, %.1f%% away from the %d documents of %s, more than the allowed %.1f%%`, toIndex, result.NewDocs, difference*100, result.PreviousDocs, strings.Join(result.PreviousIndices, ", "), opts.MaxDocCountDifference*100)
+			}
+		}
+	}
+
+	// Elasticsearch deletes the remove_index targets before the other actions,
+	// so removing the alias from an index being deleted would fail the request.
+	if !opts.RemoveOldIndices {
+		for _, index := range result.PreviousIndices {
+			result.Actions = append(result.Actions, AliasAction{ActionType: RemoveAlias, IndexName: index, AliasName: alias})
+		}
+	}
+
+	add := AliasAction{ActionType: AddAlias, IndexName: toIndex, AliasName: alias}
+	if opts.WriteIndex {
+		isWriteIndex := true
+		add.IsWriteIndex = &isWriteIndex
+	}
+	result.Actions = append(result.Actions, add)
+
+	if opts.RemoveOldIndices {
+		for _, index := range result.PreviousIndices {
+			result.Actions = append(result.Actions, AliasAction{ActionType: RemoveIndex, IndexName: index})
+		}
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	return result, c.ModifyAliases(result.Actions)
+}
+
+// Compute the alias actions turning the aliases of the cluster into the
+// desired mapping of alias names to the indices they should point at. Only
+// the aliases present in the mapping are managed, others are left alone, and
+// an alias mapped to no index is removed everywhere. Apply the actions
+// atomically with `ModifyAliases`.
+//
+// Use case: You keep the alias layout of the cluster in version control and want to apply it.
+func (c *Client) PlanAliasChanges(desired map[string][]string) ([]AliasAction, error) {
+	aliases, err := c.GetAllAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	return diffAliases(aliases, desired), nil
 }
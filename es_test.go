@@ -31,13 +31,14 @@ func buildTestServer(t *testing.T, setups []*ServerSetup, tls bool) *httptest.Se
 		requestBody := string(requestBytes)
 
 		matched := false
+		// Bodies of the setups for the same method and path, to report a mismatch if none matches.
+		pathBodies := []string{}
 		for _, setup := range setups {
 			if setup.extraChecksFn != nil {
 				setup.extraChecksFn(t, r)
 			}
-			// Extra piece of debug incase there's a typo in your test's response, like a rogue space somewhere
 			if r.Method == setup.Method && r.URL.EscapedPath() == setup.Path && requestBody != setup.Body {
-				t.Fatalf("request body not matching: %s != %s", requestBody, setup.Body)
+				pathBodies = append(pathBodies, setup.Body)
 			}
 
 			if setup.QueryParams != nil {
@@ -62,6 +63,11 @@ func buildTestServer(t *testing.T, setups []*ServerSetup, tls bool) *httptest.Se
 			}
 		}
 
+		// Extra piece of debug incase there's a typo in your test's response, like a rogue space somewhere
+		if !matched && len(pathBodies) > 0 {
+			t.Fatalf("request body not matching: %s != %s", requestBody, strings.Join(pathBodies, " or "))
+		}
+
 		if !matched {
 			t.Fatalf("No requests matched setup. Got method %s, Path %s, body %s", r.Method, r.URL.EscapedPath(), requestBody)
 		}
@@ -440,6 +446,36 @@ func TestGetAllAliases(t *testing.T) {
 	}
 }
 
+func TestPlanAliasChanges(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/aliases",
+		Response: `[{"alias": "logs","index": "logs-1","filter": "-","routing.index": "-","routing.search": "-"},{"alias": "other","index": "other_v1","filter": "-","routing.index": "-","routing.search": "-"}]`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	actions, err := client.PlanAliasChanges(map[string][]string{"logs": {"logs-2"}})
+
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 actions, got %+v", actions)
+	}
+
+	if actions[0].ActionType != RemoveAlias || actions[0].IndexName != "logs-1" || actions[0].AliasName != "logs" {
+		t.Errorf("Unexpected first action, got %+v", actions[0])
+	}
+
+	if actions[1].ActionType != AddAlias || actions[1].IndexName != "logs-2" || actions[1].AliasName != "logs" {
+		t.Errorf("Unexpected second action, got %+v", actions[1])
+	}
+}
+
 func TestGetAliases(t *testing.T) {
 	testSetup := &ServerSetup{
 		Method:   "GET",
@@ -471,6 +507,7 @@ func TestGetAliases(t *testing.T) {
 }
 
 func TestModifyAliases(t *testing.T) {
+	enabled, disabled := true, false
 	tt := []struct {
 		Name     string
 		Actions  []AliasAction
@@ -518,6 +555,40 @@ func TestModifyAliases(t *testing.T) {
 			Body:     `{"actions":[{"remove":{"alias":"test_alias","index":"test"}}]}`,
 			Response: `{"acknowledged": true}`,
 		},
+		{
+			Name: "add filtered write alias",
+			Actions: []AliasAction{
+				{
+					ActionType:    AddAlias,
+					IndexName:     "test",
+					AliasName:     "test_alias",
+					Filter:        map[string]interface{}{"term": map[string]interface{}{"user": "octocat"}},
+					IndexRouting:  "1",
+					SearchRouting: "1,2",
+					IsWriteIndex:  &enabled,
+					IsHidden:      &disabled,
+				},
+			},
+			Body:     `{"actions":[{"add":{"alias":"test_alias","filter":{"term":{"user":"octocat"}},"index":"test","index_routing":"1","is_hidden":false,"is_write_index":true,"search_routing":"1,2"}}]}`,
+			Response: `{"acknowledged": true}`,
+		},
+		{
+			Name: "remove alias that must exist and remove index",
+			Actions: []AliasAction{
+				{
+					ActionType: RemoveAlias,
+					IndexName:  "test",
+					AliasName:  "test_alias",
+					MustExist:  &enabled,
+				},
+				{
+					ActionType: RemoveIndex,
+					IndexName:  "test",
+				},
+			},
+			Body:     `{"actions":[{"remove":{"alias":"test_alias","index":"test","must_exist":true}},{"remove_index":{"index":"test"}}]}`,
+			Response: `{"acknowledged": true}`,
+		},
 	}
 
 	for _, x := range tt {
@@ -1528,6 +1599,63 @@ func TestRestoreSnapshotIndicesWithSettings(t *testing.T) {
 	}
 }
 
+func TestRestoreSnapshot(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_snapshot/backup-repo/snapshot1/_restore",
+		Body:     `{"feature_states":["security"],"ignore_index_settings":["index.refresh_interval"],"include_aliases":false,"include_global_state":true,"indices":"logs-web,index1","partial":true,"rename_pattern":"logs-(.+)","rename_replacement":"restored-logs-$1"}`,
+		Response: `{"accepted": true }`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	includeAliases := false
+	err := client.RestoreSnapshot("backup-repo", "snapshot1", RestoreOptions{
+		Indices:             []string{"logs-web", "index1"},
+		RenamePattern:       "logs-(.+)",
+		RenameReplacement:   "restored-logs-$1",
+		IgnoreIndexSettings: []string{"index.refresh_interval"},
+		IncludeGlobalState:  true,
+		IncludeAliases:      &includeAliases,
+		Partial:             true,
+		FeatureStates:       []string{"security"},
+	})
+
+	if err != nil {
+		t.Fatalf("Got error restoring snapshot: %s", err)
+	}
+}
+
+func TestRestoreSnapshotInPlace(t *testing.T) {
+	indicesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/index1",
+		Response: `[{"health":"green","status":"open","index":"index1","pri":"1","rep":"1","store.size":"1kb","docs.count":"10"}]`,
+	}
+	closeSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/index1/_close",
+		Response: `{"acknowledged": true}`,
+	}
+	restoreSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_snapshot/backup-repo/snapshot1/_restore",
+		Body:     `{"indices":"index1"}`,
+		Response: `{"accepted": true }`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{indicesSetup, closeSetup, restoreSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.RestoreSnapshotInPlace("backup-repo", "snapshot1", "index1", RestoreOptions{RenamePattern: "(.+)", RenameReplacement: "restored_$1"})
+	if err != nil {
+		t.Fatalf("Got error restoring snapshot in place: %s", err)
+	}
+}
+
 func TestAnalyzeText(t *testing.T) {
 	testSetup := &ServerSetup{
 		Method:   "POST",
@@ -2278,6 +2406,88 @@ func TestClusterAllocationExplain(t *testing.T) {
 	}
 }
 
+func TestGetAllocationExplanation(t *testing.T) {
+	shardID := 0
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/allocation/explain",
+		Body:     `{"index":"test-index","primary":true,"shard":0}`,
+		Response: `{"index":"test-index","shard":0,"primary":true,"current_state":"unassigned","unassigned_info":{"reason":"NODE_LEFT","at":"2021-03-01T10:00:00.000Z","details":"node_left [abc]","last_allocation_status":"no_valid_shard_copy"},"can_allocate":"no_valid_shard_copy","allocate_explanation":"cannot allocate because a previous copy of the primary shard existed but can no longer be found","node_allocation_decisions":[{"node_id":"abc","node_name":"node-1","transport_address":"10.0.0.1:9300","node_attributes":{"zone":"a"},"node_decision":"no","store":{"found":false},"deciders":[{"decider":"same_shard","decision":"NO","explanation":"a copy of this shard is already allocated to this node"}]}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	explanation, err := client.GetAllocationExplanation(&ClusterAllocationExplainRequest{Index: "test-index", Shard: &shardID, Primary: true})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if explanation.Index != "test-index" || explanation.Shard != 0 || !explanation.Primary || explanation.CurrentState != "unassigned" {
+		t.Errorf("Unexpected shard, got %+v", explanation)
+	}
+
+	if explanation.UnassignedInfo == nil || explanation.UnassignedInfo.Reason != "NODE_LEFT" || explanation.UnassignedInfo.Details != "node_left [abc]" {
+		t.Errorf("Unexpected unassigned info, got %+v", explanation.UnassignedInfo)
+	}
+
+	if explanation.CanAllocate != "no_valid_shard_copy" || explanation.CurrentNode != nil {
+		t.Errorf("Unexpected allocation decision, got %+v", explanation)
+	}
+
+	if len(explanation.NodeAllocationDecisions) != 1 {
+		t.Fatalf("Expected 1 node decision, got %+v", explanation.NodeAllocationDecisions)
+	}
+
+	decision := explanation.NodeAllocationDecisions[0]
+	if decision.NodeName != "node-1" || decision.NodeDecision != "no" || decision.NodeAttributes["zone"] != "a" || decision.Store == nil || decision.Store.Found {
+		t.Errorf("Unexpected node decision, got %+v", decision)
+	}
+
+	if len(decision.Deciders) != 1 || decision.Deciders[0].Decider != "same_shard" || decision.Deciders[0].Decision != "NO" {
+		t.Errorf("Unexpected deciders, got %+v", decision.Deciders)
+	}
+}
+
+func TestExplainUnassignedShards(t *testing.T) {
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"test_index","shard":"0","prirep":"p","state":"STARTED","docs":"0","store":"162b","ip":"10.0.0.1","node":"node-1","unassigned.reason":null},{"index":"test_index","shard":"0","prirep":"r","state":"UNASSIGNED","docs":null,"store":null,"ip":null,"node":null,"unassigned.reason":"ALLOCATION_FAILED"}]`,
+	}
+
+	explainSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/allocation/explain",
+		Body:     `{"index":"test_index","shard":0}`,
+		Response: `{"index":"test_index","shard":0,"primary":false,"current_state":"unassigned","unassigned_info":{"reason":"ALLOCATION_FAILED","failed_allocation_attempts":5},"can_allocate":"no","node_allocation_decisions":[{"node_name":"node-1","node_decision":"no","deciders":[{"decider":"max_retry","decision":"NO","explanation":"shard has exceeded the maximum number of retries"},{"decider":"same_shard","decision":"NO","explanation":"a copy of this shard is already allocated to this node"}]}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{shardsSetup, explainSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	groups, err := client.ExplainUnassignedShards()
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if len(groups) != 1 || len(groups[0].Shards) != 1 {
+		t.Fatalf("Expected one group with one shard, got %+v", groups)
+	}
+
+	group := groups[0]
+	if group.CanAllocate != "no" || strings.Join(group.Deciders, ",") != "max_retry,same_shard" {
+		t.Errorf("Unexpected group, got %+v", group)
+	}
+
+	shard := group.Shards[0]
+	if shard.Shard.UnassignedReason != "ALLOCATION_FAILED" || shard.Remediation != RemediationRetryFailed {
+		t.Errorf("Unexpected shard, got %+v", shard)
+	}
+}
+
 func TestClusterAllocationExplainWithQueryParams(t *testing.T) {
 	shardID := 0
 	tests := []struct {
@@ -2410,42 +2620,2015 @@ func TestAllocateStalePrimaryShard(t *testing.T) {
 	}
 }
 
-func TestRemoveIndexILMPolicy(t *testing.T) {
-	ilmRemoveTestSetup := &ServerSetup{
-		Method: "POST",
-		Path:   "/test-index/_ilm/remove",
+func TestGetDiskWatermarks(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{"cluster.routing.allocation.disk.watermark.low":"80%"},"transient":{"cluster.routing.allocation.disk.watermark.low":"88%"},"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%","cluster.routing.allocation.disk.watermark.high":"90%","cluster.routing.allocation.disk.watermark.flood_stage":"95%"}}`,
+		QueryParams: url.Values{
+			"include_defaults": []string{"true"},
+			"flat_settings":    []string{"true"},
+		},
 	}
-	getIndicesTestSetup := &ServerSetup{
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	watermarks, err := client.GetDiskWatermarks()
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	expected := DiskWatermarks{Low: "88%", High: "90%", FloodStage: "95%"}
+	if watermarks != expected {
+		t.Errorf("Expected %+v, got %+v", expected, watermarks)
+	}
+}
+
+func TestGetAllocationSettings(t *testing.T) {
+	testSetup := &ServerSetup{
 		Method:   "GET",
-		Path:     "/_cat/indices/test-index*.ds-ilm-history-*",
-		Response: "[]",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{"cluster.routing.allocation.node_concurrent_recoveries":"4","indices.recovery.max_bytes_per_sec":"100mb"},"transient":{"indices.recovery.max_bytes_per_sec":"200mb"},"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%","cluster.routing.allocation.disk.watermark.high":"90%","cluster.routing.allocation.disk.watermark.flood_stage":"95%","cluster.routing.allocation.node_concurrent_recoveries":"2","cluster.routing.allocation.cluster_concurrent_rebalance":"2","indices.recovery.max_bytes_per_sec":"40mb"}}`,
+		QueryParams: url.Values{
+			"include_defaults": []string{"true"},
+			"flat_settings":    []string{"true"},
+		},
 	}
 
-	host, port, ts := setupTestServers(t, []*ServerSetup{ilmRemoveTestSetup, getIndicesTestSetup})
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
 	defer ts.Close()
 	client := NewClient(host, port)
 
-	err := client.RemoveIndexILMPolicy("test-index")
+	settings, err := client.GetAllocationSettings()
 	if err != nil {
 		t.Fatalf("Unexpected error. expected nil, got %s", err)
 	}
+
+	if settings.DiskWatermarks != (DiskWatermarks{Low: "85%", High: "90%", FloodStage: "95%"}) {
+		t.Errorf("Unexpected watermarks, got %+v", settings.DiskWatermarks)
+	}
+
+	if settings.NodeConcurrentRecoveries != 4 || settings.ClusterConcurrentRebalance != 2 || settings.RecoveryMaxBytesPerSec != "200mb" {
+		t.Errorf("Unexpected settings, got %+v", settings)
+	}
+
+	expectedSources := map[string]string{
+		SettingWatermarkLow:               "defaults",
+		SettingWatermarkHigh:              "defaults",
+		SettingWatermarkFloodStage:        "defaults",
+		SettingNodeConcurrentRecoveries:   "persistent",
+		SettingClusterConcurrentRebalance: "defaults",
+		SettingRecoveryMaxBytesPerSec:     "transient",
+	}
+	assert.DeepEqual(t, settings.Sources, expectedSources)
 }
-func TestLicenseCluster(t *testing.T) {
-	body := `{"license":{"start_date_in_millis":2728303200000,"uid":"asdfasdf-e"}}`
 
+func TestSetAllocationSettings(t *testing.T) {
+	putSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_cluster/settings",
+		Body:     `{"persistent":{"cluster.routing.allocation.disk.watermark.low":"80%","cluster.routing.allocation.node_concurrent_recoveries":6}}`,
+		Response: `{"acknowledged":true,"persistent":{"cluster":{"routing":{"allocation":{"disk":{"watermark":{"low":"80%"}},"node_concurrent_recoveries":"6"}}}},"transient":{}}`,
+	}
+
+	getSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{"cluster.routing.allocation.disk.watermark.low":"80%","cluster.routing.allocation.node_concurrent_recoveries":"6"},"transient":{},"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%","cluster.routing.allocation.node_concurrent_recoveries":"2"}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{putSetup, getSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	low := "80%"
+	recoveries := 6
+	settings, err := client.SetAllocationSettings(AllocationSettingsUpdate{WatermarkLow: &low, NodeConcurrentRecoveries: &recoveries, Persistent: true})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if settings.DiskWatermarks.Low != "80%" || settings.NodeConcurrentRecoveries != 6 || settings.Sources[SettingWatermarkLow] != "persistent" {
+		t.Errorf("Unexpected settings, got %+v", settings)
+	}
+
+	_, err = client.SetAllocationSettings(AllocationSettingsUpdate{})
+	if err == nil {
+		t.Errorf("Expected an error when no setting is updated")
+	}
+
+	_, err = client.SetAllocationSettings(AllocationSettingsUpdate{Reset: []string{"cluster.routing.allocation.enable"}})
+	if err == nil {
+		t.Errorf("Expected an error when resetting a setting other than an allocation setting")
+	}
+
+	_, err = client.SetAllocationSettings(AllocationSettingsUpdate{WatermarkLow: &low, Reset: []string{SettingWatermarkLow}})
+	if err == nil {
+		t.Errorf("Expected an error when setting and resetting the same setting")
+	}
+}
+
+func TestSetAllocationSettings_Reset(t *testing.T) {
+	putSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_cluster/settings",
+		Body:     `{"transient":{"cluster.routing.allocation.node_concurrent_recoveries":null,"indices.recovery.max_bytes_per_sec":"200mb"}}`,
+		Response: `{"acknowledged":true,"persistent":{},"transient":{"indices":{"recovery":{"max_bytes_per_sec":"200mb"}}}}`,
+	}
+
+	getSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{},"transient":{"indices.recovery.max_bytes_per_sec":"200mb"},"defaults":{"cluster.routing.allocation.node_concurrent_recoveries":"2","indices.recovery.max_bytes_per_sec":"40mb"}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{putSetup, getSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	maxBytes := "200mb"
+	settings, err := client.SetAllocationSettings(AllocationSettingsUpdate{RecoveryMaxBytesPerSec: &maxBytes, Reset: []string{SettingNodeConcurrentRecoveries}})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if settings.NodeConcurrentRecoveries != 2 || settings.Sources[SettingNodeConcurrentRecoveries] != "defaults" || settings.RecoveryMaxBytesPerSec != "200mb" {
+		t.Errorf("Unexpected settings, got %+v", settings)
+	}
+}
+
+func TestGetBalanceReport(t *testing.T) {
+	nodeSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/nodes",
+		Response: `[{"master":"*","role":"d","name":"node-a","ip":"10.0.0.1","id":"aaaa"},{"master":"-","role":"d","name":"node-b","ip":"10.0.0.2","id":"bbbb"}]`,
+	}
+
+	allocationSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/allocation",
+		Response: `[{"shards":"2","disk.total":"100gb","disk.percent":"88","node":"node-a"},{"shards":"0","disk.total":"100gb","disk.percent":"20","node":"node-b"}]`,
+	}
+
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"logs","shard":"0","prirep":"p","state":"STARTED","node":"node-a"},{"index":"logs","shard":"1","prirep":"p","state":"STARTED","node":"node-a"}]`,
+	}
+
+	statsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_stats",
+		Response: `{"indices":{"logs":{"primaries":{},"total":{},"shards":{"0":[{"routing":{"state":"STARTED","primary":true,"node":"aaaaXYZ"},"store":{"size_in_bytes":1024}}],"1":[{"routing":{"state":"STARTED","primary":true,"node":"aaaaXYZ"},"store":{"size_in_bytes":2048}}]}}}}`,
+	}
+
+	settingsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{},"transient":{},"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%","cluster.routing.allocation.disk.watermark.high":"90%","cluster.routing.allocation.disk.watermark.flood_stage":"95%"}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{nodeSetup, allocationSetup, shardsSetup, statsSetup, settingsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	report, err := client.GetBalanceReport(BalanceReportOptions{WatermarkMargin: 5})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if len(report.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %+v", report.Nodes)
+	}
+
+	nodeA := report.Nodes[0]
+	if nodeA.Name != "node-a" || nodeA.Shards != 2 || nodeA.Primaries != 2 || nodeA.ShardBytes != 3072 || nodeA.Watermark != "high" || nodeA.WatermarkExceeded {
+		t.Errorf("Unexpected node-a balance, got %+v", nodeA)
+	}
+
+	if report.ShardSkew != 2 || report.DiskSkew != 68 {
+		t.Errorf("Unexpected skew, got shards %f disk %f", report.ShardSkew, report.DiskSkew)
+	}
+
+	if len(report.Concentrations) != 1 || report.Concentrations[0].Index != "logs" || report.Concentrations[0].Primaries != 2 {
+		t.Errorf("Unexpected concentrations, got %+v", report.Concentrations)
+	}
+}
+
+func TestRerouteCommands(t *testing.T) {
 	testSetup := &ServerSetup{
-		Method: "PUT",
-		Path:   "/_license",
-		Body:   body,
+		Method:   "POST",
+		Path:     "/_cluster/reroute",
+		Body:     `{"commands":[{"move":{"from_node":"node-1","index":"test-index","shard":0,"to_node":"node-2"}},{"cancel":{"index":"test-index","node":"node-3","shard":1}},{"allocate_replica":{"index":"test-index","node":"node-2","shard":2}},{"allocate_empty_primary":{"accept_data_loss":true,"index":"test-index","node":"node-1","shard":3}}]}`,
+		Response: `{"acknowledged":true,"explanations":[{"command":"move","parameters":{"index":"test-index","shard":0,"from_node":"node-1","to_node":"node-2"},"decisions":[{"decider":"move_allocation_command","decision":"YES","explanation":"shard has been moved"}]}]}`,
+		extraChecksFn: func(t *testing.T, r *http.Request) {
+			expected := "dry_run=true&explain=true&metric=none"
+			if r.URL.Query().Encode() != expected {
+				t.Errorf("Expected query %s, got %s", expected, r.URL.Query().Encode())
+			}
+		},
 	}
 
 	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
 	defer ts.Close()
 	client := NewClient(host, port)
 
-	err := client.LicenseCluster(body)
+	commands := []RerouteCommand{
+		{Move: &MoveShard{Index: "test-index", Shard: 0, FromNode: "node-1", ToNode: "node-2"}},
+		{Cancel: &CancelShard{Index: "test-index", Shard: 1, Node: "node-3"}},
+		{AllocateReplica: &AllocateReplica{Index: "test-index", Shard: 2, Node: "node-2"}},
+		{AllocateEmptyPrimary: &AllocateEmptyPrimary{Index: "test-index", Shard: 3, Node: "node-1", AcceptDataLoss: true}},
+	}
 
+	result, err := client.Reroute(commands, RerouteOptions{DryRun: true, Explain: true})
 	if err != nil {
-		t.Errorf("Unexpected error expected nil, got %s", err)
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if !result.Acknowledged || len(result.Explanations) != 1 {
+		t.Fatalf("Unexpected result, got %+v", result)
+	}
+
+	explanation := result.Explanations[0]
+	if explanation.Command != "move" || len(explanation.Decisions) != 1 || explanation.Decisions[0].Decision != "YES" {
+		t.Errorf("Unexpected explanation, got %+v", explanation)
+	}
+
+	if commands[0].DataLoss() || commands[1].DataLoss() || commands[2].DataLoss() || !commands[3].DataLoss() {
+		t.Errorf("Unexpected data loss flags for %+v", commands)
+	}
+
+	if commands[3].Name() != "allocate_empty_primary" {
+		t.Errorf("Expected allocate_empty_primary, got %s", commands[3].Name())
+	}
+}
+
+func TestReroute_RetryFailedDryRun(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_cluster/reroute",
+		Response: `{"acknowledged":true}`,
+		extraChecksFn: func(t *testing.T, r *http.Request) {
+			expected := "dry_run=true&metric=none&retry_failed=true"
+			if r.URL.Query().Encode() != expected {
+				t.Errorf("Expected query %s, got %s", expected, r.URL.Query().Encode())
+			}
+		},
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.Reroute(nil, RerouteOptions{DryRun: true, RetryFailed: true})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+}
+
+func TestGetNodesInfo(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_nodes",
+		Response: `{"nodes":{"def456":{"name":"node-b","host":"host-b","ip":"10.0.0.2","roles":["data_hot"],"attributes":{"zone":"b"}},"abc123":{"name":"node-a","host":"host-a","ip":"10.0.0.1","roles":["master","data"],"attributes":{"zone":"a"}}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	nodes, err := client.GetNodesInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %+v", nodes)
+	}
+
+	if nodes[0].ID != "abc123" || nodes[0].Name != "node-a" || nodes[0].Host != "host-a" || nodes[0].IP != "10.0.0.1" || strings.Join(nodes[0].Roles, ",") != "master,data" || nodes[0].Attributes["zone"] != "a" {
+		t.Errorf("Unexpected node, got %+v", nodes[0])
+	}
+}
+
+func TestPlanRebalance(t *testing.T) {
+	nodeSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/nodes",
+		Response: `[{"name":"node-a","id":"aaaa"},{"name":"node-b","id":"bbbb"}]`,
+	}
+
+	allocationSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/allocation",
+		Response: `[{"shards":"2","disk.used":"20gb","disk.total":"100gb","disk.percent":"20","node":"node-a"},{"shards":"0","disk.used":"10gb","disk.total":"100gb","disk.percent":"10","node":"node-b"}]`,
+	}
+
+	nodesInfoSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_nodes",
+		Response: `{"nodes":{"aaaa":{"name":"node-a","attributes":{"box":"hot"}},"bbbb":{"name":"node-b","attributes":{"box":"hot"}}}}`,
+	}
+
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"logs","shard":"0","prirep":"p","state":"STARTED","store":"1gb","node":"node-a"},{"index":"logs","shard":"1","prirep":"p","state":"STARTED","store":"2gb","node":"node-a"}]`,
+	}
+
+	clusterSettingsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/settings",
+		Response: `{"persistent":{},"transient":{},"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%"}}`,
+	}
+
+	indexSettingsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_all/_settings/index.routing.allocation.*",
+		Response: `{"logs":{"settings":{"index.routing.allocation.require.box":"hot"}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{nodeSetup, allocationSetup, nodesInfoSetup, shardsSetup, clusterSettingsSetup, indexSettingsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	plan, err := client.PlanRebalance(RebalancePlanOptions{Metric: BalanceShards})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if len(plan.Moves) != 1 {
+		t.Fatalf("Expected 1 move, got %+v", plan.Moves)
+	}
+
+	expected := ShardMove{Index: "logs", Shard: 1, Primary: true, Bytes: 2 << 30, FromNode: "node-a", ToNode: "node-b"}
+	if plan.Moves[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, plan.Moves[0])
+	}
+
+	_, err = client.PlanRebalance(RebalancePlanOptions{Metric: "heat"})
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported metric")
+	}
+}
+
+func TestApplyRebalancePlan(t *testing.T) {
+	rerouteSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_cluster/reroute",
+		Body:     `{"commands":[{"move":{"from_node":"node-a","index":"logs","shard":1,"to_node":"node-b"}}]}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	recoverySetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/recovery",
+		Response: `[{"index":"other","shard":"0","type":"peer","stage":"index","target_node":"node-b"}]`,
+	}
+
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"logs","shard":"1","prirep":"r","state":"STARTED","node":"node-b"}]`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{rerouteSetup, recoverySetup, shardsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	plan := RebalancePlan{Moves: []ShardMove{{Index: "logs", Shard: 1, FromNode: "node-a", ToNode: "node-b"}}}
+
+	polls := 0
+	err := client.ApplyRebalancePlan(plan, RebalanceApplyOptions{BatchSize: 5, PollInterval: time.Millisecond}, func(progress RebalanceProgress) {
+		polls++
+		if progress.Batch != 1 || progress.Batches != 1 || len(progress.Moves) != 1 || len(progress.Recoveries) != 0 {
+			t.Errorf("Unexpected progress, got %+v", progress)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+
+	if polls != 1 {
+		t.Errorf("Expected 1 poll, got %d", polls)
+	}
+}
+
+func TestApplyRebalancePlan_ShardNotMoved(t *testing.T) {
+	rerouteSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_cluster/reroute",
+		Body:     `{"commands":[{"move":{"from_node":"node-a","index":"logs","shard":1,"to_node":"node-b"}}]}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	recoverySetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/recovery",
+		Response: `[]`,
+	}
+
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"logs","shard":"1","prirep":"r","state":"STARTED","node":"node-a"}]`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{rerouteSetup, recoverySetup, shardsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	plan := RebalancePlan{Moves: []ShardMove{{Index: "logs", Shard: 1, FromNode: "node-a", ToNode: "node-b"}}}
+
+	err := client.ApplyRebalancePlan(plan, RebalanceApplyOptions{PollInterval: time.Millisecond, Timeout: 5 * time.Millisecond}, nil)
+	if err == nil {
+		t.Fatal("Expected error for a shard still on its old node, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "logs/1 to node-b") {
+		t.Errorf("Expected the pending move in the error, got %s", err)
+	}
+}
+
+func TestRemoveIndexILMPolicy(t *testing.T) {
+	ilmRemoveTestSetup := &ServerSetup{
+		Method: "POST",
+		Path:   "/test-index/_ilm/remove",
+	}
+	getIndicesTestSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/test-index*.ds-ilm-history-*",
+		Response: "[]",
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{ilmRemoveTestSetup, getIndicesTestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.RemoveIndexILMPolicy("test-index")
+	if err != nil {
+		t.Fatalf("Unexpected error. expected nil, got %s", err)
+	}
+}
+func TestLicenseCluster(t *testing.T) {
+	body := `{"license":{"start_date_in_millis":2728303200000,"uid":"asdfasdf-e"}}`
+
+	testSetup := &ServerSetup{
+		Method: "PUT",
+		Path:   "/_license",
+		Body:   body,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.LicenseCluster(body)
+
+	if err != nil {
+		t.Errorf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestResizeIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		request  *ResizeIndexRequest
+		body     string
+		resizeFn func(c *Client, source, target string, request *ResizeIndexRequest) error
+	}{
+		{
+			name:     "shrink",
+			path:     "/octocat/_shrink/octocat-shrunk",
+			request:  &ResizeIndexRequest{Settings: map[string]interface{}{"index.number_of_shards": 1}},
+			body:     `{"settings":{"index.number_of_shards":1}}`,
+			resizeFn: (*Client).ShrinkIndex,
+		},
+		{
+			name:     "split",
+			path:     "/octocat/_split/octocat-split",
+			request:  &ResizeIndexRequest{Settings: map[string]interface{}{"index.number_of_shards": 10}},
+			body:     `{"settings":{"index.number_of_shards":10}}`,
+			resizeFn: (*Client).SplitIndex,
+		},
+		{
+			name:     "clone",
+			path:     "/octocat/_clone/octocat-clone",
+			request:  nil,
+			body:     "",
+			resizeFn: (*Client).CloneIndex,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			testSetup := &ServerSetup{
+				Method:   "POST",
+				Path:     tc.path,
+				Body:     tc.body,
+				Response: `{"acknowledged":true,"shards_acknowledged":true,"index":"target"}`,
+			}
+
+			host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+			defer ts.Close()
+			client := NewClient(host, port)
+
+			target := strings.Split(tc.path, "/")[3]
+			err := tc.resizeFn(client, "octocat", target, tc.request)
+			if err != nil {
+				t.Fatalf("Unexpected error expected nil, got %s", err)
+			}
+		})
+	}
+}
+
+func TestShrinkIndex_NotAcknowledged(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/octocat/_shrink/octocat-shrunk",
+		Response: `{"acknowledged":false}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.ShrinkIndex("octocat", "octocat-shrunk", nil)
+	if err == nil {
+		t.Fatal("Expected error for unacknowledged shrink, got nil")
+	}
+}
+
+// Server setups for the PrepareAndShrinkIndex workflow on index "src", recording the requests in order.
+func prepareAndShrinkTestSetups(requests *[]string, shrinkStatus int) []*ServerSetup {
+	return []*ServerSetup{
+		{
+			Method:   "GET",
+			Path:     "/_cat/shards",
+			Response: `[{"index":"src","shard":"0","prirep":"p","state":"STARTED","node":"node-a"},{"index":"src","shard":"1","prirep":"p","state":"STARTED","node":"node-a"}]`,
+			extraChecksFn: func(t *testing.T, r *http.Request) {
+				*requests = append(*requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+			},
+		},
+		{
+			Method:   "GET",
+			Path:     "/src/_settings",
+			Response: `{"src":{"settings":{"index":{"routing":{"allocation":{"require":{"_name":"node-old"}}}}}}}`,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/src/_settings",
+			Body:     `{"index":{"blocks.write":"true"}}`,
+			Response: `{"acknowledged":true}`,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/src/_settings",
+			Body:     `{"index":{"routing.allocation.require._name":"node-a"}}`,
+			Response: `{"acknowledged":true}`,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/src/_settings",
+			Body:     `{"index":{"blocks.write":null,"routing.allocation.require._name":"node-old"}}`,
+			Response: `{"acknowledged":true}`,
+		},
+		{
+			Method:     "POST",
+			Path:       "/src/_shrink/tgt",
+			Body:       `{"settings":{"index.blocks.write":null,"index.number_of_shards":1,"index.routing.allocation.require._name":null}}`,
+			Response:   `{"acknowledged":true,"shards_acknowledged":true,"index":"tgt"}`,
+			HTTPStatus: shrinkStatus,
+		},
+		{
+			Method:   "GET",
+			Path:     "/_cluster/health/tgt",
+			Response: `{"status":"green"}`,
+		},
+		{
+			Method:   "GET",
+			Path:     "/src/_alias",
+			Response: `{"src":{"aliases":{"logs":{"is_write_index":true,"index_routing":"1","search_routing":"1","filter":{"term":{"user":"octocat"}}}}}}`,
+		},
+		{
+			Method:   "POST",
+			Path:     "/_aliases",
+			Body:     `{"actions":[{"remove":{"alias":"logs","index":"src"}},{"add":{"alias":"logs","filter":{"term":{"user":"octocat"}},"index":"tgt","index_routing":"1","is_write_index":true,"search_routing":"1"}}]}`,
+			Response: `{"acknowledged":true}`,
+		},
+	}
+}
+
+func TestPrepareAndShrinkIndex(t *testing.T) {
+	requests := []string{}
+	host, port, ts := setupTestServers(t, prepareAndShrinkTestSetups(&requests, 0))
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.PrepareAndShrinkIndex("src", "tgt", ShrinkOptions{Shards: 1, SwapAliases: true, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if result.Node != "node-a" || strings.Join(result.MovedAliases, ",") != "logs" || result.DeletedSource {
+		t.Errorf("Unexpected result, got %+v", result)
+	}
+
+	expected := []string{
+		"GET /_cat/shards",
+		"GET /src/_settings",
+		"PUT /src/_settings",
+		"GET /src/_settings",
+		"PUT /src/_settings",
+		"GET /_cat/shards",
+		"POST /src/_shrink/tgt",
+		"GET /_cluster/health/tgt",
+		"GET /src/_alias",
+		"POST /_aliases",
+		"PUT /src/_settings",
+	}
+	assert.DeepEqual(t, requests, expected)
+}
+
+func TestPrepareAndShrinkIndex_RestoresSourceOnError(t *testing.T) {
+	requests := []string{}
+	host, port, ts := setupTestServers(t, prepareAndShrinkTestSetups(&requests, http.StatusBadRequest))
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.PrepareAndShrinkIndex("src", "tgt", ShrinkOptions{Shards: 1, Node: "node-a", PollInterval: time.Millisecond})
+	if err == nil {
+		t.Fatal("Expected error for failed shrink, got nil")
+	}
+
+	// The last request puts the previous write block and allocation filter back.
+	if len(requests) == 0 || requests[len(requests)-1] != "PUT /src/_settings" || requests[len(requests)-2] != "POST /src/_shrink/tgt" {
+		t.Errorf("Expected the source settings to be restored after the failed shrink, got %v", requests)
+	}
+}
+
+func TestRollover(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method: "POST",
+		Path:   "/logs-write/_rollover",
+		Body:   `{"conditions":{"max_age":"7d","max_docs":1000}}`,
+		QueryParams: url.Values{
+			"dry_run": []string{"true"},
+		},
+		Response: `{"acknowledged":false,"shards_acknowledged":false,"old_index":"logs-000001","new_index":"logs-000002","rolled_over":false,"dry_run":true,"conditions":{"[max_age: 7d]":false,"[max_docs: 1000]":true}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.Rollover("logs-write", RolloverConditions{MaxAge: "7d", MaxDocs: 1000}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if result.OldIndex != "logs-000001" || result.NewIndex != "logs-000002" {
+		t.Errorf("Unexpected indices, got %+v", result)
+	}
+
+	if result.RolledOver || !result.DryRun {
+		t.Errorf("Expected a dry run without rollover, got %+v", result)
+	}
+
+	met := result.MetConditions()
+	if len(met) != 1 || met[0] != "[max_docs: 1000]" {
+		t.Errorf("Unexpected met conditions, got %v", met)
+	}
+}
+
+func TestRolloverToIndex_Unconditional(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/logs-write/_rollover/logs-2021.01",
+		Response: `{"acknowledged":true,"shards_acknowledged":true,"old_index":"logs-2020.12","new_index":"logs-2021.01","rolled_over":true,"dry_run":false,"conditions":{}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.RolloverToIndex("logs-write", "logs-2021.01", RolloverConditions{}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if !result.RolledOver || result.NewIndex != "logs-2021.01" {
+		t.Errorf("Unexpected rollover result, got %+v", result)
+	}
+}
+
+func TestForceMerge(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method: "POST",
+		Path:   "/logs-*/_forcemerge",
+		QueryParams: url.Values{
+			"wait_for_completion": []string{"false"},
+			"max_num_segments":    []string{"1"},
+		},
+		Response: `{"task":"oTUltX4IQMOUUVeiohTt8A:12345"}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	task, err := client.ForceMerge("logs-*", ForceMergeOptions{MaxNumSegments: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if task != "oTUltX4IQMOUUVeiohTt8A:12345" {
+		t.Errorf("Unexpected task, got %s", task)
+	}
+}
+
+func TestRefreshFlushAndClearCache(t *testing.T) {
+	response := `{"_shards":{"total":10,"successful":5,"failed":0}}`
+	refreshSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/octocat/_refresh",
+		Response: response,
+	}
+	flushSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/octocat/_flush",
+		Response: response,
+	}
+	cacheSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/octocat/_cache/clear",
+		Response: response,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{refreshSetup, flushSetup, cacheSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.RefreshIndex("octocat")
+	if err != nil {
+		t.Fatalf("Unexpected error refreshing, got %s", err)
+	}
+	if result.Shards.Successful != 5 {
+		t.Errorf("Expected 5 successful shards, got %+v", result)
+	}
+
+	_, err = client.FlushIndex("octocat", true)
+	if err != nil {
+		t.Fatalf("Unexpected error flushing, got %s", err)
+	}
+
+	_, err = client.ClearIndexCache("octocat", ClearCacheOptions{Fielddata: true, Fields: []string{"user", "repo"}})
+	if err != nil {
+		t.Fatalf("Unexpected error clearing cache, got %s", err)
+	}
+}
+
+func TestWaitForTask(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_tasks/oTUltX4IQMOUUVeiohTt8A:12345",
+		Response: `{"completed":true,"task":{"node":"oTUltX4IQMOUUVeiohTt8A","id":12345,"type":"transport","action":"indices:admin/forcemerge","description":"Force-merge indices [logs-1], maxSegments[1]","start_time_in_millis":1609459200000,"running_time_in_nanos":5000000000,"cancellable":false},"response":{"_shards":{"total":2,"successful":2,"failed":0}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	polls := 0
+	task, err := client.WaitForTask("oTUltX4IQMOUUVeiohTt8A:12345", time.Millisecond, time.Minute, func(TaskStatus) { polls++ })
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if !task.Completed || task.Action != "indices:admin/forcemerge" || task.RunningTime != 5*time.Second {
+		t.Errorf("Unexpected task, got %+v", task)
+	}
+
+	if polls != 1 {
+		t.Errorf("Expected 1 poll, got %d", polls)
+	}
+}
+
+func TestWaitForTask_Timeout(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_tasks/oTUltX4IQMOUUVeiohTt8A:12345",
+		Response: `{"completed":false,"task":{"node":"oTUltX4IQMOUUVeiohTt8A","id":12345,"type":"transport","action":"indices:admin/forcemerge","start_time_in_millis":1609459200000,"running_time_in_nanos":5000000000,"cancellable":false}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.WaitForTask("oTUltX4IQMOUUVeiohTt8A:12345", time.Millisecond, time.Nanosecond, nil)
+	if err == nil {
+		t.Fatal("Expected error waiting for a running task past the timeout, got nil")
+	}
+}
+
+func TestGetIndexSegments(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/octocat/_segments",
+		Response: `{"_shards":{"total":2,"successful":2,"failed":0},"indices":{"octocat":{"shards":{"0":[{"routing":{"state":"STARTED","primary":false,"node":"node-b"},"num_committed_segments":1,"num_search_segments":1,"segments":{"_0":{"generation":0,"num_docs":10,"deleted_docs":2,"size_in_bytes":4096,"memory_in_bytes":512,"committed":true,"search":true,"version":"8.7.0","compound":true}}},{"routing":{"state":"STARTED","primary":true,"node":"node-a"},"num_committed_segments":1,"num_search_segments":2,"segments":{"_1":{"generation":1,"num_docs":5,"deleted_docs":0,"size_in_bytes":1024,"committed":false,"search":true,"compound":true},"_0":{"generation":0,"num_docs":10,"deleted_docs":2,"size_in_bytes":4096,"committed":true,"search":true,"compound":true}}}]}}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	shards, err := client.GetIndexSegments("octocat")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(shards) != 2 {
+		t.Fatalf("Expected 2 shard copies, got %d", len(shards))
+	}
+
+	primary := shards[0]
+	if !primary.Primary || primary.Node != "node-a" || primary.NumSearchSegments != 2 {
+		t.Errorf("Expected the primary shard first, got %+v", primary)
+	}
+
+	if primary.Segments[0].Name != "_0" || primary.Segments[1].Committed {
+		t.Errorf("Unexpected segments, got %+v", primary.Segments)
+	}
+
+	docs, deletedDocs, sizeBytes := primary.Totals()
+	if docs != 15 || deletedDocs != 2 || sizeBytes != 5120 {
+		t.Errorf("Unexpected totals, got %d docs, %d deleted docs, %d bytes", docs, deletedDocs, sizeBytes)
+	}
+}
+
+func TestGetIndexStats(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method: "GET",
+		Path:   "/octocat/_stats",
+		QueryParams: url.Values{
+			"level": []string{"shards"},
+		},
+		Response: `{"_shards":{"total":2,"successful":2,"failed":0},"indices":{"octocat":{"uuid":"abc","primaries":{"docs":{"count":10,"deleted":1},"store":{"size_in_bytes":2048},"indexing":{"index_total":100,"index_time_in_millis":50},"search":{"query_total":20,"query_time_in_millis":5,"fetch_total":3},"get":{"total":4,"time_in_millis":1},"query_cache":{"memory_size_in_bytes":64,"hit_count":7,"miss_count":3,"evictions":0},"fielddata":{"memory_size_in_bytes":128,"evictions":2},"segments":{"count":3,"memory_in_bytes":256},"refresh":{"total":9,"total_time_in_millis":12},"flush":{"total":2,"total_time_in_millis":8}},"total":{"docs":{"count":20,"deleted":2},"store":{"size_in_bytes":4096},"indexing":{"index_total":200},"search":{"query_total":40},"get":{"total":8}},"shards":{"0":[{"routing":{"state":"STARTED","primary":false,"node":"node-b"},"store":{"size_in_bytes":2048}},{"routing":{"state":"STARTED","primary":true,"node":"node-a"},"store":{"size_in_bytes":2048}}]}}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	stats, err := client.GetIndexStats("octocat")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(stats) != 1 || stats[0].Name != "octocat" {
+		t.Fatalf("Unexpected stats, got %+v", stats)
+	}
+
+	primaries := stats[0].Primaries
+	if primaries.StoreSizeBytes != 2048 || primaries.FielddataMemoryBytes != 128 || primaries.FlushTotal != 2 || primaries.SearchFetchTotal != 3 {
+		t.Errorf("Unexpected primaries metrics, got %+v", primaries)
+	}
+
+	size, err := stats[0].Total.Metric("store.size")
+	if err != nil || size != 4096 {
+		t.Errorf("Expected total store size of 4096, got %d (%v)", size, err)
+	}
+
+	if _, err := stats[0].Total.Metric("bogus"); err == nil {
+		t.Errorf("Expected error for unknown metric")
+	}
+
+	if len(stats[0].Shards) != 2 || !stats[0].Shards[0].Primary || stats[0].Shards[0].Node != "node-a" {
+		t.Errorf("Expected the primary shard first, got %+v", stats[0].Shards)
+	}
+
+	later := stats[0]
+	later.Total.IndexingTotal += 500
+	rates := later.RatesSince(stats[0], 10*time.Second)
+	if rates.IndexingPerSecond != 50 || rates.SearchPerSecond != 0 {
+		t.Errorf("Unexpected rates, got %+v", rates)
+	}
+}
+
+var getVersion7_10TestSetup = &ServerSetup{
+	Method:   "GET",
+	Path:     "/",
+	Response: `{"name":"node-a","cluster_name":"octocluster","version":{"number":"7.10.2"},"tagline":"You Know, for Search"}`,
+}
+
+var getVersion5_6TestSetup = &ServerSetup{
+	Method:   "GET",
+	Path:     "/",
+	Response: `{"name":"node-a","cluster_name":"octocluster","version":{"number":"5.6.16"},"tagline":"You Know, for Search"}`,
+}
+
+func TestGetClusterVersion(t *testing.T) {
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	version, err := client.GetClusterVersion()
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if version != "7.10.2" {
+		t.Errorf("Expected version 7.10.2, got %s", version)
+	}
+}
+
+func TestGetLegacyIndexTemplates(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_template",
+		Response: `{"logs":{"order":1,"version":3,"index_patterns":["logs-*"],"settings":{"index":{"number_of_shards":"2"}},"mappings":{},"aliases":{}},"old":{"order":0,"template":"old-*","settings":{}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	templates, err := client.GetLegacyIndexTemplates("")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(templates) != 2 {
+		t.Fatalf("Expected 2 templates, got %d", len(templates))
+	}
+
+	if templates[0].Name != "logs" || templates[0].Order != 1 || *templates[0].Version != 3 || templates[0].IndexPatterns[0] != "logs-*" {
+		t.Errorf("Unexpected template, got %+v", templates[0])
+	}
+
+	if templates[1].Name != "old" || templates[1].IndexPatterns[0] != "old-*" {
+		t.Errorf("Expected the template pattern to be read as an index pattern, got %+v", templates[1])
+	}
+}
+
+func TestPutLegacyIndexTemplate_Version5(t *testing.T) {
+	putSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_template/logs",
+		Body:     `{"order":1,"settings":{"number_of_shards":2},"template":"logs-*"}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion5_6TestSetup, putSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.PutLegacyIndexTemplate(LegacyIndexTemplate{
+		Name:          "logs",
+		IndexPatterns: []string{"logs-*"},
+		Order:         1,
+		Settings:      map[string]interface{}{"number_of_shards": 2},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestComposableIndexTemplates_Unsupported(t *testing.T) {
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion5_6TestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.GetComposableIndexTemplates("")
+	if err != ErrComposableTemplatesUnsupported {
+		t.Errorf("Expected ErrComposableTemplatesUnsupported, got %v", err)
+	}
+
+	err = client.DeleteComponentTemplate("base")
+	if err != ErrComposableTemplatesUnsupported {
+		t.Errorf("Expected ErrComposableTemplatesUnsupported, got %v", err)
+	}
+}
+
+func TestPutComposableIndexTemplate(t *testing.T) {
+	priority := 200
+	putSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_index_template/logs",
+		Body:     `{"composed_of":["base"],"data_stream":{},"index_patterns":["logs-*"],"priority":200,"template":{"settings":{"number_of_shards":1}}}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, putSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.PutComposableIndexTemplate(ComposableIndexTemplate{
+		Name:          "logs",
+		IndexPatterns: []string{"logs-*"},
+		ComposedOf:    []string{"base"},
+		Priority:      &priority,
+		Template:      &TemplateContent{Settings: map[string]interface{}{"number_of_shards": 1}},
+		DataStream:    &DataStreamTemplate{},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestGetComponentTemplates(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_component_template/base",
+		Response: `{"component_templates":[{"name":"base","component_template":{"template":{"settings":{"index":{"number_of_replicas":"1"}}},"version":2}}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	templates, err := client.GetComponentTemplates("base")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(templates) != 1 || templates[0].Name != "base" || *templates[0].Version != 2 || templates[0].Template.Settings == nil {
+		t.Errorf("Unexpected component templates, got %+v", templates)
+	}
+}
+
+func TestSimulateIndexTemplate(t *testing.T) {
+	indexTemplatesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_index_template",
+		Response: `{"index_templates":[{"name":"logs","index_template":{"index_patterns":["logs-*"],"priority":100}},{"name":"logs-web","index_template":{"index_patterns":["logs-web-*"],"priority":200}},{"name":"metrics","index_template":{"index_patterns":["metrics-*"]}}]}`,
+	}
+	simulateSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_index_template/_simulate_index/logs-web-1",
+		Response: `{"template":{"settings":{"index":{"number_of_shards":"3"}},"mappings":{"properties":{"message":{"type":"text"}}},"aliases":{}},"overlapping":[{"name":"logs","index_patterns":["logs-*"]}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, indexTemplatesSetup, simulateSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	simulated, err := client.SimulateIndexTemplate("logs-web-1")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if simulated.MatchedTemplate != "logs-web" {
+		t.Errorf("Expected logs-web to match, got %s", simulated.MatchedTemplate)
+	}
+
+	if len(simulated.Overlapping) != 1 || simulated.Overlapping[0].Name != "logs" {
+		t.Errorf("Expected logs to overlap, got %+v", simulated.Overlapping)
+	}
+
+	if simulated.Template.Mappings == nil {
+		t.Errorf("Expected mappings in the simulated template, got %+v", simulated.Template)
+	}
+}
+
+func TestGetDataStreams(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_data_stream/logs-*",
+		Response: `{"data_streams":[{"name":"logs-web","timestamp_field":{"name":"@timestamp"},"indices":[{"index_name":".ds-logs-web-000001","index_uuid":"a"},{"index_name":".ds-logs-web-000002","index_uuid":"b"}],"generation":2,"status":"GREEN","template":"logs","ilm_policy":"logs-policy","hidden":false}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	dataStreams, err := client.GetDataStreams("logs-*")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(dataStreams) != 1 {
+		t.Fatalf("Expected 1 data stream, got %d", len(dataStreams))
+	}
+
+	ds := dataStreams[0]
+	if ds.Name != "logs-web" || ds.TimestampField != "@timestamp" || ds.Generation != 2 || ds.Template != "logs" || ds.ILMPolicy != "logs-policy" {
+		t.Errorf("Unexpected data stream, got %+v", ds)
+	}
+
+	if len(ds.BackingIndices) != 2 || ds.WriteIndex() != ".ds-logs-web-000002" {
+		t.Errorf("Unexpected backing indices, got %v", ds.BackingIndices)
+	}
+}
+
+func TestCreateAndDeleteDataStream(t *testing.T) {
+	createSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_data_stream/logs-web",
+		Response: `{"acknowledged":true}`,
+	}
+	deleteSetup := &ServerSetup{
+		Method:   "DELETE",
+		Path:     "/_data_stream/logs-web",
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, createSetup, deleteSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.CreateDataStream("logs-web")
+	if err != nil {
+		t.Fatalf("Unexpected error creating data stream, got %s", err)
+	}
+
+	err = client.DeleteDataStream("logs-web")
+	if err != nil {
+		t.Fatalf("Unexpected error deleting data stream, got %s", err)
+	}
+}
+
+func TestGetDataStreamStats(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_data_stream/_stats",
+		Response: `{"_shards":{"total":2,"successful":2,"failed":0},"data_stream_count":1,"backing_indices":2,"total_store_size_bytes":4096,"data_streams":[{"data_stream":"logs-web","backing_indices":2,"store_size_bytes":4096,"maximum_timestamp":1609459200000}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	stats, err := client.GetDataStreamStats("")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(stats) != 1 || stats[0].Name != "logs-web" || stats[0].StoreSizeBytes != 4096 || stats[0].MaximumTimestamp != 1609459200000 {
+		t.Errorf("Unexpected stats, got %+v", stats)
+	}
+}
+
+func TestDataStreams_Unsupported(t *testing.T) {
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion5_6TestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.GetDataStreams("")
+	if err != ErrDataStreamsUnsupported {
+		t.Errorf("Expected ErrDataStreamsUnsupported, got %v", err)
+	}
+}
+
+func TestGetILMPolicies(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_ilm/policy",
+		Response: `{"logs":{"version":3,"modified_date":"2021-01-01T00:00:00.000Z","policy":{"phases":{"hot":{"min_age":"0ms","actions":{"rollover":{"max_age":"7d"}}},"delete":{"min_age":"30d","actions":{"delete":{}}}}}},"audit":{"version":1,"modified_date":"2021-01-01T00:00:00.000Z","policy":{"phases":{"hot":{"actions":{}}}}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	policies, err := client.GetILMPolicies("")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(policies) != 2 || policies[0].Name != "audit" || policies[1].Name != "logs" {
+		t.Fatalf("Unexpected policies, got %+v", policies)
+	}
+
+	if policies[1].Version != 3 || policies[1].Phases["delete"].MinAge != "30d" || policies[1].Phases["hot"].Actions["rollover"] == nil {
+		t.Errorf("Unexpected logs policy, got %+v", policies[1])
+	}
+}
+
+func TestPutILMPolicy(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_ilm/policy/logs",
+		Body:     `{"policy":{"phases":{"delete":{"actions":{"delete":{}},"min_age":"30d"}}}}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.PutILMPolicy(ILMPolicy{
+		Name: "logs",
+		Phases: map[string]ILMPhase{
+			"delete": {MinAge: "30d", Actions: map[string]interface{}{"delete": map[string]interface{}{}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestExplainILM(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method: "GET",
+		Path:   "/logs-*/_ilm/explain",
+		QueryParams: url.Values{
+			"expand_wildcards": []string{"all"},
+			"only_errors":      []string{"true"},
+		},
+		Response: `{"indices":{"logs-000002":{"index":"logs-000002","managed":true,"policy":"logs","phase":"hot","action":"rollover","step":"ERROR","failed_step":"check-rollover-ready","step_info":{"type":"illegal_argument_exception","reason":"index.lifecycle.rollover_alias [logs] does not point to index [logs-000002]"},"is_auto_retryable_error":true,"failed_step_retry_count":3},"logs-000001":{"index":"logs-000001","managed":true,"policy":"logs","phase":"warm","action":"complete","step":"complete"}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	explains, err := client.ExplainILM("logs-*", true)
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(explains) != 2 || explains[0].Index != "logs-000001" || explains[0].Failed() {
+		t.Fatalf("Unexpected explains, got %+v", explains)
+	}
+
+	failed := explains[1]
+	if !failed.Failed() || failed.FailedStep != "check-rollover-ready" || failed.StepInfo.Type != "illegal_argument_exception" || failed.FailedStepRetryCount != 3 {
+		t.Errorf("Unexpected failed explain, got %+v", failed)
+	}
+}
+
+func TestILMOperations(t *testing.T) {
+	retrySetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/logs-000002/_ilm/retry",
+		Response: `{"acknowledged":true}`,
+	}
+	startSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_ilm/start",
+		Response: `{"acknowledged":true}`,
+	}
+	stopSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_ilm/stop",
+		Response: `{"acknowledged":true}`,
+	}
+	statusSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_ilm/status",
+		Response: `{"operation_mode":"STOPPING"}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{retrySetup, startSetup, stopSetup, statusSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	if err := client.RetryILM("logs-000002"); err != nil {
+		t.Errorf("Unexpected error retrying ILM, got %s", err)
+	}
+
+	if err := client.StartILM(); err != nil {
+		t.Errorf("Unexpected error starting ILM, got %s", err)
+	}
+
+	if err := client.StopILM(); err != nil {
+		t.Errorf("Unexpected error stopping ILM, got %s", err)
+	}
+
+	status, err := client.GetILMStatus()
+	if err != nil || status != "STOPPING" {
+		t.Errorf("Expected STOPPING, got %s (%v)", status, err)
+	}
+}
+
+func TestGetSLMPolicies(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_slm/policy",
+		Response: `{"nightly":{"version":2,"modified_date_millis":1600000000000,"policy":{"name":"<nightly-{now/d}>","schedule":"0 30 1 * * ?","repository":"backups","config":{"indices":["*"]},"retention":{"expire_after":"30d","min_count":5,"max_count":50}},"last_success":{"snapshot_name":"nightly-2020.09.14","time":1600047000000},"last_failure":{"snapshot_name":"nightly-2020.09.13","time":1599960600000,"details":"repository_exception"},"next_execution_millis":1600133400000,"stats":{"policy":"nightly","snapshots_taken":10,"snapshots_failed":1,"snapshots_deleted":3,"snapshot_deletion_failures":0}},"hourly":{"version":1,"modified_date_millis":1600000000000,"policy":{"name":"<hourly-{now/h}>","schedule":"0 0 * * * ?","repository":"backups"},"next_execution_millis":1600003600000,"stats":{"policy":"hourly"}}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	policies, err := client.GetSLMPolicies("")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(policies) != 2 || policies[0].Policy.Name != "hourly" || policies[0].LastSuccess != nil || policies[0].LastFailure != nil {
+		t.Fatalf("Unexpected policies, got %+v", policies)
+	}
+
+	nightly := policies[1]
+	if nightly.Policy.Repository != "backups" || nightly.Policy.Retention == nil || nightly.Policy.Retention.MaxCount != 50 || nightly.Stats.SnapshotsTaken != 10 {
+		t.Errorf("Unexpected policy, got %+v", nightly)
+	}
+
+	if nightly.LastSuccess == nil || nightly.LastSuccess.Time().Format(time.RFC3339) != "2020-09-14T01:30:00Z" {
+		t.Errorf("Unexpected last success, got %+v", nightly.LastSuccess)
+	}
+
+	if nightly.LastFailure == nil || nightly.LastFailure.Details != "repository_exception" {
+		t.Errorf("Unexpected last failure, got %+v", nightly.LastFailure)
+	}
+}
+
+func TestPutSLMPolicy(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_slm/policy/nightly",
+		Body:     `{"name":"\u003cnightly-{now/d}\u003e","repository":"backups","retention":{"expire_after":"30d"},"schedule":"0 30 1 * * ?"}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.PutSLMPolicy(SLMPolicy{
+		Name:         "nightly",
+		Schedule:     "0 30 1 * * ?",
+		SnapshotName: "<nightly-{now/d}>",
+		Repository:   "backups",
+		Retention:    &SLMRetention{ExpireAfter: "30d"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestSLMOperations(t *testing.T) {
+	executeSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_slm/policy/nightly/_execute",
+		Response: `{"snapshot_name":"nightly-2020.09.14-abc123"}`,
+	}
+	retentionSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_slm/_execute_retention",
+		Response: `{"acknowledged":true}`,
+	}
+	deleteSetup := &ServerSetup{
+		Method:   "DELETE",
+		Path:     "/_slm/policy/nightly",
+		Response: `{"acknowledged":true}`,
+	}
+	statsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_slm/stats",
+		Response: `{"retention_runs":13,"retention_failed":1,"retention_timed_out":0,"retention_deletion_time_millis":1404,"total_snapshots_taken":21,"total_snapshots_failed":2,"total_snapshots_deleted":5,"total_snapshot_deletion_failures":0,"policy_stats":[{"policy":"nightly","snapshots_taken":21,"snapshots_failed":2,"snapshots_deleted":5,"snapshot_deletion_failures":0}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{executeSetup, retentionSetup, deleteSetup, statsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	snapshot, err := client.ExecuteSLMPolicy("nightly")
+	if err != nil || snapshot != "nightly-2020.09.14-abc123" {
+		t.Errorf("Unexpected snapshot, got %s (%v)", snapshot, err)
+	}
+
+	if err := client.ExecuteSLMRetention(); err != nil {
+		t.Errorf("Unexpected error executing retention, got %s", err)
+	}
+
+	if err := client.DeleteSLMPolicy("nightly"); err != nil {
+		t.Errorf("Unexpected error deleting policy, got %s", err)
+	}
+
+	stats, err := client.GetSLMStats()
+	if err != nil {
+		t.Fatalf("Unexpected error getting stats, got %s", err)
+	}
+
+	if stats.TotalSnapshotsTaken != 21 || stats.RetentionFailed != 1 || len(stats.PolicyStats) != 1 || stats.PolicyStats[0].SnapshotsFailed != 2 {
+		t.Errorf("Unexpected stats, got %+v", stats)
+	}
+}
+
+func TestGetSnapshotProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{
+			name:     "7.x",
+			response: `{"snapshots":[{"snapshot":"nightly","repository":"backups","state":"STARTED","shards_stats":{"initializing":0,"started":2,"finalizing":0,"done":3,"failed":0,"total":5},"stats":{"incremental":{"file_count":10,"size_in_bytes":4096},"processed":{"file_count":5,"size_in_bytes":1024},"total":{"file_count":10,"size_in_bytes":4096}}}]}`,
+		},
+		{
+			name:     "6.x",
+			response: `{"snapshots":[{"snapshot":"nightly","repository":"backups","state":"STARTED","shards_stats":{"initializing":0,"started":2,"finalizing":0,"done":3,"failed":0,"total":5},"stats":{"number_of_files":10,"processed_files":5,"total_size_in_bytes":4096,"processed_size_in_bytes":1024}}]}`,
+		},
+	}
+
+	for _, tc := range tests {
+		testSetup := &ServerSetup{
+			Method:   "GET",
+			Path:     "/_snapshot/backups/nightly/_status",
+			Response: tc.response,
+		}
+
+		host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+		client := NewClient(host, port)
+
+		progress, err := client.GetSnapshotProgress("backups", "nightly")
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: Unexpected error expected nil, got %s", tc.name, err)
+		}
+
+		if progress.Done() || progress.ShardsDone != 3 || progress.ShardsTotal != 5 || progress.ProcessedBytes != 1024 || progress.TotalBytes != 4096 {
+			t.Errorf("%s: Unexpected progress, got %+v", tc.name, progress)
+		}
+	}
+}
+
+func TestWaitForSnapshot(t *testing.T) {
+	statusSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backups/nightly/_status",
+		Response: `{"snapshots":[{"snapshot":"nightly","repository":"backups","state":"SUCCESS","shards_stats":{"done":4,"failed":1,"total":5}}]}`,
+	}
+	snapshotSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backups/nightly",
+		Response: `{"snapshots":[{"snapshot":"nightly","state":"PARTIAL","shards":{"total":5,"failed":1,"successful":4}}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{statusSetup, snapshotSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	polls := 0
+	snapshot, err := client.WaitForSnapshot("backups", "nightly", time.Millisecond, time.Minute, func(SnapshotProgress) { polls++ })
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if polls != 1 || snapshot.State != "PARTIAL" || snapshot.Shards.Failed != 1 {
+		t.Errorf("Unexpected snapshot after %d polls, got %+v", polls, snapshot)
+	}
+}
+
+func TestSnapshotProgressDone(t *testing.T) {
+	for state, done := range map[string]bool{
+		"INIT":        false,
+		"STARTED":     false,
+		"IN_PROGRESS": false,
+		"ABORTED":     false,
+		"SUCCESS":     true,
+		"FAILED":      true,
+		"PARTIAL":     true,
+	} {
+		if (SnapshotProgress{State: state}).Done() != done {
+			t.Errorf("Expected Done() %v for state %s", done, state)
+		}
+	}
+}
+
+func TestWaitForSnapshot_Timeout(t *testing.T) {
+	setup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backups/nightly/_status",
+		Response: `{"snapshots":[{"snapshot":"nightly","repository":"backups","state":"STARTED","shards_stats":{"done":1,"failed":0,"total":5}}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{setup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.WaitForSnapshot("backups", "nightly", time.Millisecond, time.Nanosecond, nil)
+	if err == nil {
+		t.Fatal("Expected error waiting for a running snapshot past the timeout, got nil")
+	}
+}
+
+func TestWaitForRestore(t *testing.T) {
+	restoreStart := time.Unix(1600000000, 0)
+	recoveries := []struct {
+		name     string
+		response string
+		done     bool
+	}{
+		{
+			name:     "recoveries of this restore",
+			response: `[{"index":"logs","shard":"0","time":"1s","type":"snapshot","stage":"done","source_host":"n/a","source_node":"n/a","target_host":"10.0.0.1","target_node":"node-a","repository":"backups","snapshot":"nightly","files":"10","files_recovered":"10","files_percent":"100.0%","files_total":"10","bytes":"1024","bytes_recovered":"1024","bytes_percent":"100.0%","bytes_total":"1024","translog_ops":"0","translog_ops_recovered":"0","translog_ops_percent":"100.0%","start_time_millis":"1600000001000"}]`,
+			done:     true,
+		},
+		{
+			name:     "recoveries of an earlier restore",
+			response: `[{"index":"logs","shard":"0","time":"1s","type":"snapshot","stage":"done","source_host":"n/a","source_node":"n/a","target_host":"10.0.0.1","target_node":"node-a","repository":"backups","snapshot":"nightly","files":"10","files_recovered":"10","files_percent":"100.0%","files_total":"10","bytes":"1024","bytes_recovered":"1024","bytes_percent":"100.0%","bytes_total":"1024","translog_ops":"0","translog_ops_recovered":"0","translog_ops_percent":"100.0%","start_time_millis":"1500000000000"}]`,
+			done:     false,
+		},
+	}
+
+	for _, tc := range recoveries {
+		setup := &ServerSetup{
+			Method:   "GET",
+			Path:     "/_cat/recovery",
+			Response: tc.response,
+			extraChecksFn: func(t *testing.T, r *http.Request) {
+				// start_time_millis is only returned when asked for.
+				columns := strings.Split(r.URL.Query().Get("h"), ",")
+				found := false
+				for _, column := range columns {
+					if column == "start_time_millis" {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("Expected the start_time_millis column to be requested, got h=%s", r.URL.Query().Get("h"))
+				}
+			},
+		}
+
+		host, port, ts := setupTestServers(t, []*ServerSetup{setup})
+		client := NewClient(host, port)
+
+		err := client.WaitForRestore("backups", "nightly", RestoreWaitOptions{Indices: []string{"logs"}, StartedAfter: restoreStart, PollInterval: time.Millisecond, Timeout: 10 * time.Millisecond}, nil)
+		ts.Close()
+
+		if tc.done && err != nil {
+			t.Errorf("%s: Unexpected error expected nil, got %s", tc.name, err)
+		}
+
+		if !tc.done && err == nil {
+			t.Errorf("%s: Expected timeout error, got nil", tc.name)
+		}
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	deleteFirst := &ServerSetup{
+		Method:   "DELETE",
+		Path:     "/_snapshot/backup-repo/snapshot1",
+		Response: `{"acknowledged":true}`,
+	}
+	deleteSecond := &ServerSetup{
+		Method:   "DELETE",
+		Path:     "/_snapshot/backup-repo/snapshot2",
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{deleteFirst, deleteSecond})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	deleted := []string{}
+	err := client.PruneSnapshots("backup-repo", []Snapshot{{Name: "snapshot1"}, {Name: "snapshot2"}}, time.Millisecond, func(s Snapshot) {
+		deleted = append(deleted, s.Name)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(deleted) != 2 || deleted[0] != "snapshot1" || deleted[1] != "snapshot2" {
+		t.Errorf("Expected both snapshots deleted in order, got %v", deleted)
+	}
+
+	_, err = client.PlanSnapshotRetention("backup-repo", SnapshotRetentionRules{MaxCount: 10})
+	if err == nil {
+		t.Errorf("Expected an error planning retention without any rule keeping snapshots")
+	}
+}
+
+func TestListSnapshots_ServerSide(t *testing.T) {
+	versionSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/",
+		Response: `{"version":{"number":"7.17.0"}}`,
+	}
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backup-repo/_all",
+		Response: `{"snapshots":[{"snapshot":"snapshot3","state":"SUCCESS"},{"snapshot":"snapshot2","state":"SUCCESS"}],"next":"c25hcHNob3Qy","total":3,"remaining":1}`,
+		extraChecksFn: func(t *testing.T, r *http.Request) {
+			if r.URL.Path != "/_snapshot/backup-repo/_all" {
+				return
+			}
+			expected := "after=abc%3D&order=desc&size=2&slm_policy_filter=nightly&sort=start_time&verbose=false"
+			if r.URL.Query().Encode() != expected {
+				t.Errorf("Expected query %s, got %s", expected, r.URL.Query().Encode())
+			}
+		},
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{versionSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	page, err := client.ListSnapshots("backup-repo", SnapshotListOptions{Order: "desc", Size: 2, After: "abc=", SLMPolicy: "nightly", Brief: true})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(page.Snapshots) != 2 || page.Next != "c25hcHNob3Qy" || page.Total != 3 || page.Remaining != 1 {
+		t.Errorf("Unexpected page, got %+v", page)
+	}
+}
+
+func TestListSnapshots_ClientSide(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backup-repo/_all",
+		Response: `{"snapshots":[{"snapshot":"snapshot1","state":"SUCCESS","start_time":"2021-03-01T01:00:00.000Z","indices":["logs-1"],"metadata":{"policy":"nightly"}},{"snapshot":"snapshot2","state":"FAILED","start_time":"2021-03-02T01:00:00.000Z","indices":["logs-1"],"metadata":{"policy":"nightly"}},{"snapshot":"snapshot3","state":"SUCCESS","start_time":"2021-03-03T01:00:00.000Z","indices":["logs-2"],"metadata":{"policy":"nightly"}},{"snapshot":"manual","state":"SUCCESS","start_time":"2021-03-04T01:00:00.000Z","indices":["logs-2"]}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	opts := SnapshotListOptions{Order: "desc", Size: 1, SLMPolicy: "nightly", State: "success", Index: "logs-*"}
+	page, err := client.ListSnapshots("backup-repo", opts)
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(page.Snapshots) != 1 || page.Snapshots[0].Name != "snapshot3" || page.Total != 2 || page.Remaining != 1 || page.Next != "1" {
+		t.Fatalf("Unexpected first page, got %+v", page)
+	}
+
+	opts.After = page.Next
+	page, err = client.ListSnapshots("backup-repo", opts)
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(page.Snapshots) != 1 || page.Snapshots[0].Name != "snapshot1" || page.Remaining != 0 || page.Next != "" {
+		t.Errorf("Unexpected second page, got %+v", page)
+	}
+}
+
+func TestCloneSnapshot(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "PUT",
+		Path:     "/_snapshot/backup-repo/snapshot1/_clone/snapshot1-logs",
+		Body:     `{"indices":"logs-1,logs-2"}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.CloneSnapshot("backup-repo", "snapshot1", "snapshot1-logs", []string{"logs-1", "logs-2"})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+}
+
+func TestCloneSnapshot_Unsupported(t *testing.T) {
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion5_6TestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	err := client.CloneSnapshot("backup-repo", "snapshot1", "snapshot1-logs", []string{"logs-1"})
+	if err != ErrSnapshotCloneUnsupported {
+		t.Fatalf("Expected ErrSnapshotCloneUnsupported, got %v", err)
+	}
+}
+
+func TestDiagnoseSnapshot(t *testing.T) {
+	snapshotSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backups/nightly",
+		Response: `{"snapshots":[{"snapshot":"nightly","state":"PARTIAL","failures":[{"index":"logs-1","shard_id":0,"node_id":"aBcD1234efGH","reason":"RepositoryException[[backups] could not write blob]","status":"INTERNAL_SERVER_ERROR"}]}]}`,
+	}
+	nodesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/nodes",
+		Response: `[{"name":"node-a","id":"aBcD1234efGH"}]`,
+		extraChecksFn: func(t *testing.T, r *http.Request) {
+			if r.URL.Path == "/_cat/nodes" && r.URL.Query().Get("full_id") != "true" {
+				t.Errorf("Expected full node IDs, got query %s", r.URL.RawQuery)
+			}
+		},
+	}
+	shardsSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/shards",
+		Response: `[{"index":"logs-1","shard":"0","prirep":"p","state":"STARTED","node":"node-a"}]`,
+	}
+	healthSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cluster/health",
+		Response: `{"cluster_name":"mycluster","status":"green"}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{snapshotSetup, nodesSetup, shardsSetup, healthSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	diagnosis, err := client.DiagnoseSnapshot("backups", "nightly")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if diagnosis.ClusterStatus != "green" || len(diagnosis.Failures) != 1 {
+		t.Fatalf("Unexpected diagnosis, got %+v", diagnosis)
+	}
+
+	failure := diagnosis.Failures[0]
+	if failure.NodeName != "node-a" || !failure.NodePresent || failure.Retry {
+		t.Errorf("Expected a storage error on node-a not to be retried, got %+v", failure)
+	}
+}
+
+// Server setups for a scratch cluster copying index "logs-1" of snapshot1 into
+// copy1, whose status is the given response.
+func copySnapshotScratchSetups(targetStatus string) []*ServerSetup {
+	return []*ServerSetup{
+		{
+			Method:   "POST",
+			Path:     "/_snapshot/source-repo/snapshot1/_restore",
+			Body:     `{"indices":"logs-1"}`,
+			Response: `{"accepted":true}`,
+		},
+		{
+			Method:   "GET",
+			Path:     "/_cat/recovery",
+			Response: `[{"index":"logs-1","shard":"0","type":"snapshot","stage":"done","repository":"source-repo","snapshot":"snapshot1"},{"index":"logs-1","shard":"1","type":"snapshot","stage":"done","repository":"source-repo","snapshot":"snapshot1"}]`,
+		},
+		{
+			Method:   "PUT",
+			Path:     "/_snapshot/target-repo/copy1",
+			Body:     `{"indices":"logs-1"}`,
+			Response: `{"accepted":true}`,
+		},
+		{
+			Method:   "GET",
+			Path:     "/_snapshot/target-repo/copy1/_status",
+			Response: targetStatus,
+		},
+		{
+			Method:   "GET",
+			Path:     "/_snapshot/target-repo/copy1",
+			Response: `{"snapshots":[{"snapshot":"copy1","state":"SUCCESS","indices":["logs-1"],"shards":{"total":2,"failed":0,"successful":2}}]}`,
+		},
+		{
+			Method:   "DELETE",
+			Path:     "/logs-1",
+			Response: `{"acknowledged":true}`,
+		},
+	}
+}
+
+func TestCopySnapshot(t *testing.T) {
+	sourceSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/source-repo/snapshot1/_status",
+		Response: `{"snapshots":[{"snapshot":"snapshot1","repository":"source-repo","state":"SUCCESS","shards_stats":{"done":3,"failed":0,"total":3},"indices":{"logs-1":{"shards_stats":{"done":2,"failed":0,"total":2}},"metrics-1":{"shards_stats":{"done":1,"failed":0,"total":1}}}}]}`,
+	}
+
+	tests := []struct {
+		name         string
+		targetStatus string
+		err          bool
+	}{
+		{
+			name:         "every shard copied",
+			targetStatus: `{"snapshots":[{"snapshot":"copy1","repository":"target-repo","state":"SUCCESS","shards_stats":{"done":2,"failed":0,"total":2},"indices":{"logs-1":{"shards_stats":{"done":2,"failed":0,"total":2}}}}]}`,
+		},
+		{
+			name:         "shard missing from the copy",
+			targetStatus: `{"snapshots":[{"snapshot":"copy1","repository":"target-repo","state":"SUCCESS","shards_stats":{"done":1,"failed":0,"total":1},"indices":{"logs-1":{"shards_stats":{"done":1,"failed":0,"total":1}}}}]}`,
+			err:          true,
+		},
+	}
+
+	for _, tc := range tests {
+		sourceHost, sourcePort, sourceTS := setupTestServers(t, []*ServerSetup{sourceSetup})
+		scratchHost, scratchPort, scratchTS := setupTestServers(t, copySnapshotScratchSetups(tc.targetStatus))
+
+		client := NewClient(sourceHost, sourcePort)
+		scratch := NewClient(scratchHost, scratchPort)
+
+		result, err := client.CopySnapshot(scratch, SnapshotCopyOptions{
+			SourceRepository: "source-repo",
+			SourceSnapshot:   "snapshot1",
+			TargetRepository: "target-repo",
+			TargetSnapshot:   "copy1",
+			Indices:          []string{"logs-*"},
+			DeleteRestored:   true,
+			PollInterval:     time.Millisecond,
+		})
+		sourceTS.Close()
+		scratchTS.Close()
+
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: Expected error, got nil", tc.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: Unexpected error expected nil, got %s", tc.name, err)
+		}
+
+		if len(result.Indices) != 1 || result.PrimaryShards != 2 || result.TargetSnapshot.Shards.Successful != 2 {
+			t.Errorf("%s: Unexpected result, got %+v", tc.name, result)
+		}
+	}
+
+	client := NewClient("localhost", 9200)
+	_, err := client.CopySnapshot(NewClient("localhost", 9200), SnapshotCopyOptions{SourceRepository: "source-repo", SourceSnapshot: "snapshot1", TargetRepository: "target-repo", TargetSnapshot: "copy1"})
+	if err == nil {
+		t.Errorf("Expected error copying through the source cluster itself, got nil")
+	}
+}
+
+func TestCleanupRepository(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_snapshot/backup-repo/_cleanup",
+		Response: `{"results":{"deleted_bytes":20480,"deleted_blobs":5}}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.CleanupRepository("backup-repo")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if result.DeletedBytes != 20480 || result.DeletedBlobs != 5 {
+		t.Errorf("Unexpected result, got %+v", result)
+	}
+}
+
+func TestAnalyzeRepository(t *testing.T) {
+	versionSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/",
+		Response: `{"version":{"number":"7.17.0"}}`,
+	}
+	testSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_snapshot/backup-repo/_analyze",
+		Response: `{"coordinating_node":{"id":"abc","name":"node-a"},"repository":"backup-repo","blob_count":10,"concurrency":10,"read_node_count":10,"max_blob_size_bytes":1048576,"max_total_data_size_bytes":1073741824,"summary":{"write":{"count":10,"total_size_bytes":2097152,"total_throttled_nanos":0,"total_elapsed_nanos":2000000000},"read":{"count":20,"total_size_bytes":4194304,"total_wait_nanos":500000000,"max_wait_nanos":100000000,"total_throttled_nanos":0,"total_elapsed_nanos":1000000000}},"listing_elapsed_nanos":3000000,"delete_elapsed_nanos":4000000}`,
+		extraChecksFn: func(t *testing.T, r *http.Request) {
+			if r.URL.Path == "/_snapshot/backup-repo/_analyze" && r.URL.RawQuery != "blob_count=10&max_blob_size=1mb" {
+				t.Errorf("Unexpected query, got %s", r.URL.RawQuery)
+			}
+		},
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{versionSetup, testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	analysis, err := client.AnalyzeRepository("backup-repo", RepositoryAnalysisOptions{BlobCount: 10, MaxBlobSize: "1mb"})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if analysis.CoordinatingNode != "node-a" || analysis.WriteCount != 10 || analysis.ReadWait != 500*time.Millisecond || len(analysis.IssuesDetected) != 0 {
+		t.Errorf("Unexpected analysis, got %+v", analysis)
+	}
+
+	if analysis.WriteThroughput() != 1048576 || analysis.ReadThroughput() != 4194304 {
+		t.Errorf("Unexpected throughput, got write %f and read %f", analysis.WriteThroughput(), analysis.ReadThroughput())
+	}
+}
+
+func TestAnalyzeRepository_Unsupported(t *testing.T) {
+	host, port, ts := setupTestServers(t, []*ServerSetup{getVersion7_10TestSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.AnalyzeRepository("backup-repo", RepositoryAnalysisOptions{})
+	if err != ErrRepositoryAnalysisUnsupported {
+		t.Fatalf("Expected ErrRepositoryAnalysisUnsupported, got %v", err)
+	}
+}
+
+func TestGetSnapshotDetailedStatus(t *testing.T) {
+	testSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_snapshot/backup-repo/snapshot1/_status",
+		Response: `{"snapshots":[{"snapshot":"snapshot1","repository":"backup-repo","state":"STARTED","shards_stats":{"done":1,"failed":0,"total":2},"stats":{"incremental":{"file_count":20,"size_in_bytes":2048},"processed":{"file_count":10,"size_in_bytes":1024},"total":{"file_count":30,"size_in_bytes":4096},"start_time_in_millis":1600000000000,"time_in_millis":5000},"indices":{"logs-1":{"shards_stats":{"done":1,"failed":0,"total":2},"stats":{"incremental":{"file_count":20,"size_in_bytes":2048},"processed":{"file_count":10,"size_in_bytes":1024},"total":{"file_count":30,"size_in_bytes":4096},"start_time_in_millis":1600000000000,"time_in_millis":5000},"shards":{"1":{"stage":"STARTED","node":"aBcD1234","stats":{"incremental":{"file_count":10,"size_in_bytes":1024},"processed":{"file_count":0,"size_in_bytes":0},"total":{"file_count":15,"size_in_bytes":2048},"start_time_in_millis":1600000001000,"time_in_millis":4000}},"0":{"stage":"DONE","stats":{"incremental":{"file_count":10,"size_in_bytes":1024},"total":{"file_count":15,"size_in_bytes":2048},"start_time_in_millis":1600000000000,"time_in_millis":1000}}}}}}]}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{testSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	status, err := client.GetSnapshotDetailedStatus("backup-repo", "snapshot1")
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if status.State != "STARTED" || status.ProcessedBytes != 1024 || status.Stats.FilesToCopy != 20 || status.Stats.Elapsed != 5*time.Second {
+		t.Errorf("Unexpected status, got %+v", status)
+	}
+
+	if len(status.Indices) != 1 || len(status.Indices[0].Shards) != 2 {
+		t.Fatalf("Unexpected indices, got %+v", status.Indices)
+	}
+
+	done, started := status.Indices[0].Shards[0], status.Indices[0].Shards[1]
+	if done.Shard != 0 || done.Stage != "DONE" || done.Stats.BytesCopied != 1024 {
+		t.Errorf("Expected the done shard to have copied its incremental bytes, got %+v", done)
+	}
+
+	if started.Shard != 1 || started.NodeID != "aBcD1234" || started.Stats.StartTime.Format(time.RFC3339) != "2020-09-13T12:26:41Z" {
+		t.Errorf("Unexpected started shard, got %+v", started)
+	}
+}
+
+func TestSwapAlias(t *testing.T) {
+	aliasesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/aliases/logs",
+		Response: `[{"alias":"logs","index":"logs_v1"},{"alias":"logs","index":"logs_v2"}]`,
+	}
+	newIndexSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/logs_v3",
+		Response: `[{"health":"green","status":"open","index":"logs_v3","pri":"1","rep":"1","store.size":"1kb","docs.count":"1020"}]`,
+	}
+	previousIndicesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/logs_v1,logs_v2",
+		Response: `[{"health":"green","status":"open","index":"logs_v1","pri":"1","rep":"1","store.size":"1kb","docs.count":"600"},{"health":"green","status":"open","index":"logs_v2","pri":"1","rep":"1","store.size":"1kb","docs.count":"400"}]`,
+	}
+	aliasesActionsSetup := &ServerSetup{
+		Method:   "POST",
+		Path:     "/_aliases",
+		Body:     `{"actions":[{"add":{"alias":"logs","index":"logs_v3","is_write_index":true}},{"remove_index":{"index":"logs_v1"}},{"remove_index":{"index":"logs_v2"}}]}`,
+		Response: `{"acknowledged":true}`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{aliasesSetup, newIndexSetup, previousIndicesSetup, aliasesActionsSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	result, err := client.SwapAlias("logs", "logs_v3", SwapAliasOptions{MaxDocCountDifference: 0.05, WriteIndex: true, RemoveOldIndices: true})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	if len(result.PreviousIndices) != 2 || result.PreviousDocs != 1000 || result.NewDocs != 1020 {
+		t.Errorf("Unexpected result, got %+v", result)
+	}
+
+	isWriteIndex := true
+	assert.DeepEqual(t, result.Actions, []AliasAction{
+		{ActionType: AddAlias, IndexName: "logs_v3", AliasName: "logs", IsWriteIndex: &isWriteIndex},
+		{ActionType: RemoveIndex, IndexName: "logs_v1"},
+		{ActionType: RemoveIndex, IndexName: "logs_v2"},
+	})
+
+	result, err = client.SwapAlias("logs", "logs_v3", SwapAliasOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error expected nil, got %s", err)
+	}
+
+	assert.DeepEqual(t, result.Actions, []AliasAction{
+		{ActionType: RemoveAlias, IndexName: "logs_v1", AliasName: "logs"},
+		{ActionType: RemoveAlias, IndexName: "logs_v2", AliasName: "logs"},
+		{ActionType: AddAlias, IndexName: "logs_v3", AliasName: "logs"},
+	})
+
+	_, err = client.SwapAlias("logs", "logs_v3", SwapAliasOptions{MaxDocCountDifference: 0.01})
+	if err == nil {
+		t.Errorf("Expected an error swapping to an index with too many documents")
+	}
+}
+
+func TestSwapAlias_EmptyPreviousIndex(t *testing.T) {
+	aliasesSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/aliases/logs",
+		Response: `[{"alias":"logs","index":"logs_v1"}]`,
+	}
+	newIndexSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/logs_v2",
+		Response: `[{"health":"green","status":"open","index":"logs_v2","pri":"1","rep":"1","store.size":"1kb","docs.count":"1000"}]`,
+	}
+	previousIndexSetup := &ServerSetup{
+		Method:   "GET",
+		Path:     "/_cat/indices/logs_v1",
+		Response: `[{"health":"green","status":"open","index":"logs_v1","pri":"1","rep":"1","store.size":"1kb","docs.count":"0"}]`,
+	}
+
+	host, port, ts := setupTestServers(t, []*ServerSetup{aliasesSetup, newIndexSetup, previousIndexSetup})
+	defer ts.Close()
+	client := NewClient(host, port)
+
+	_, err := client.SwapAlias("logs", "logs_v2", SwapAliasOptions{MaxDocCountDifference: 0.05, DryRun: true})
+	if err == nil {
+		t.Errorf("Expected an error comparing document counts with an empty index holding the alias")
 	}
 }
@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/github/vulcanizer"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
 func init() {
@@ -13,6 +17,8 @@ func init() {
 	setupAliasesUpdateSubCommand()
 	setupAliasesAddSubCommand()
 	setupAliasesDeleteSubCommand()
+	setupAliasesSwapSubCommand()
+	setupAliasesApplySubCommand()
 	rootCmd.AddCommand(cmdAliases)
 }
 
@@ -60,6 +66,13 @@ func setupAliasesAddSubCommand() {
 		os.Exit(1)
 	}
 
+	cmdAliasesAdd.Flags().String("filter", "", "Query limiting the documents the alias can access, as JSON, i.e. '{\"term\":{\"user\":\"octocat\"}}'")
+	cmdAliasesAdd.Flags().String("routing", "", "Routing value for both indexing and search operations through the alias")
+	cmdAliasesAdd.Flags().String("index-routing", "", "Routing value for indexing operations through the alias")
+	cmdAliasesAdd.Flags().String("search-routing", "", "Routing value for search operations through the alias")
+	cmdAliasesAdd.Flags().Bool("write-index", false, "Make the index the write index of the alias. Use --write-index=false to explicitly unset it")
+	cmdAliasesAdd.Flags().Bool("hidden", false, "Make the alias hidden")
+
 	cmdAliases.AddCommand(cmdAliasesAdd)
 }
 
@@ -78,13 +91,87 @@ func setupAliasesDeleteSubCommand() {
 		os.Exit(1)
 	}
 
+	cmdAliasesDelete.Flags().Bool("must-exist", false, "Fail if the alias does not exist on the index")
+
 	cmdAliases.AddCommand(cmdAliasesDelete)
 }
 
+func setupAliasesSwapSubCommand() {
+	cmdAliasesSwap.Flags().StringP("alias", "a", "", "Alias to point at the index (required)")
+	err := cmdAliasesSwap.MarkFlagRequired("alias")
+	if err != nil {
+		fmt.Printf("Error binding alias flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdAliasesSwap.Flags().StringP("index", "i", "", "Index the alias should point at (required)")
+	err = cmdAliasesSwap.MarkFlagRequired("index")
+	if err != nil {
+		fmt.Printf("Error binding index flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdAliasesSwap.Flags().Float64("max-doc-difference", 0, "Maximum difference between the document counts of the new and current indices, i.e. 0.05 for 5%. Not checked if 0")
+	cmdAliasesSwap.Flags().Bool("write-index", false, "Make the index the write index of the alias")
+	cmdAliasesSwap.Flags().Bool("remove-old-indices", false, "Delete the indices currently holding the alias in the same atomic operation")
+	cmdAliasesSwap.Flags().Bool("dry-run", false, "Only print the actions, do not modify any alias")
+
+	cmdAliases.AddCommand(cmdAliasesSwap)
+}
+
+func setupAliasesApplySubCommand() {
+	// Shadows the root --configFile flag without its -f shorthand, which is taken by --file here.
+	cmdAliasesApply.Flags().StringVar(&configFile, "configFile", "", "Configuration file to read in (default to \"~/.vulcanizer.yaml\")")
+
+	cmdAliasesApply.Flags().StringP("file", "f", "", "YAML file mapping alias names to lists of indices (required)")
+	err := cmdAliasesApply.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Printf("Error binding file flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdAliasesApply.Flags().Bool("dry-run", false, "Only print the actions, do not modify any alias")
+
+	cmdAliases.AddCommand(cmdAliasesApply)
+}
+
+// Returns a human readable description of an alias action.
+func describeAliasAction(action vulcanizer.AliasAction) string {
+	switch action.ActionType {
+	case vulcanizer.AddAlias:
+		description := fmt.Sprintf("add alias %s to %s", action.AliasName, action.IndexName)
+		if action.IsWriteIndex != nil && *action.IsWriteIndex {
+			description = fmt.Sprintf("%s as write index", description)
+		}
+		return description
+	case vulcanizer.RemoveAlias:
+		return fmt.Sprintf("remove alias %s from %s", action.AliasName, action.IndexName)
+	case vulcanizer.RemoveIndex:
+		return fmt.Sprintf("delete index %s", action.IndexName)
+	default:
+		return fmt.Sprintf("%s %s %s", action.ActionType, action.AliasName, action.IndexName)
+	}
+}
+
+// Returns the value of a boolean flag, or nil if it was not set so the Elasticsearch default applies.
+func getOptionalBool(cmd *cobra.Command, flag string) *bool {
+	if !cmd.Flags().Changed(flag) {
+		return nil
+	}
+
+	value, err := cmd.Flags().GetBool(flag)
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+		os.Exit(1)
+	}
+
+	return &value
+}
+
 var cmdAliases = &cobra.Command{
 	Use:   "aliases",
 	Short: "Interact with aliases of the cluster.",
-	Long:  `Use the list subcommand.`,
+	Long:  `Use the list, update, add, delete, swap and apply subcommands.`,
 }
 
 var cmdAliasesList = &cobra.Command{
@@ -178,7 +265,7 @@ var cmdAliasesUpdate = &cobra.Command{
 var cmdAliasesAdd = &cobra.Command{
 	Use:   "add",
 	Short: "Add an alias",
-	Long:  `Add a new alias to a given index in the given cluster.`,
+	Long:  `Add a new alias to a given index in the given cluster, optionally with a filter, routing, as the write index or hidden.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		v := getClient()
@@ -195,15 +282,42 @@ var cmdAliasesAdd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		actions := []vulcanizer.AliasAction{
-			{
-				ActionType: vulcanizer.AddAlias,
-				IndexName:  indexName,
-				AliasName:  aliasName,
-			},
+		action := vulcanizer.AliasAction{
+			ActionType: vulcanizer.AddAlias,
+			IndexName:  indexName,
+			AliasName:  aliasName,
 		}
 
-		err = v.ModifyAliases(actions)
+		filter, err := cmd.Flags().GetString("filter")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: filter. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if filter != "" {
+			err = json.Unmarshal([]byte(filter), &action.Filter)
+			if err != nil {
+				fmt.Printf("Could not parse argument: filter. Error: %s\n", err)
+				os.Exit(1)
+			}
+		}
+
+		for flag, value := range map[string]*string{
+			"routing":        &action.Routing,
+			"index-routing":  &action.IndexRouting,
+			"search-routing": &action.SearchRouting,
+		} {
+			*value, err = cmd.Flags().GetString(flag)
+			if err != nil {
+				fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+				os.Exit(1)
+			}
+		}
+
+		action.IsWriteIndex = getOptionalBool(cmd, "write-index")
+		action.IsHidden = getOptionalBool(cmd, "hidden")
+
+		err = v.ModifyAliases([]vulcanizer.AliasAction{action})
 		if err != nil {
 			fmt.Printf("Error while taking adding a new alias. Error: %s\n", err)
 			os.Exit(1)
@@ -236,6 +350,7 @@ var cmdAliasesDelete = &cobra.Command{
 				ActionType: vulcanizer.RemoveAlias,
 				IndexName:  indexName,
 				AliasName:  aliasName,
+				MustExist:  getOptionalBool(cmd, "must-exist"),
 			},
 		}
 
@@ -246,3 +361,135 @@ var cmdAliasesDelete = &cobra.Command{
 		}
 	},
 }
+
+var cmdAliasesSwap = &cobra.Command{
+	Use:   "swap",
+	Short: "Point an alias at a new index",
+	Long:  `In one atomic operation remove an alias from every index holding it and add it to the given index, optionally deleting the old indices.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		aliasName, err := cmd.Flags().GetString("alias")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: alias. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		indexName, err := cmd.Flags().GetString("index")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: index. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts := vulcanizer.SwapAliasOptions{}
+		opts.MaxDocCountDifference, err = cmd.Flags().GetFloat64("max-doc-difference")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: max-doc-difference. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		for flag, value := range map[string]*bool{
+			"write-index":        &opts.WriteIndex,
+			"remove-old-indices": &opts.RemoveOldIndices,
+			"dry-run":            &opts.DryRun,
+		} {
+			*value, err = cmd.Flags().GetBool(flag)
+			if err != nil {
+				fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+				os.Exit(1)
+			}
+		}
+
+		result, err := v.SwapAlias(aliasName, indexName, opts)
+		if err != nil {
+			fmt.Printf("Error swapping alias %s to %s: %s\n", aliasName, indexName, err)
+			os.Exit(1)
+		}
+
+		if len(result.PreviousIndices) == 0 {
+			fmt.Printf("Alias %s is not on any other index.\n", aliasName)
+		} else {
+			fmt.Printf("%s has %d documents, %s currently holding the alias %d.\n", indexName, result.NewDocs, strings.Join(result.PreviousIndices, ", "), result.PreviousDocs)
+		}
+		for _, action := range result.Actions {
+			fmt.Printf("  %s\n", describeAliasAction(action))
+		}
+
+		if opts.DryRun {
+			fmt.Println("Dry run, no alias modified.")
+			return
+		}
+
+		fmt.Printf("Alias %s now points at %s.\n", aliasName, indexName)
+	},
+}
+
+var cmdAliasesApply = &cobra.Command{
+	Use:   "apply",
+	Short: "Make the aliases match a YAML file",
+	Long: `Given the path to a YAML file mapping alias names to lists of indices, prints the changes needed and applies them in one atomic operation. Aliases not in the file are left alone and an alias mapped to an empty list is removed. For example:
+
+logs:
+  - logs-2021.02
+  - logs-2021.03
+products: [products_v2]`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: file. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: dry-run. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading file %s: %s\n", file, err)
+			os.Exit(1)
+		}
+
+		desired := map[string][]string{}
+		err = yaml.Unmarshal(body, &desired)
+		if err != nil {
+			fmt.Printf("Error parsing file %s: %s\n", file, err)
+			os.Exit(1)
+		}
+
+		actions, err := v.PlanAliasChanges(desired)
+		if err != nil {
+			fmt.Printf("Error computing alias changes: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(actions) == 0 {
+			fmt.Println("Aliases are up to date.")
+			return
+		}
+
+		fmt.Println("Planned changes:")
+		for _, action := range actions {
+			fmt.Printf("  %s\n", describeAliasAction(action))
+		}
+
+		if dryRun {
+			fmt.Println("Dry run, no alias modified.")
+			return
+		}
+
+		err = v.ModifyAliases(actions)
+		if err != nil {
+			fmt.Printf("Error applying alias changes: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Applied %d alias changes.\n", len(actions))
+	},
+}
@@ -3,19 +3,21 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/github/vulcanizer"
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	cmdAllocation.AddCommand(cmdAllocationEnable, cmdAllocationDisable)
+	cmdAllocation.AddCommand(cmdAllocationEnable, cmdAllocationDisable, cmdAllocationSettings)
 	rootCmd.AddCommand(cmdAllocation)
 }
 
 var cmdAllocation = &cobra.Command{
 	Use:   "allocation",
 	Short: "Set shard allocation on the cluster.",
-	Long:  `This command sets allocation on the cluster. It is accessed by the enable/disable subcommands.`,
+	Long:  `This command sets allocation on the cluster. It is accessed by the enable/disable subcommands. Use the settings subcommand to see the disk watermarks and recovery throttling in effect.`,
 }
 
 var cmdAllocationEnable = &cobra.Command{
@@ -53,3 +55,48 @@ var cmdAllocationDisable = &cobra.Command{
 		fmt.Printf("Allocation set to %s\n", response)
 	},
 }
+
+var cmdAllocationSettings = &cobra.Command{
+	Use:   "settings",
+	Short: "Display the allocation settings in effect.",
+	Long:  `This command displays the effective disk watermarks, concurrent recoveries and rebalances, and recovery bandwidth, and whether each one comes from a transient setting, a persistent setting or the defaults.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		settings, err := v.GetAllocationSettings()
+		if err != nil {
+			fmt.Printf("Error getting allocation settings: %s \n", err)
+			os.Exit(1)
+		}
+
+		values := map[string]string{
+			vulcanizer.SettingWatermarkLow:               settings.DiskWatermarks.Low,
+			vulcanizer.SettingWatermarkHigh:              settings.DiskWatermarks.High,
+			vulcanizer.SettingWatermarkFloodStage:        settings.DiskWatermarks.FloodStage,
+			vulcanizer.SettingNodeConcurrentRecoveries:   strconv.Itoa(settings.NodeConcurrentRecoveries),
+			vulcanizer.SettingClusterConcurrentRebalance: strconv.Itoa(settings.ClusterConcurrentRebalance),
+			vulcanizer.SettingRecoveryMaxBytesPerSec:     settings.RecoveryMaxBytesPerSec,
+		}
+
+		header := []string{"Setting", "Value", "Source"}
+		rows := [][]string{}
+		for _, name := range []string{
+			vulcanizer.SettingWatermarkLow,
+			vulcanizer.SettingWatermarkHigh,
+			vulcanizer.SettingWatermarkFloodStage,
+			vulcanizer.SettingNodeConcurrentRecoveries,
+			vulcanizer.SettingClusterConcurrentRebalance,
+			vulcanizer.SettingRecoveryMaxBytesPerSec,
+		} {
+			source, ok := settings.Sources[name]
+			if !ok {
+				rows = append(rows, []string{name, "-", "unsupported"})
+				continue
+			}
+			rows = append(rows, []string{name, values[name], source})
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
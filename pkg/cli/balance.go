@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdBalanceReport.Flags().Float64("watermark-margin", 5, "Flag nodes whose disk usage is within this many percentage points of a disk watermark")
+
+	for _, cmd := range []*cobra.Command{cmdBalancePlan, cmdBalanceApply} {
+		cmd.Flags().String("metric", string(vulcanizer.BalanceShards), "What to even out across nodes, either 'shards' or 'disk'")
+		cmd.Flags().Int("max-moves", 0, "Maximum number of shards to move. No limit if 0")
+		cmd.Flags().Float64("tolerance", 1, "Stop once the most and least loaded nodes differ by at most this many shards or disk percentage points")
+	}
+
+	cmdBalanceApply.Flags().Int("batch-size", 2, "Number of shards to move at once")
+	cmdBalanceApply.Flags().Duration("poll-interval", 30*time.Second, "How often to check on the recoveries of a batch")
+	cmdBalanceApply.Flags().Duration("timeout", time.Hour, "How long to wait for the shards of a batch to move")
+
+	cmdBalance.AddCommand(cmdBalanceReport, cmdBalancePlan, cmdBalanceApply)
+	rootCmd.AddCommand(cmdBalance)
+}
+
+var cmdBalance = &cobra.Command{
+	Use:   "balance",
+	Short: "Analyze how shards are spread across nodes.",
+	Long:  `Use the report subcommand to find shard and disk hot spots, and the plan and apply subcommands to move shards away from them.`,
+}
+
+// Computes a rebalancing plan from the plan flags of the command and prints it.
+func planRebalance(cmd *cobra.Command, v *vulcanizer.Client) vulcanizer.RebalancePlan {
+	metric, err := cmd.Flags().GetString("metric")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: metric. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	maxMoves, err := cmd.Flags().GetInt("max-moves")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-moves. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	tolerance, err := cmd.Flags().GetFloat64("tolerance")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: tolerance. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	plan, err := v.PlanRebalance(vulcanizer.RebalancePlanOptions{
+		Metric:    vulcanizer.BalanceMetric(metric),
+		MaxMoves:  maxMoves,
+		Tolerance: tolerance,
+	})
+	if err != nil {
+		fmt.Printf("Error planning shard moves: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(plan.Moves) == 0 {
+		fmt.Println("No shard move would improve the balance.")
+		return plan
+	}
+
+	header := []string{"Index", "Shard", "Type", "Size", "From", "To"}
+	rows := [][]string{}
+	for _, move := range plan.Moves {
+		shardType := "r"
+		if move.Primary {
+			shardType = "p"
+		}
+		rows = append(rows, []string{move.Index, strconv.Itoa(move.Shard), shardType, humanizeBytes(move.Bytes), move.FromNode, move.ToNode})
+	}
+	fmt.Println(renderTable(rows, header))
+
+	header = []string{"Node", "Shards Before", "Shards After", "Disk % Before", "Disk % After"}
+	rows = [][]string{}
+	for i, before := range plan.Before {
+		after := plan.After[i]
+		rows = append(rows, []string{
+			before.Name,
+			strconv.Itoa(before.Shards),
+			strconv.Itoa(after.Shards),
+			fmt.Sprintf("%.1f", before.DiskPercent()),
+			fmt.Sprintf("%.1f", after.DiskPercent()),
+		})
+	}
+	fmt.Println(renderTable(rows, header))
+
+	return plan
+}
+
+var cmdBalanceReport = &cobra.Command{
+	Use:   "report",
+	Short: "Report shard count skew, index concentration and disk usage per node",
+	Long:  `This command reports how shards and disk usage are spread across the data nodes, the indices with several primaries or more than their fair share of copies on a node, and the nodes close to the disk watermarks.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		margin, err := cmd.Flags().GetFloat64("watermark-margin")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: watermark-margin. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		report, err := v.GetBalanceReport(vulcanizer.BalanceReportOptions{WatermarkMargin: margin})
+		if err != nil {
+			fmt.Printf("Error building balance report: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Shards per node: %.1f on average, skew %.0f%%\n", report.MeanShards, report.ShardSkew*100)
+		fmt.Printf("Disk usage: %.1f%% on average, skew %.0f points\n", report.MeanDiskPercent, report.DiskSkew)
+		fmt.Printf("Disk watermarks: low %s, high %s, flood stage %s\n", report.Watermarks.Low, report.Watermarks.High, report.Watermarks.FloodStage)
+
+		header := []string{"Node", "Shards", "Primaries", "Shard Deviation", "Shard Size", "Disk %", "Disk Deviation", "Watermark"}
+		rows := [][]string{}
+		for _, node := range report.Nodes {
+			watermark := "-"
+			if node.Watermark != "" {
+				watermark = fmt.Sprintf("near %s", node.Watermark)
+				if node.WatermarkExceeded {
+					watermark = fmt.Sprintf("over %s", node.Watermark)
+				}
+			}
+
+			rows = append(rows, []string{
+				node.Name,
+				strconv.Itoa(node.Shards),
+				strconv.Itoa(node.Primaries),
+				fmt.Sprintf("%+.0f%%", node.ShardDeviation*100),
+				humanizeBytes(node.ShardBytes),
+				fmt.Sprintf("%.0f", node.DiskPercent),
+				fmt.Sprintf("%+.1f", node.DiskDeviation),
+				watermark,
+			})
+		}
+		fmt.Println(renderTable(rows, header))
+
+		if len(report.Concentrations) == 0 {
+			fmt.Println("No index concentrated on a node.")
+			return
+		}
+
+		header = []string{"Index", "Node", "Primaries", "Copies", "Fair Share"}
+		rows = [][]string{}
+		for _, concentration := range report.Concentrations {
+			rows = append(rows, []string{
+				concentration.Index,
+				concentration.Node,
+				strconv.Itoa(concentration.Primaries),
+				strconv.Itoa(concentration.Copies),
+				strconv.Itoa(concentration.FairShare),
+			})
+		}
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdBalancePlan = &cobra.Command{
+	Use:   "plan",
+	Short: "Plan shard moves evening out the data nodes",
+	Long:  `This command prints the shard moves that would even out the number of shards or the disk usage of the data nodes, respecting allocation filtering, awareness attributes, the low disk watermark and never putting two copies of a shard on one node. Nothing is moved, use apply for that.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		planRebalance(cmd, v)
+	},
+}
+
+var cmdBalanceApply = &cobra.Command{
+	Use:   "apply",
+	Short: "Move shards to even out the data nodes",
+	Long:  `This command plans the shard moves like plan does and runs them in batches, waiting for the recoveries of a batch to complete before starting the next one.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		batchSize, err := cmd.Flags().GetInt("batch-size")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: batch-size. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		pollInterval, err := cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: poll-interval. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: timeout. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		plan := planRebalance(cmd, v)
+		if len(plan.Moves) == 0 {
+			return
+		}
+
+		err = v.ApplyRebalancePlan(plan, vulcanizer.RebalanceApplyOptions{BatchSize: batchSize, PollInterval: pollInterval, Timeout: timeout}, func(progress vulcanizer.RebalanceProgress) {
+			if len(progress.Recoveries) == 0 {
+				fmt.Printf("Batch %d/%d done.\n", progress.Batch, progress.Batches)
+				return
+			}
+
+			for _, recovery := range progress.Recoveries {
+				fmt.Printf("Batch %d/%d: %s shard %s to %s at %s\n", progress.Batch, progress.Batches, recovery.Index, recovery.Shard, recovery.TargetNode, recovery.BytesPercent)
+			}
+		})
+		if err != nil {
+			fmt.Printf("Error applying shard moves: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Moved %d shards.\n", len(plan.Moves))
+	},
+}
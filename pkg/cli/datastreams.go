@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdDataStreamsList.Flags().Bool("backing-indices", false, "List every backing index instead of only the write index")
+	setupRolloverConditionFlags(cmdDataStreamsRollover)
+
+	cmdDataStreams.AddCommand(cmdDataStreamsList, cmdDataStreamsCreate, cmdDataStreamsDelete, cmdDataStreamsRollover)
+	rootCmd.AddCommand(cmdDataStreams)
+}
+
+var cmdDataStreams = &cobra.Command{
+	Use:     "datastreams",
+	Aliases: []string{"datastream"},
+	Short:   "Interact with the data streams of the cluster.",
+	Long:    `Use the list, create, delete and rollover subcommands. Requires Elasticsearch 7.9 or later.`,
+}
+
+var cmdDataStreamsList = &cobra.Command{
+	Use:   "list",
+	Short: "Display the data streams of the cluster",
+	Long:  `Show the data streams of the cluster, or those matching the given name or pattern, with their backing indices and stats.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		backingIndices, err := cmd.Flags().GetBool("backing-indices")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: backing-indices. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		dataStreams, err := v.GetDataStreams(name)
+		if err != nil {
+			fmt.Printf("Error getting data streams: %s\n", err)
+			os.Exit(1)
+		}
+
+		stats, err := v.GetDataStreamStats(name)
+		if err != nil {
+			fmt.Printf("Error getting data stream stats: %s\n", err)
+			os.Exit(1)
+		}
+
+		statsByName := map[string]vulcanizer.DataStreamStats{}
+		for _, s := range stats {
+			statsByName[s.Name] = s
+		}
+
+		header := []string{"Name", "Status", "Generation", "Template", "ILM Policy", "Backing Indices", "Write Index", "Store", "Last Timestamp"}
+
+		rows := [][]string{}
+		for _, ds := range dataStreams {
+			s := statsByName[ds.Name]
+
+			indices := strconv.Itoa(len(ds.BackingIndices))
+			if backingIndices {
+				indices = strings.Join(ds.BackingIndices, "\n")
+			}
+
+			lastTimestamp := ""
+			if s.MaximumTimestamp > 0 {
+				lastTimestamp = time.Unix(0, s.MaximumTimestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+			}
+
+			row := []string{
+				ds.Name,
+				ds.Status,
+				strconv.Itoa(ds.Generation),
+				ds.Template,
+				ds.ILMPolicy,
+				indices,
+				ds.WriteIndex(),
+				humanizeBytes(s.StoreSizeBytes),
+				lastTimestamp,
+			}
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdDataStreamsCreate = &cobra.Command{
+	Use:   "create",
+	Short: "Create the given data stream",
+	Long:  `Given a name, creates a data stream. A composable index template with data streams enabled must match the name.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.CreateDataStream(args[0])
+		if err != nil {
+			fmt.Printf("Error creating data stream: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Data stream %s created successfully.\n", args[0])
+	},
+}
+
+var cmdDataStreamsDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the given data stream",
+	Long:  `Given a name or pattern, deletes the data stream(s) and all of their backing indices.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.DeleteDataStream(args[0])
+		if err != nil {
+			fmt.Printf("Error deleting data stream: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Data stream %s deleted successfully.\n", args[0])
+	},
+}
+
+var cmdDataStreamsRollover = &cobra.Command{
+	Use:   "rollover",
+	Short: "Roll over the given data stream",
+	Long:  `Given a data stream name, creates a new write index if any of the conditions is met. Without conditions the rollover is unconditional.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		conditions, dryRun := getRolloverConditionFlags(cmd)
+
+		result, err := v.RolloverDataStream(args[0], conditions, dryRun)
+		if err != nil {
+			fmt.Printf("Error rolling over data stream: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printRolloverResult(result)
+	},
+}
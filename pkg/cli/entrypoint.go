@@ -47,6 +47,22 @@ func getConfiguration() Config {
 
 	}
 
+	return configurationFrom(v)
+}
+
+// Returns the configuration of a cluster of the configuration file, ignoring the connection flags,
+// which belong to the cluster given with --cluster.
+func getClusterConfiguration(cluster string) Config {
+	v := viper.Sub(cluster)
+	if v == nil {
+		fmt.Printf("Could not retrieve configuration for cluster \"%s\"\n", cluster)
+		os.Exit(1)
+	}
+
+	return configurationFrom(v)
+}
+
+func configurationFrom(v *viper.Viper) Config {
 	config := Config{
 		Host:     v.GetString("host"),
 		Port:     v.GetInt("port"),
@@ -67,8 +83,10 @@ func getConfiguration() Config {
 }
 
 func getClient() *vulcanizer.Client {
+	return clientFrom(getConfiguration())
+}
 
-	c := getConfiguration()
+func clientFrom(c Config) *vulcanizer.Client {
 
 	v := vulcanizer.NewClient(
 		c.Host,
@@ -123,6 +141,20 @@ func printableNil(ptrValue *string) string {
 	return *ptrValue
 }
 
+func humanizeBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%db", b)
+	}
+
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cb", float64(b)/float64(div), "kmgtpe"[exp])
+}
+
 func renderTable(rows [][]string, header []string) string {
 	var result bytes.Buffer
 	table := tablewriter.NewWriter(&result)
@@ -135,6 +167,9 @@ func renderTable(rows [][]string, header []string) string {
 
 var rootCmd = &cobra.Command{Use: "vulcanizer"}
 
+// Value of the --configFile flag, shared with the commands that shadow it to use -f for something else.
+var configFile string
+
 func InitializeCLI(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) {
 
 	rootCmd.SetArgs(args)
@@ -152,7 +187,7 @@ func InitializeCLI(args []string, stdin io.Reader, stdout io.Writer, stderr io.W
 	rootCmd.PersistentFlags().StringP("path", "", "", "Path to prepend to queries, in case Elasticsearch is behind a reverse proxy")
 	rootCmd.PersistentFlags().StringP("protocol", "", "http", "Protocol to use when querying the cluster. Either 'http' or 'https'. Defaults to 'http'")
 	rootCmd.PersistentFlags().StringP("skipverify", "k", "false", "Skip verifying server's TLS certificate. Defaults to 'false', ie. verify the server's certificate")
-	rootCmd.PersistentFlags().StringP("configFile", "f", "", "Configuration file to read in (default to \"~/.vulcanizer.yaml\")")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "configFile", "f", "", "Configuration file to read in (default to \"~/.vulcanizer.yaml\")")
 	rootCmd.PersistentFlags().StringP("cert", "", "", "Path to the certificate to use for client certificate authentication")
 	rootCmd.PersistentFlags().StringP("key", "", "", "Path to the key to use for client certificate authentication")
 	rootCmd.PersistentFlags().StringP("cacert", "", "", "Path to the certificate to check the cluster certificates against")
@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdILMPut.Flags().String("file", "", "Path to a JSON file holding the policy body, i.e. {\"phases\": {...}} (required)")
+	err := cmdILMPut.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Printf("Error binding file configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdILMAttach.Flags().String("policy", "", "ILM policy to attach to the index/indices (required)")
+	err = cmdILMAttach.MarkFlagRequired("policy")
+	if err != nil {
+		fmt.Printf("Error binding policy configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdILMExplain.Flags().Bool("failed-only", false, "Only display indices with a failed ILM step")
+
+	cmdILM.AddCommand(cmdILMPolicies, cmdILMGet, cmdILMPut, cmdILMDelete, cmdILMAttach, cmdILMExplain, cmdILMRetry, cmdILMStart, cmdILMStop, cmdILMStatus)
+	rootCmd.AddCommand(cmdILM)
+}
+
+var cmdILM = &cobra.Command{
+	Use:   "ilm",
+	Short: "Interact with index lifecycle management.",
+	Long:  `Use the policies, get, put, delete, attach, explain, retry, start, stop and status subcommands.`,
+}
+
+var cmdILMPolicies = &cobra.Command{
+	Use:   "policies",
+	Short: "List the ILM policies of the cluster",
+	Long:  `Show the ILM policies of the cluster, or the given one, with their phases.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		policies, err := v.GetILMPolicies(name)
+		if err != nil {
+			fmt.Printf("Error getting ILM policies: %s\n", err)
+			os.Exit(1)
+		}
+
+		header := []string{"Name", "Version", "Modified", "Phases"}
+		rows := [][]string{}
+		for _, policy := range policies {
+			phases := []string{}
+			for phaseName, phase := range policy.Phases {
+				actions := []string{}
+				for action := range phase.Actions {
+					actions = append(actions, action)
+				}
+				sort.Strings(actions)
+				phases = append(phases, fmt.Sprintf("%s (min_age %s): %s", phaseName, phase.MinAge, strings.Join(actions, ", ")))
+			}
+			sort.Strings(phases)
+
+			row := []string{
+				policy.Name,
+				strconv.Itoa(policy.Version),
+				policy.ModifiedDate,
+				strings.Join(phases, "\n"),
+			}
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdILMGet = &cobra.Command{
+	Use:   "get",
+	Short: "Display the given ILM policy",
+	Long:  `Given a policy name, shows its body as JSON.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		policies, err := v.GetILMPolicies(args[0])
+		if err != nil {
+			fmt.Printf("Error getting ILM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		if len(policies) == 0 {
+			fmt.Printf("No ILM policy found: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		pretty, err := json.MarshalIndent(policies[0], "", "  ")
+		if err != nil {
+			fmt.Printf("Error formatting ILM policy: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(pretty))
+	},
+}
+
+var cmdILMPut = &cobra.Command{
+	Use:   "put",
+	Short: "Create or update the given ILM policy",
+	Long:  `Given a policy name and a JSON file holding its body, creates or replaces the policy.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: file. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading policy file: %s\n", err)
+			os.Exit(1)
+		}
+
+		var policy vulcanizer.ILMPolicy
+		err = json.Unmarshal(body, &policy)
+		if err != nil {
+			fmt.Printf("Error parsing policy file: %s\n", err)
+			os.Exit(1)
+		}
+		policy.Name = args[0]
+
+		err = v.PutILMPolicy(policy)
+		if err != nil {
+			fmt.Printf("Error putting ILM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ILM policy %s saved successfully.\n", args[0])
+	},
+}
+
+var cmdILMDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the given ILM policy",
+	Long:  `Given a policy name, deletes the policy. The policy must not be in use by any index.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.DeleteILMPolicy(args[0])
+		if err != nil {
+			fmt.Printf("Error deleting ILM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ILM policy %s deleted successfully.\n", args[0])
+	},
+}
+
+var cmdILMAttach = &cobra.Command{
+	Use:   "attach",
+	Short: "Attach an ILM policy to the given index/indices",
+	Long:  `Given a name or pattern, sets the ILM policy managing the index/indices.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		policy, err := cmd.Flags().GetString("policy")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: policy. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		err = v.SetIndexILMPolicy(args[0], policy)
+		if err != nil {
+			fmt.Printf("Error attaching ILM policy %s to %s: %s\n", policy, args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ILM policy %s attached to %s.\n", policy, args[0])
+	},
+}
+
+var cmdILMExplain = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain the ILM state of indices",
+	Long:  `Show the current phase, action and step of all indices, including hidden ones such as the backing indices of data streams, or the given name or pattern, and why a step failed.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		failedOnly, err := cmd.Flags().GetBool("failed-only")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: failed-only. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		index := "*"
+		if len(args) > 0 {
+			index = args[0]
+		}
+
+		explains, err := v.ExplainILM(index, failedOnly)
+		if err != nil {
+			fmt.Printf("Error explaining ILM: %s\n", err)
+			os.Exit(1)
+		}
+
+		header := []string{"Index", "Policy", "Age", "Phase", "Action", "Step", "Failed Step", "Retries", "Reason"}
+		rows := [][]string{}
+		for _, e := range explains {
+			if !e.Managed {
+				continue
+			}
+
+			reason := ""
+			if e.StepInfo.Reason != "" {
+				reason = fmt.Sprintf("%s: %s", e.StepInfo.Type, e.StepInfo.Reason)
+			}
+
+			row := []string{
+				e.Index,
+				e.Policy,
+				e.Age,
+				e.Phase,
+				e.Action,
+				e.Step,
+				e.FailedStep,
+				strconv.Itoa(e.FailedStepRetryCount),
+				reason,
+			}
+			rows = append(rows, row)
+		}
+
+		if failedOnly && len(rows) == 0 {
+			fmt.Println("No indices with a failed ILM step.")
+			return
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdILMRetry = &cobra.Command{
+	Use:   "retry",
+	Short: "Retry the failed ILM step of the given index/indices",
+	Long:  `Given a name or pattern, retries the failed ILM step of the index/indices.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.RetryILM(args[0])
+		if err != nil {
+			fmt.Printf("Error retrying ILM: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ILM retry called successfully for %s.\n", args[0])
+	},
+}
+
+var cmdILMStart = &cobra.Command{
+	Use:   "start",
+	Short: "Start ILM on the cluster",
+	Long:  `This command starts index lifecycle management on the cluster.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.StartILM()
+		if err != nil {
+			fmt.Printf("Error starting ILM: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("ILM started.")
+	},
+}
+
+var cmdILMStop = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop ILM on the cluster",
+	Long:  `This command stops index lifecycle management on the cluster once running operations complete.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.StopILM()
+		if err != nil {
+			fmt.Printf("Error stopping ILM: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("ILM stopping.")
+	},
+}
+
+var cmdILMStatus = &cobra.Command{
+	Use:   "status",
+	Short: "Display the ILM status of the cluster",
+	Long:  `This command shows whether index lifecycle management is running, stopping or stopped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		status, err := v.GetILMStatus()
+		if err != nil {
+			fmt.Printf("Error getting ILM status: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ILM is %s.\n", status)
+	},
+}
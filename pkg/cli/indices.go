@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/github/vulcanizer"
 	"github.com/spf13/cobra"
@@ -14,6 +16,108 @@ func init() {
 	cmdIndices.AddCommand(cmdOpen)
 	cmdIndices.AddCommand(cmdClose)
 	cmdIndices.AddCommand(cmdDelete)
+	setupShrinkSubCommand()
+	setupResizeSubCommand(cmdSplit)
+	setupResizeSubCommand(cmdClone)
+	setupRolloverSubCommand()
+}
+
+func setupRolloverSubCommand() {
+	cmdRollover.Flags().String("new-index", "", "Name of the new index. Defaults to incrementing the number at the end of the current index name")
+	setupRolloverConditionFlags(cmdRollover)
+
+	cmdIndices.AddCommand(cmdRollover)
+}
+
+func setupRolloverConditionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("max-age", "", "Roll over once the write index is older than this, i.e. 7d")
+	cmd.Flags().Int("max-docs", 0, "Roll over once the write index holds more documents than this")
+	cmd.Flags().String("max-size", "", "Roll over once the primary shards of the write index are bigger than this in total, i.e. 50gb")
+	cmd.Flags().String("max-primary-shard-size", "", "Roll over once the biggest primary shard of the write index is bigger than this, i.e. 50gb")
+	cmd.Flags().Bool("dry-run", false, "Only check the conditions, don't roll over")
+}
+
+func getRolloverConditionFlags(cmd *cobra.Command) (vulcanizer.RolloverConditions, bool) {
+	maxAge, err := cmd.Flags().GetString("max-age")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-age. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	maxDocs, err := cmd.Flags().GetInt("max-docs")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-docs. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	maxSize, err := cmd.Flags().GetString("max-size")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-size. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	maxPrimaryShardSize, err := cmd.Flags().GetString("max-primary-shard-size")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-primary-shard-size. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: dry-run. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	conditions := vulcanizer.RolloverConditions{
+		MaxAge:              maxAge,
+		MaxDocs:             maxDocs,
+		MaxSize:             maxSize,
+		MaxPrimaryShardSize: maxPrimaryShardSize,
+	}
+
+	return conditions, dryRun
+}
+
+func printRolloverResult(result vulcanizer.RolloverResult) {
+	rows := [][]string{
+		{"Old index", result.OldIndex},
+		{"New index", result.NewIndex},
+		{"Rolled over", strconv.FormatBool(result.RolledOver)},
+		{"Dry run", strconv.FormatBool(result.DryRun)},
+		{"Met conditions", strings.Join(result.MetConditions(), ", ")},
+	}
+
+	fmt.Println(renderTable(rows, []string{"Metric", "Value"}))
+}
+
+func setupShrinkSubCommand() {
+	cmdShrink.Flags().StringP("target", "t", "", "Name of the shrunk index to create (required)")
+	err := cmdShrink.MarkFlagRequired("target")
+	if err != nil {
+		fmt.Printf("Error binding target configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdShrink.Flags().IntP("shards", "s", 1, "Number of primary shards of the shrunk index")
+	cmdShrink.Flags().StringP("node", "n", "", "Node to gather the shards on. Defaults to the node already holding the most shards of the index")
+	cmdShrink.Flags().Bool("swap-aliases", false, "Move the aliases of the source index to the shrunk index")
+	cmdShrink.Flags().Bool("delete-source", false, "Delete the source index once the shrunk index is green")
+	cmdShrink.Flags().Duration("timeout", time.Hour, "How long to wait for relocation and for the shrunk index to become green")
+
+	cmdIndices.AddCommand(cmdShrink)
+}
+
+func setupResizeSubCommand(cmd *cobra.Command) {
+	cmd.Flags().StringP("target", "t", "", "Name of the index to create (required)")
+	err := cmd.MarkFlagRequired("target")
+	if err != nil {
+		fmt.Printf("Error binding target configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmd.Flags().IntP("shards", "s", 0, "Number of primary shards of the new index")
+
+	cmdIndices.AddCommand(cmd)
 }
 
 var cmdIndices = &cobra.Command{
@@ -111,3 +215,152 @@ var cmdDelete = &cobra.Command{
 		}
 	},
 }
+
+var cmdShrink = &cobra.Command{
+	Use:   "shrink",
+	Short: "Shrink the given index into a new index with fewer primary shards",
+	Long:  `Given an index name, makes it read-only, gathers a copy of every shard on one node, shrinks it and cleans up afterwards`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		target, err := cmd.Flags().GetString("target")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: target. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		shards, err := cmd.Flags().GetInt("shards")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: shards. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		node, err := cmd.Flags().GetString("node")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: node. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		swapAliases, err := cmd.Flags().GetBool("swap-aliases")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: swap-aliases. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		deleteSource, err := cmd.Flags().GetBool("delete-source")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: delete-source. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: timeout. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Shrinking %s into %s with %d primary shards. This may take a while.\n", args[0], target, shards)
+
+		result, err := v.PrepareAndShrinkIndex(args[0], target, vulcanizer.ShrinkOptions{
+			Shards:       shards,
+			Node:         node,
+			SwapAliases:  swapAliases,
+			DeleteSource: deleteSource,
+			Timeout:      timeout,
+		})
+		if err != nil {
+			fmt.Printf("Error shrinking index: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		rows := [][]string{
+			{"Source", result.Source},
+			{"Target", result.Target},
+			{"Node", result.Node},
+			{"Relocation time", result.RelocationTime.Round(time.Second).String()},
+			{"Recovery time", result.RecoveryTime.Round(time.Second).String()},
+			{"Moved aliases", strings.Join(result.MovedAliases, ", ")},
+			{"Deleted source", strconv.FormatBool(result.DeletedSource)},
+		}
+
+		fmt.Println(renderTable(rows, []string{"Metric", "Value"}))
+	},
+}
+
+var cmdSplit = &cobra.Command{
+	Use:   "split",
+	Short: "Split the given index into a new index with more primary shards",
+	Long:  `Given a read-only index name, splits it into a new index with the given number of primary shards`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runResize(cmd, args[0], "split", getClient().SplitIndex)
+	},
+}
+
+var cmdClone = &cobra.Command{
+	Use:   "clone",
+	Short: "Clone the given index into a new index",
+	Long:  `Given a read-only index name, clones it into a new index with the same number of primary shards`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runResize(cmd, args[0], "clone", getClient().CloneIndex)
+	},
+}
+
+func runResize(cmd *cobra.Command, source, action string, resizeFn func(string, string, *vulcanizer.ResizeIndexRequest) error) {
+	target, err := cmd.Flags().GetString("target")
+	if err != nil {
+		fmt.Printf("Could not retrieve required argument: target. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	shards, err := cmd.Flags().GetInt("shards")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: shards. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	var request *vulcanizer.ResizeIndexRequest
+	if shards > 0 {
+		request = &vulcanizer.ResizeIndexRequest{
+			Settings: map[string]interface{}{"index.number_of_shards": shards},
+		}
+	}
+
+	err = resizeFn(source, target, request)
+	if err != nil {
+		fmt.Printf("Error trying to %s index: %s - %s\n", action, source, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Index %s is being created from %s.\n", target, source)
+}
+
+var cmdRollover = &cobra.Command{
+	Use:   "rollover",
+	Short: "Roll over the given alias to a new index",
+	Long:  `Given a write alias, creates a new index and points the alias to it if any of the conditions is met. Without conditions the rollover is unconditional`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		newIndex, err := cmd.Flags().GetString("new-index")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: new-index. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		conditions, dryRun := getRolloverConditionFlags(cmd)
+
+		result, err := v.RolloverToIndex(args[0], newIndex, conditions, dryRun)
+		if err != nil {
+			fmt.Printf("Error rolling over alias: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printRolloverResult(result)
+	},
+}
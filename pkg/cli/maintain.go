@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	setupForceMergeSubCommand()
+	setupFlushSubCommand()
+	setupClearCacheSubCommand()
+	cmdMaintain.AddCommand(cmdRefresh)
+
+	cmdIndices.AddCommand(cmdMaintain)
+}
+
+func setupForceMergeSubCommand() {
+	cmdForceMerge.Flags().Int("max-num-segments", 0, "Number of segments to merge to. Defaults to letting Elasticsearch decide")
+	cmdForceMerge.Flags().Bool("only-expunge-deletes", false, "Only merge segments containing deleted documents")
+	cmdForceMerge.Flags().Bool("wait", false, "Wait for the force merge task to complete")
+	cmdForceMerge.Flags().Duration("poll-interval", 30*time.Second, "How often to check on the force merge task when waiting")
+	cmdForceMerge.Flags().Duration("timeout", 0, "How long to wait for the force merge task to complete. No limit if 0")
+
+	cmdMaintain.AddCommand(cmdForceMerge)
+}
+
+func setupFlushSubCommand() {
+	cmdFlush.Flags().Bool("force", false, "Flush even if there are no changes to commit")
+
+	cmdMaintain.AddCommand(cmdFlush)
+}
+
+func setupClearCacheSubCommand() {
+	cmdClearCache.Flags().Bool("query", false, "Clear the query cache")
+	cmdClearCache.Flags().Bool("fielddata", false, "Clear the fielddata cache")
+	cmdClearCache.Flags().Bool("request", false, "Clear the request cache")
+	cmdClearCache.Flags().StringSlice("fields", []string{}, "Limit the fielddata cache clearing to these fields. Can be repeated.")
+
+	cmdMaintain.AddCommand(cmdClearCache)
+}
+
+func printShardOperationResult(operation, index string, result vulcanizer.ShardOperationResult) {
+	fmt.Printf("%s of %s: %d shards total, %d successful, %d failed.\n", operation, index, result.Shards.Total, result.Shards.Successful, result.Shards.Failed)
+	if result.Shards.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+var cmdMaintain = &cobra.Command{
+	Use:   "maintain",
+	Short: "Run maintenance operations on indices.",
+	Long:  `Use the forcemerge, refresh, flush and clearcache subcommands.`,
+}
+
+var cmdForceMerge = &cobra.Command{
+	Use:   "forcemerge",
+	Short: "Force merge the segments of the given index/indices",
+	Long:  `Given a name or pattern, starts a force merge in the background and prints its task ID. Use --wait to block until it completes`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		maxNumSegments, err := cmd.Flags().GetInt("max-num-segments")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: max-num-segments. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		onlyExpungeDeletes, err := cmd.Flags().GetBool("only-expunge-deletes")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: only-expunge-deletes. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: wait. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		pollInterval, err := cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: poll-interval. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: timeout. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		taskID, err := v.ForceMerge(args[0], vulcanizer.ForceMergeOptions{
+			MaxNumSegments:     maxNumSegments,
+			OnlyExpungeDeletes: onlyExpungeDeletes,
+		})
+		if err != nil {
+			fmt.Printf("Error force merging index/indices: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Force merge started with task %s\n", taskID)
+		if !wait {
+			return
+		}
+
+		task, err := v.WaitForTask(taskID, pollInterval, timeout, func(task vulcanizer.TaskStatus) {
+			if !task.Completed {
+				fmt.Printf("Force merge running for %s\n", task.RunningTime.Round(time.Second))
+			}
+		})
+		if err != nil {
+			fmt.Printf("Error waiting for force merge: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Force merge completed in %s\n", task.RunningTime.Round(time.Second))
+	},
+}
+
+var cmdRefresh = &cobra.Command{
+	Use:   "refresh",
+	Short: "Refresh the given index/indices",
+	Long:  `Given a name or pattern, refreshes the index/indices so recent changes are visible to search`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		result, err := v.RefreshIndex(args[0])
+		if err != nil {
+			fmt.Printf("Error refreshing index/indices: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printShardOperationResult("Refresh", args[0], result)
+	},
+}
+
+var cmdFlush = &cobra.Command{
+	Use:   "flush",
+	Short: "Flush the given index/indices",
+	Long:  `Given a name or pattern, flushes the index/indices, committing the transaction log to disk`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: force. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		result, err := v.FlushIndex(args[0], force)
+		if err != nil {
+			fmt.Printf("Error flushing index/indices: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printShardOperationResult("Flush", args[0], result)
+	},
+}
+
+var cmdClearCache = &cobra.Command{
+	Use:   "clearcache",
+	Short: "Clear the caches of the given index/indices",
+	Long:  `Given a name or pattern, clears the selected caches of the index/indices. Clears all caches if none is selected`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		query, err := cmd.Flags().GetBool("query")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: query. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		fielddata, err := cmd.Flags().GetBool("fielddata")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: fielddata. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		request, err := cmd.Flags().GetBool("request")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: request. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		fields, err := cmd.Flags().GetStringSlice("fields")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: fields. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		result, err := v.ClearIndexCache(args[0], vulcanizer.ClearCacheOptions{
+			Query:     query,
+			Fielddata: fielddata,
+			Request:   request,
+			Fields:    fields,
+		})
+		if err != nil {
+			fmt.Printf("Error clearing cache of index/indices: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		printShardOperationResult("Cache clear", args[0], result)
+	},
+}
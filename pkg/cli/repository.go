@@ -15,6 +15,9 @@ func init() {
 	setupVerifySubCommand()
 	setupRegisterSubCommand()
 	setupRemoveSubCommand()
+	setupCleanupSubCommand()
+	setupAnalyzeSubCommand()
+	setupDoctorSubCommand()
 
 	rootCmd.AddCommand(cmdRepository)
 }
@@ -22,7 +25,7 @@ func init() {
 var cmdRepository = &cobra.Command{
 	Use:   "repository",
 	Short: "Interact with the configured snapshot repositories.",
-	Long:  `Use the list, verify, remove, and register subcommands.`,
+	Long:  `Use the list, verify, remove, register, cleanup, analyze and doctor subcommands.`,
 }
 
 func setupVerifySubCommand() {
@@ -36,6 +39,101 @@ func setupVerifySubCommand() {
 	cmdRepository.AddCommand(cmdRepositoryVerify)
 }
 
+func setupCleanupSubCommand() {
+	cmdRepositoryCleanup.Flags().StringP("repository", "r", "", "Snapshot repository to clean up (required)")
+	err := cmdRepositoryCleanup.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdRepository.AddCommand(cmdRepositoryCleanup)
+}
+
+func setupAnalysisFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("blob-count", 0, "Number of blobs to write during the analysis. Defaults to the Elasticsearch default of 100")
+	cmd.Flags().String("max-blob-size", "", "Maximum size of a blob written during the analysis, i.e. 10mb. Defaults to the Elasticsearch default")
+	cmd.Flags().String("analysis-timeout", "", "How long to wait for the analysis to complete, i.e. 1h. Defaults to the Elasticsearch default")
+}
+
+func getAnalysisOptions(cmd *cobra.Command) vulcanizer.RepositoryAnalysisOptions {
+	blobCount, err := cmd.Flags().GetInt("blob-count")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: blob-count. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	maxBlobSize, err := cmd.Flags().GetString("max-blob-size")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: max-blob-size. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	timeout, err := cmd.Flags().GetString("analysis-timeout")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: analysis-timeout. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	return vulcanizer.RepositoryAnalysisOptions{
+		BlobCount:   blobCount,
+		MaxBlobSize: maxBlobSize,
+		Timeout:     timeout,
+	}
+}
+
+func setupAnalyzeSubCommand() {
+	cmdRepositoryAnalyze.Flags().StringP("repository", "r", "", "Snapshot repository to analyze (required)")
+	err := cmdRepositoryAnalyze.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	setupAnalysisFlags(cmdRepositoryAnalyze)
+
+	cmdRepository.AddCommand(cmdRepositoryAnalyze)
+}
+
+func setupDoctorSubCommand() {
+	cmdRepositoryDoctor.Flags().StringP("repository", "r", "", "Snapshot repository to check (required)")
+	err := cmdRepositoryDoctor.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	setupAnalysisFlags(cmdRepositoryDoctor)
+	cmdRepositoryDoctor.Flags().Bool("analyze", false, "Also analyze the repository, which writes and deletes test data in it")
+	cmdRepositoryDoctor.Flags().Bool("cleanup", false, "Also delete the data of the repository no longer referenced by any snapshot")
+
+	cmdRepository.AddCommand(cmdRepositoryDoctor)
+}
+
+func formatThroughput(bytesPerSecond float64) string {
+	return fmt.Sprintf("%s/s", humanizeBytes(int64(bytesPerSecond)))
+}
+
+func analysisRows(analysis vulcanizer.RepositoryAnalysis) [][]string {
+	issues := "none"
+	if len(analysis.IssuesDetected) > 0 {
+		issues = strings.Join(analysis.IssuesDetected, "\n")
+	}
+
+	return [][]string{
+		{"Coordinating node", analysis.CoordinatingNode},
+		{"Blobs", fmt.Sprintf("%d written, %d reads", analysis.WriteCount, analysis.ReadCount)},
+		{"Concurrency", fmt.Sprintf("%d writers, %d reading nodes", analysis.Concurrency, analysis.ReadNodeCount)},
+		{"Written", fmt.Sprintf("%s at %s", humanizeBytes(analysis.WriteBytes), formatThroughput(analysis.WriteThroughput()))},
+		{"Read", fmt.Sprintf("%s at %s", humanizeBytes(analysis.ReadBytes), formatThroughput(analysis.ReadThroughput()))},
+		{"Read wait", fmt.Sprintf("%s total, %s max", analysis.ReadWait, analysis.ReadMaxWait)},
+		{"Throttled", fmt.Sprintf("%s writing, %s reading", analysis.WriteThrottled, analysis.ReadThrottled)},
+		{"Listing", analysis.ListingElapsed.String()},
+		{"Deleting", analysis.DeleteElapsed.String()},
+		{"Issues detected", issues},
+	}
+}
+
 func setupRemoveSubCommand() {
 	cmdRepositoryRemove.Flags().StringP("repository", "r", "", "Snapshot repository to remove (required)")
 	err := cmdRepositoryRemove.MarkFlagRequired("repository")
@@ -205,3 +303,149 @@ var cmdRepositoryRemove = &cobra.Command{
 		fmt.Printf("Repository %s removed successfully.\n", repositoryName)
 	},
 }
+
+var cmdRepositoryCleanup = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Clean up the specified repository.",
+	Long:  `This command will remove the data of the repository no longer referenced by any snapshot.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		repository, err := cmd.Flags().GetString("repository")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: repository. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		result, err := v.CleanupRepository(repository)
+		if err != nil {
+			fmt.Printf("Error cleaning up repository %s: %s\n", repository, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Repository %s cleaned up: %d blobs deleted, %s freed.\n", repository, result.DeletedBlobs, humanizeBytes(result.DeletedBytes))
+	},
+}
+
+var cmdRepositoryAnalyze = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze the specified repository.",
+	Long:  `This command will write, read, list and delete blobs in the repository from every node to check the storage behaves correctly and measure its performance.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		repository, err := cmd.Flags().GetString("repository")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: repository. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		analysis, err := v.AnalyzeRepository(repository, getAnalysisOptions(cmd))
+		if err != nil {
+			fmt.Printf("Error analyzing repository %s: %s\n", repository, err)
+			os.Exit(1)
+		}
+
+		fmt.Println(renderTable(analysisRows(analysis), []string{"Analysis", repository}))
+		if len(analysis.IssuesDetected) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+var cmdRepositoryDoctor = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the health of the specified repository.",
+	Long:  `This command will verify the repository, then print a summary of the checks. Use --analyze and --cleanup to also analyze and clean up the repository, both of which write to it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		repository, err := cmd.Flags().GetString("repository")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: repository. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		analyze, err := cmd.Flags().GetBool("analyze")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: analyze. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		cleanup, err := cmd.Flags().GetBool("cleanup")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: cleanup. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		analysisOptions := getAnalysisOptions(cmd)
+		healthy := true
+		summary := [][]string{}
+
+		fmt.Printf("Verifying repository %s\n", repository)
+		verified, err := v.VerifyRepository(repository)
+		switch {
+		case err != nil:
+			summary = append(summary, []string{"Verify", "FAILED", err.Error()})
+		case !verified:
+			summary = append(summary, []string{"Verify", "FAILED", "Not verified"})
+		default:
+			summary = append(summary, []string{"Verify", "OK", "All nodes can access the repository"})
+		}
+
+		if err != nil || !verified {
+			healthy = false
+			if analyze || cleanup {
+				analyze = false
+				cleanup = false
+				fmt.Println("Skipping analysis and cleanup of an unverified repository")
+			}
+		}
+
+		if !analyze {
+			summary = append(summary, []string{"Analyze", "SKIPPED", ""})
+		} else {
+			fmt.Printf("Analyzing repository %s\n", repository)
+			analysis, err := v.AnalyzeRepository(repository, analysisOptions)
+			switch {
+			case err == vulcanizer.ErrRepositoryAnalysisUnsupported:
+				summary = append(summary, []string{"Analyze", "SKIPPED", err.Error()})
+			case err != nil:
+				healthy = false
+				summary = append(summary, []string{"Analyze", "FAILED", err.Error()})
+			case len(analysis.IssuesDetected) > 0:
+				healthy = false
+				summary = append(summary, []string{"Analyze", "FAILED", strings.Join(analysis.IssuesDetected, "\n")})
+			default:
+				summary = append(summary, []string{"Analyze", "OK", fmt.Sprintf("Write %s, read %s", formatThroughput(analysis.WriteThroughput()), formatThroughput(analysis.ReadThroughput()))})
+			}
+		}
+
+		if !cleanup {
+			summary = append(summary, []string{"Cleanup", "SKIPPED", ""})
+		} else {
+			fmt.Printf("Cleaning up repository %s\n", repository)
+			result, err := v.CleanupRepository(repository)
+			switch {
+			case err == vulcanizer.ErrRepositoryCleanupUnsupported:
+				summary = append(summary, []string{"Cleanup", "SKIPPED", err.Error()})
+			case err != nil:
+				healthy = false
+				summary = append(summary, []string{"Cleanup", "FAILED", err.Error()})
+			default:
+				summary = append(summary, []string{"Cleanup", "OK", fmt.Sprintf("%d unreferenced blobs deleted, %s freed", result.DeletedBlobs, humanizeBytes(result.DeletedBytes))})
+			}
+		}
+
+		fmt.Println(renderTable(summary, []string{"Check", "Result", "Details"}))
+		if !healthy {
+			fmt.Printf("Repository %s is NOT healthy.\n", repository)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Repository %s is healthy.\n", repository)
+	},
+}
@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdReroute.PersistentFlags().Bool("dry-run", false, "Only simulate the commands, do not change the cluster")
+	cmdReroute.PersistentFlags().Bool("explain", false, "Print the decisions of the allocation deciders for each command")
+	cmdReroute.PersistentFlags().Bool("yes", false, "Do not ask for confirmation before running commands that may lose data")
+
+	cmdRerouteMove.Flags().String("from", "", "Node the shard is on (required)")
+	cmdRerouteMove.Flags().String("to", "", "Node to move the shard to (required)")
+	setupRerouteShardFlags(cmdRerouteMove, "from", "to")
+
+	cmdRerouteCancel.Flags().String("node", "", "Node on which to cancel the allocation of the shard (required)")
+	cmdRerouteCancel.Flags().Bool("allow-primary", false, "Allow cancelling the allocation of a primary shard, which may lose data")
+	setupRerouteShardFlags(cmdRerouteCancel, "node")
+
+	for _, cmd := range []*cobra.Command{cmdRerouteAllocateReplica, cmdRerouteAllocateStalePrimary, cmdRerouteAllocateEmptyPrimary} {
+		cmd.Flags().String("node", "", "Node to allocate the shard to (required)")
+		setupRerouteShardFlags(cmd, "node")
+	}
+
+	cmdRerouteBatch.Flags().String("file", "", "JSON file with the reroute commands, in the Elasticsearch format {\"commands\": [...]} (required)")
+	err := cmdRerouteBatch.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Printf("Error binding file flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdReroute.AddCommand(cmdRerouteMove, cmdRerouteCancel, cmdRerouteAllocateReplica, cmdRerouteAllocateStalePrimary, cmdRerouteAllocateEmptyPrimary, cmdRerouteRetryFailed, cmdRerouteBatch)
+	rootCmd.AddCommand(cmdReroute)
+}
+
+// Adds the index and shard flags of a reroute subcommand and marks them and the given node flags required.
+func setupRerouteShardFlags(cmd *cobra.Command, nodeFlags ...string) {
+	cmd.Flags().StringP("index", "i", "", "Index of the shard (required)")
+	cmd.Flags().Int("shard", 0, "Number of the shard (required)")
+
+	for _, flag := range append([]string{"index", "shard"}, nodeFlags...) {
+		err := cmd.MarkFlagRequired(flag)
+		if err != nil {
+			fmt.Printf("Error binding %s flag: %s \n", flag, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Returns the value of the index and shard flags of a reroute subcommand.
+func getRerouteShard(cmd *cobra.Command) (string, int) {
+	index, err := cmd.Flags().GetString("index")
+	if err != nil {
+		fmt.Printf("Could not retrieve required argument: index. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	shard, err := cmd.Flags().GetInt("shard")
+	if err != nil {
+		fmt.Printf("Could not retrieve required argument: shard. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	return index, shard
+}
+
+// Returns the value of a string flag of a reroute subcommand.
+func getRerouteNode(cmd *cobra.Command, flag string) string {
+	node, err := cmd.Flags().GetString(flag)
+	if err != nil {
+		fmt.Printf("Could not retrieve required argument: %s. Error: %s\n", flag, err)
+		os.Exit(1)
+	}
+
+	return node
+}
+
+// Asks the user to type yes and returns whether they did.
+func confirm(prompt string) bool {
+	fmt.Printf("%s Type yes to continue: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// Runs the reroute commands with the group flags, asking for confirmation if any of them may lose data.
+// Also retries the allocation of shards that failed too many times if retryFailed is set.
+func runReroute(cmd *cobra.Command, commands []vulcanizer.RerouteCommand, retryFailed bool) {
+	v := getClient()
+
+	opts := vulcanizer.RerouteOptions{RetryFailed: retryFailed}
+	var yes bool
+	for flag, value := range map[string]*bool{
+		"dry-run": &opts.DryRun,
+		"explain": &opts.Explain,
+		"yes":     &yes,
+	} {
+		var err error
+		*value, err = cmd.Flags().GetBool(flag)
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+			os.Exit(1)
+		}
+	}
+
+	if !opts.DryRun && !yes {
+		dataLoss := []string{}
+		for _, command := range commands {
+			if command.DataLoss() {
+				dataLoss = append(dataLoss, command.Name())
+			}
+		}
+
+		if len(dataLoss) > 0 && !confirm(fmt.Sprintf("%s may lose data.", strings.Join(dataLoss, ", "))) {
+			fmt.Println("Aborted, no shard rerouted.")
+			os.Exit(1)
+		}
+	}
+
+	result, err := v.Reroute(commands, opts)
+	if err != nil {
+		fmt.Printf("Error rerouting shards: %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, explanation := range result.Explanations {
+		fmt.Printf("%s %v\n", explanation.Command, explanation.Parameters)
+		for _, decision := range explanation.Decisions {
+			fmt.Printf("  %s (%s): %s\n", decision.Decider, decision.Decision, decision.Explanation)
+		}
+	}
+
+	if opts.DryRun {
+		if retryFailed {
+			fmt.Println("Dry run of retrying failed allocations accepted, no shard rerouted.")
+			return
+		}
+
+		fmt.Printf("Dry run of %d commands accepted, no shard rerouted.\n", len(commands))
+		return
+	}
+
+	if retryFailed {
+		fmt.Println("Retrying failed allocations.")
+		return
+	}
+
+	fmt.Printf("Ran %d reroute commands.\n", len(commands))
+}
+
+var cmdReroute = &cobra.Command{
+	Use:   "reroute",
+	Short: "Move, cancel or force the allocation of shards.",
+	Long:  `Use the subcommands to run reroute commands. Use --dry-run and --explain to preview the decisions without changing anything. Commands that may lose data ask for confirmation unless --yes is given.`,
+}
+
+var cmdRerouteMove = &cobra.Command{
+	Use:   "move",
+	Short: "Move a shard to another node",
+	Long:  `This command moves a started shard from one node to another.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, shard := getRerouteShard(cmd)
+		runReroute(cmd, []vulcanizer.RerouteCommand{
+			{Move: &vulcanizer.MoveShard{Index: index, Shard: shard, FromNode: getRerouteNode(cmd, "from"), ToNode: getRerouteNode(cmd, "to")}},
+		}, false)
+	},
+}
+
+var cmdRerouteCancel = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel the allocation of a shard",
+	Long:  `This command cancels the allocation or recovery of a shard on a node. Cancelling a primary requires --allow-primary.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, shard := getRerouteShard(cmd)
+
+		allowPrimary, err := cmd.Flags().GetBool("allow-primary")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: allow-primary. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		runReroute(cmd, []vulcanizer.RerouteCommand{
+			{Cancel: &vulcanizer.CancelShard{Index: index, Shard: shard, Node: getRerouteNode(cmd, "node"), AllowPrimary: allowPrimary}},
+		}, false)
+	},
+}
+
+var cmdRerouteAllocateReplica = &cobra.Command{
+	Use:   "allocate-replica",
+	Short: "Allocate an unassigned replica to a node",
+	Long:  `This command allocates an unassigned replica shard to a node.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, shard := getRerouteShard(cmd)
+		runReroute(cmd, []vulcanizer.RerouteCommand{
+			{AllocateReplica: &vulcanizer.AllocateReplica{Index: index, Shard: shard, Node: getRerouteNode(cmd, "node")}},
+		}, false)
+	},
+}
+
+var cmdRerouteAllocateStalePrimary = &cobra.Command{
+	Use:   "allocate-stale-primary",
+	Short: "Allocate a stale copy of a primary to a node",
+	Long:  `This command promotes the stale copy of a shard found on a node to primary. Any more recent copy found later on is lost.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, shard := getRerouteShard(cmd)
+		runReroute(cmd, []vulcanizer.RerouteCommand{
+			{AllocateStalePrimary: vulcanizer.AllocateStalePrimary{Index: index, Shard: &shard, Node: getRerouteNode(cmd, "node"), AcceptDataLoss: true}},
+		}, false)
+	},
+}
+
+var cmdRerouteAllocateEmptyPrimary = &cobra.Command{
+	Use:   "allocate-empty-primary",
+	Short: "Allocate an empty primary to a node",
+	Long:  `This command allocates an empty primary shard to a node. All the data of the shard is lost.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, shard := getRerouteShard(cmd)
+		runReroute(cmd, []vulcanizer.RerouteCommand{
+			{AllocateEmptyPrimary: &vulcanizer.AllocateEmptyPrimary{Index: index, Shard: shard, Node: getRerouteNode(cmd, "node"), AcceptDataLoss: true}},
+		}, false)
+	},
+}
+
+var cmdRerouteRetryFailed = &cobra.Command{
+	Use:   "retry-failed",
+	Short: "Retry the allocation of shards that failed too many times",
+	Long:  `This command retries the allocation of shards blocked after too many failed allocation attempts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReroute(cmd, nil, true)
+	},
+}
+
+var cmdRerouteBatch = &cobra.Command{
+	Use:   "batch",
+	Short: "Run several reroute commands in one request",
+	Long:  `This command runs the reroute commands of a JSON file in one request. Elasticsearch rejects the whole batch if any command is not allowed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: file. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading file %s: %s\n", file, err)
+			os.Exit(1)
+		}
+
+		var req vulcanizer.RerouteRequest
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			fmt.Printf("Error parsing file %s: %s\n", file, err)
+			os.Exit(1)
+		}
+
+		if len(req.Commands) == 0 {
+			fmt.Printf("No reroute commands found in %s\n", file)
+			os.Exit(1)
+		}
+
+		for _, command := range req.Commands {
+			if command.Name() == "" {
+				fmt.Printf("Unsupported reroute command in %s\n", file)
+				os.Exit(1)
+			}
+		}
+
+		runReroute(cmd, req.Commands, false)
+	},
+}
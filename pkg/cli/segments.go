@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdSegments.Flags().Bool("report", false, "Display a per index report flagging force merge candidates instead of per shard segments")
+	cmdSegments.Flags().Int("max-segments", 50, "Flag indices having a shard with more segments than this (with --report)")
+	cmdSegments.Flags().Float64("max-deleted-ratio", 0.2, "Flag indices with a higher ratio of deleted documents than this (with --report)")
+	cmdSegments.Flags().Bool("candidates-only", false, "Only display force merge candidates (with --report)")
+
+	cmdIndices.AddCommand(cmdSegments)
+}
+
+var cmdSegments = &cobra.Command{
+	Use:   "segments",
+	Short: "Display the segments of the given index/indices",
+	Long:  `Given a name or pattern, shows segment counts, sizes and deleted documents per shard, or a per index report with --report`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		report, err := cmd.Flags().GetBool("report")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: report. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if !report {
+			shards, err := v.GetIndexSegments(args[0])
+			if err != nil {
+				fmt.Printf("Error getting segments: %s - %s\n", args[0], err)
+				os.Exit(1)
+			}
+
+			header := []string{"Index", "Shard", "Primary", "Node", "Committed", "Searchable", "Docs", "Deleted Docs", "Size"}
+			rows := [][]string{}
+			for _, shard := range shards {
+				docs, deletedDocs, sizeBytes := shard.Totals()
+				row := []string{
+					shard.Index,
+					strconv.Itoa(shard.Shard),
+					strconv.FormatBool(shard.Primary),
+					shard.Node,
+					strconv.Itoa(shard.NumCommittedSegments),
+					strconv.Itoa(shard.NumSearchSegments),
+					strconv.Itoa(docs),
+					strconv.Itoa(deletedDocs),
+					humanizeBytes(sizeBytes),
+				}
+				rows = append(rows, row)
+			}
+
+			fmt.Println(renderTable(rows, header))
+			return
+		}
+
+		maxSegments, err := cmd.Flags().GetInt("max-segments")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: max-segments. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		maxDeletedRatio, err := cmd.Flags().GetFloat64("max-deleted-ratio")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: max-deleted-ratio. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		candidatesOnly, err := cmd.Flags().GetBool("candidates-only")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: candidates-only. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		reports, err := v.GetSegmentReport(args[0], vulcanizer.SegmentReportOptions{
+			MaxSegmentsPerShard: maxSegments,
+			MaxDeletedDocsRatio: maxDeletedRatio,
+		})
+		if err != nil {
+			fmt.Printf("Error getting segment report: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		header := []string{"Index", "Primary Shards", "Segments", "Max Per Shard", "Docs", "Deleted %", "Size", "Force Merge", "Reasons"}
+		rows := [][]string{}
+		for _, r := range reports {
+			if candidatesOnly && !r.ForceMergeCandidate {
+				continue
+			}
+
+			row := []string{
+				r.Index,
+				strconv.Itoa(r.Shards),
+				strconv.Itoa(r.Segments),
+				strconv.Itoa(r.MaxSegmentsPerShard),
+				strconv.Itoa(r.Docs),
+				fmt.Sprintf("%.1f", r.DeletedDocsRatio*100),
+				humanizeBytes(r.SizeBytes),
+				strconv.FormatBool(r.ForceMergeCandidate),
+				strings.Join(r.Reasons, "\n"),
+			}
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
@@ -3,7 +3,9 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/github/vulcanizer"
 	"github.com/spf13/cobra"
 )
 
@@ -16,6 +18,15 @@ func init() {
 	cmdShardsRecovery.Flags().BoolVar(&activeOnly, "active", true, "Only display active recoveries")
 
 	cmdShards.AddCommand(cmdShardsRecovery)
+
+	cmdShardsExplain.Flags().StringP("index", "i", "", "Index of the shard to explain. Explains the first unassigned shard if not given")
+	cmdShardsExplain.Flags().Int("shard", 0, "Number of the shard to explain")
+	cmdShardsExplain.Flags().Bool("primary", false, "Explain the primary rather than a replica of the shard")
+	cmdShardsExplain.Flags().String("current-node", "", "Explain the copy of the shard on this node")
+	cmdShards.AddCommand(cmdShardsExplain)
+
+	cmdShardsUnassigned.Flags().Bool("explain", false, "Explain every unassigned shard, grouped by allocation outcome, with a suggested fix")
+	cmdShards.AddCommand(cmdShardsUnassigned)
 	rootCmd.AddCommand(cmdShards)
 }
 
@@ -94,3 +105,220 @@ var cmdShardsRecovery = &cobra.Command{
 		fmt.Println(table)
 	},
 }
+
+// Returns the deciders of a node decision as "decider: explanation" lines.
+func describeDeciders(deciders []vulcanizer.AllocationDecider) string {
+	lines := make([]string, 0, len(deciders))
+	for _, decider := range deciders {
+		lines = append(lines, fmt.Sprintf("%s (%s): %s", decider.Decider, decider.Decision, decider.Explanation))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Prints a condensed view of an allocation explanation.
+func printAllocationExplanation(explanation vulcanizer.AllocationExplanation) {
+	shardType := "replica"
+	if explanation.Primary {
+		shardType = "primary"
+	}
+	fmt.Printf("Shard %d of %s (%s) is %s", explanation.Shard, explanation.Index, shardType, explanation.CurrentState)
+	if explanation.CurrentNode != nil {
+		fmt.Printf(" on %s", explanation.CurrentNode.Name)
+	}
+	fmt.Println()
+
+	if info := explanation.UnassignedInfo; info != nil {
+		fmt.Printf("Unassigned since %s because of %s", info.At, info.Reason)
+		if info.FailedAllocationAttempts > 0 {
+			fmt.Printf(" after %d failed allocation attempts", info.FailedAllocationAttempts)
+		}
+		fmt.Println()
+		if info.Details != "" {
+			fmt.Printf("Details: %s\n", info.Details)
+		}
+	}
+
+	if explanation.CanAllocate != "" {
+		fmt.Printf("Can allocate: %s. %s\n", explanation.CanAllocate, explanation.AllocateExplanation)
+	}
+	if explanation.CanRemainOnCurrentNode != "" {
+		fmt.Printf("Can remain on current node: %s\n", explanation.CanRemainOnCurrentNode)
+		for _, decider := range explanation.CanRemainDecisions {
+			fmt.Printf("  %s (%s): %s\n", decider.Decider, decider.Decision, decider.Explanation)
+		}
+	}
+	if explanation.CanMoveToOtherNode != "" {
+		fmt.Printf("Can move to other node: %s. %s\n", explanation.CanMoveToOtherNode, explanation.MoveExplanation)
+	}
+	if explanation.CanRebalanceCluster != "" {
+		fmt.Printf("Can rebalance: %s (cluster), %s (to other node). %s\n", explanation.CanRebalanceCluster, explanation.CanRebalanceToOtherNode, explanation.RebalanceExplanation)
+	}
+
+	if len(explanation.NodeAllocationDecisions) == 0 {
+		return
+	}
+
+	header := []string{"Node", "Decision", "Copy Found", "Deciders"}
+	rows := [][]string{}
+	for _, decision := range explanation.NodeAllocationDecisions {
+		found := "-"
+		if decision.Store != nil {
+			found = fmt.Sprintf("%t", decision.Store.Found)
+			if decision.Store.Found && !decision.Store.InSync {
+				found = "stale"
+			}
+		}
+
+		rows = append(rows, []string{
+			decision.NodeName,
+			decision.NodeDecision,
+			found,
+			describeDeciders(decision.Deciders),
+		})
+	}
+
+	fmt.Println(renderTable(rows, header))
+}
+
+var cmdShardsExplain = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain the allocation of a shard",
+	Long:  `This command explains why a shard is unassigned or where it can be allocated, with the decision for every node. Without --index it explains the first unassigned shard of the cluster.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		index, err := cmd.Flags().GetString("index")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: index. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		shard, err := cmd.Flags().GetInt("shard")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: shard. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		primary, err := cmd.Flags().GetBool("primary")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: primary. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		currentNode, err := cmd.Flags().GetString("current-node")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: current-node. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		var req *vulcanizer.ClusterAllocationExplainRequest
+		if index != "" {
+			req = &vulcanizer.ClusterAllocationExplainRequest{
+				Index:       index,
+				Shard:       &shard,
+				Primary:     primary,
+				CurrentNode: currentNode,
+			}
+		}
+
+		explanation, err := v.GetAllocationExplanation(req)
+		if err != nil {
+			fmt.Printf("Error explaining shard allocation: %s\n", err)
+			os.Exit(1)
+		}
+
+		printAllocationExplanation(explanation)
+	},
+}
+
+// Returns a human readable suggestion for fixing an unassigned shard.
+func describeRemediation(shard vulcanizer.UnassignedShard) string {
+	switch shard.Remediation {
+	case vulcanizer.RemediationWait:
+		return "wait, allocation is throttled or delayed"
+	case vulcanizer.RemediationRetryFailed:
+		return "retry failed allocations (RerouteWithRetryFailed)"
+	case vulcanizer.RemediationAllocateStalePrimary:
+		return fmt.Sprintf("allocate the stale copy on %s, accepting data loss (AllocateStalePrimaryShard)", shard.RemediationNode)
+	default:
+		return "-"
+	}
+}
+
+var cmdShardsUnassigned = &cobra.Command{
+	Use:   "unassigned",
+	Short: "List unassigned shards",
+	Long:  `This command lists the unassigned shards of the cluster with the reason they became unassigned. Use --explain to get why they cannot be allocated, grouped by the deciders blocking them, and a suggested fix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		explain, err := cmd.Flags().GetBool("explain")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: explain. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if !explain {
+			shards, err := v.GetShards(nil)
+			if err != nil {
+				fmt.Printf("Error retrieving shard information: %s \n", err)
+				os.Exit(1)
+			}
+
+			header := []string{"Index", "Shard", "Type", "Reason"}
+			rows := [][]string{}
+			for _, shard := range shards {
+				if shard.State != "UNASSIGNED" {
+					continue
+				}
+				rows = append(rows, []string{shard.Index, shard.Shard, shard.Type, shard.UnassignedReason})
+			}
+
+			if len(rows) == 0 {
+				fmt.Println("No unassigned shards.")
+				return
+			}
+
+			fmt.Println(renderTable(rows, header))
+			return
+		}
+
+		groups, err := v.ExplainUnassignedShards()
+		if err != nil {
+			fmt.Printf("Error explaining unassigned shards: %s\n", err)
+			os.Exit(1)
+		}
+
+		if len(groups) == 0 {
+			fmt.Println("No unassigned shards.")
+			return
+		}
+
+		for _, group := range groups {
+			deciders := "none"
+			if len(group.Deciders) > 0 {
+				deciders = strings.Join(group.Deciders, ", ")
+			}
+			fmt.Printf("%d shards: can allocate %s, blocking deciders: %s\n", len(group.Shards), group.CanAllocate, deciders)
+			if explanation := group.Shards[0].Explanation.AllocateExplanation; explanation != "" {
+				fmt.Println(explanation)
+			}
+
+			header := []string{"Index", "Shard", "Type", "Reason", "Suggestion"}
+			rows := [][]string{}
+			for _, shard := range group.Shards {
+				rows = append(rows, []string{
+					shard.Shard.Index,
+					shard.Shard.Shard,
+					shard.Shard.Type,
+					shard.Shard.UnassignedReason,
+					describeRemediation(shard),
+				})
+			}
+			fmt.Println(renderTable(rows, header))
+		}
+	},
+}
@@ -0,0 +1,281 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdSLMPut.Flags().String("file", "", "Path to a JSON file holding the policy body, i.e. {\"schedule\": ..., \"name\": ..., \"repository\": ...} (required)")
+	err := cmdSLMPut.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Printf("Error binding file configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSLM.AddCommand(cmdSLMList, cmdSLMGet, cmdSLMPut, cmdSLMDelete, cmdSLMExecute, cmdSLMStats, cmdSLMRetention)
+	rootCmd.AddCommand(cmdSLM)
+}
+
+func formatMillis(millis int64) string {
+	if millis == 0 {
+		return ""
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+func formatSLMInvocation(invocation *vulcanizer.SLMInvocation) string {
+	if invocation == nil {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s)", invocation.Time().Format(time.RFC3339), invocation.SnapshotName)
+}
+
+var cmdSLM = &cobra.Command{
+	Use:   "slm",
+	Short: "Interact with snapshot lifecycle management.",
+	Long:  `Use the list, get, put, delete, execute, stats and retention subcommands.`,
+}
+
+var cmdSLMList = &cobra.Command{
+	Use:   "list",
+	Short: "List the SLM policies of the cluster",
+	Long:  `Show the SLM policies of the cluster, or the given one, with their last successful and failed snapshots.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		policies, err := v.GetSLMPolicies(name)
+		if err != nil {
+			fmt.Printf("Error getting SLM policies: %s\n", err)
+			os.Exit(1)
+		}
+
+		header := []string{"Name", "Repository", "Schedule", "Next Execution", "Last Success", "Last Failure"}
+		rows := [][]string{}
+		for _, p := range policies {
+			row := []string{
+				p.Policy.Name,
+				p.Policy.Repository,
+				p.Policy.Schedule,
+				formatMillis(p.NextExecutionMillis),
+				formatSLMInvocation(p.LastSuccess),
+				formatSLMInvocation(p.LastFailure),
+			}
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdSLMGet = &cobra.Command{
+	Use:   "get",
+	Short: "Display the details of the given SLM policy",
+	Long:  `Given a policy name, shows its configuration, history and statistics.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		policies, err := v.GetSLMPolicies(args[0])
+		if err != nil {
+			fmt.Printf("Error getting SLM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		if len(policies) == 0 {
+			fmt.Printf("No SLM policy found: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		p := policies[0]
+		config, err := json.Marshal(p.Policy.Config)
+		if err != nil {
+			fmt.Printf("Error formatting SLM policy config: %s\n", err)
+			os.Exit(1)
+		}
+
+		retention := ""
+		if p.Policy.Retention != nil {
+			retention = fmt.Sprintf("expire after %s, min %d, max %d", p.Policy.Retention.ExpireAfter, p.Policy.Retention.MinCount, p.Policy.Retention.MaxCount)
+		}
+
+		lastFailureDetails := ""
+		if p.LastFailure != nil {
+			lastFailureDetails = p.LastFailure.Details
+		}
+
+		rows := [][]string{
+			{"Name", p.Policy.Name},
+			{"Version", strconv.Itoa(p.Version)},
+			{"Modified", formatMillis(p.ModifiedDateMillis)},
+			{"Snapshot name", p.Policy.SnapshotName},
+			{"Repository", p.Policy.Repository},
+			{"Schedule", p.Policy.Schedule},
+			{"Config", string(config)},
+			{"Retention", retention},
+			{"Next execution", formatMillis(p.NextExecutionMillis)},
+			{"In progress", p.InProgress},
+			{"Last success", formatSLMInvocation(p.LastSuccess)},
+			{"Last failure", formatSLMInvocation(p.LastFailure)},
+			{"Last failure details", lastFailureDetails},
+			{"Snapshots taken", strconv.Itoa(p.Stats.SnapshotsTaken)},
+			{"Snapshots failed", strconv.Itoa(p.Stats.SnapshotsFailed)},
+			{"Snapshots deleted", strconv.Itoa(p.Stats.SnapshotsDeleted)},
+			{"Snapshot deletion failures", strconv.Itoa(p.Stats.SnapshotDeletionFailures)},
+		}
+
+		fmt.Println(renderTable(rows, []string{"Policy", ""}))
+	},
+}
+
+var cmdSLMPut = &cobra.Command{
+	Use:   "put",
+	Short: "Create or update the given SLM policy",
+	Long:  `Given a policy name and a JSON file holding its body, creates or replaces the policy.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: file. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading policy file: %s\n", err)
+			os.Exit(1)
+		}
+
+		var policy vulcanizer.SLMPolicy
+		err = json.Unmarshal(body, &policy)
+		if err != nil {
+			fmt.Printf("Error parsing policy file: %s\n", err)
+			os.Exit(1)
+		}
+		policy.Name = args[0]
+
+		err = v.PutSLMPolicy(policy)
+		if err != nil {
+			fmt.Printf("Error putting SLM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("SLM policy %s saved successfully.\n", args[0])
+	},
+}
+
+var cmdSLMDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the given SLM policy",
+	Long:  `Given a policy name, deletes the policy. Snapshots already taken by the policy are kept.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.DeleteSLMPolicy(args[0])
+		if err != nil {
+			fmt.Printf("Error deleting SLM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("SLM policy %s deleted successfully.\n", args[0])
+	},
+}
+
+var cmdSLMExecute = &cobra.Command{
+	Use:   "execute",
+	Short: "Take a snapshot with the given SLM policy now",
+	Long:  `Given a policy name, takes a snapshot with it right away, outside of its schedule.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		snapshot, err := v.ExecuteSLMPolicy(args[0])
+		if err != nil {
+			fmt.Printf("Error executing SLM policy: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Snapshot %s started by SLM policy %s.\n", snapshot, args[0])
+	},
+}
+
+var cmdSLMStats = &cobra.Command{
+	Use:   "stats",
+	Short: "Display the SLM statistics of the cluster",
+	Long:  `This command shows the snapshot and retention statistics of SLM, overall and per policy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		stats, err := v.GetSLMStats()
+		if err != nil {
+			fmt.Printf("Error getting SLM stats: %s\n", err)
+			os.Exit(1)
+		}
+
+		rows := [][]string{
+			{"Retention runs", strconv.Itoa(stats.RetentionRuns)},
+			{"Retention failed", strconv.Itoa(stats.RetentionFailed)},
+			{"Retention timed out", strconv.Itoa(stats.RetentionTimedOut)},
+			{"Retention deletion time", (time.Duration(stats.RetentionDeletionTimeMillis) * time.Millisecond).String()},
+			{"Snapshots taken", strconv.Itoa(stats.TotalSnapshotsTaken)},
+			{"Snapshots failed", strconv.Itoa(stats.TotalSnapshotsFailed)},
+			{"Snapshots deleted", strconv.Itoa(stats.TotalSnapshotsDeleted)},
+			{"Snapshot deletion failures", strconv.Itoa(stats.TotalSnapshotDeletionFailures)},
+		}
+		fmt.Println(renderTable(rows, []string{"SLM", ""}))
+
+		header := []string{"Policy", "Taken", "Failed", "Deleted", "Deletion Failures"}
+		rows = [][]string{}
+		for _, p := range stats.PolicyStats {
+			row := []string{
+				p.Policy,
+				strconv.Itoa(p.SnapshotsTaken),
+				strconv.Itoa(p.SnapshotsFailed),
+				strconv.Itoa(p.SnapshotsDeleted),
+				strconv.Itoa(p.SnapshotDeletionFailures),
+			}
+			rows = append(rows, row)
+		}
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdSLMRetention = &cobra.Command{
+	Use:   "retention",
+	Short: "Run the SLM retention now",
+	Long:  `This command runs the retention of all SLM policies right away, deleting expired snapshots.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		err := v.ExecuteSLMRetention()
+		if err != nil {
+			fmt.Printf("Error executing SLM retention: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("SLM retention started.")
+	},
+}
@@ -3,9 +3,11 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/github/vulcanizer"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +17,9 @@ func init() {
 	setupListSubCommand()
 	setupCreateSubCommand()
 	setupDeleteSubCommand()
+	setupPruneSubCommand()
+	setupCloneSubCommand()
+	setupCopySubCommand()
 
 	rootCmd.AddCommand(cmdSnapshot)
 }
@@ -39,6 +44,9 @@ func setupStatusSubCommand() {
 		fmt.Printf("Error binding repository configuration flag: %s \n", err)
 		os.Exit(1)
 	}
+
+	cmdSnapshotStatus.Flags().Bool("shards", false, "Display the stage, files and bytes copied of every shard")
+	cmdSnapshotStatus.Flags().Bool("diagnose", false, "Correlate shard failures with the state of the cluster and suggest whether to retry")
 	cmdSnapshot.AddCommand(cmdSnapshotStatus)
 }
 
@@ -61,6 +69,10 @@ func setupCreateSubCommand() {
 
 	cmdSnapshotCreate.Flags().StringSliceP("index", "i", []string{}, "Snapshot specific indices on the cluster. Can be repeated.")
 
+	cmdSnapshotCreate.Flags().Bool("wait", false, "Wait for the snapshot to complete, printing its progress")
+	cmdSnapshotCreate.Flags().Duration("poll-interval", 10*time.Second, "How often to check on the snapshot when waiting")
+	cmdSnapshotCreate.Flags().Duration("timeout", 0, "How long to wait for the snapshot to complete. No limit if 0")
+
 	cmdSnapshot.AddCommand(cmdSnapshotCreate)
 }
 
@@ -81,6 +93,97 @@ func setupDeleteSubCommand() {
 
 	cmdSnapshot.AddCommand(cmdSnapshotDelete)
 }
+func setupPruneSubCommand() {
+	cmdSnapshotPrune.Flags().StringP("repository", "r", "", "Snapshot repository to prune (required)")
+	err := cmdSnapshotPrune.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotPrune.Flags().Int("keep-last", 0, "Keep the N most recent snapshots")
+	cmdSnapshotPrune.Flags().Int("keep-daily", 0, "Keep the most recent snapshot of each day for this many days")
+	cmdSnapshotPrune.Flags().Int("keep-weekly", 0, "Keep the most recent snapshot of each week for this many weeks")
+	cmdSnapshotPrune.Flags().Int("min-count", 0, "Keep at least this many snapshots")
+	cmdSnapshotPrune.Flags().Int("max-count", 0, "Keep at most this many snapshots. Unlimited if 0")
+	cmdSnapshotPrune.Flags().String("name-pattern", "", "Only prune snapshots whose name matches this regular expression")
+	cmdSnapshotPrune.Flags().Bool("delete-failed", false, "Also delete FAILED and INCOMPATIBLE snapshots")
+	cmdSnapshotPrune.Flags().Bool("dry-run", false, "Only print the plan, do not delete any snapshot. Overrides --yes")
+	cmdSnapshotPrune.Flags().Bool("yes", false, "Delete the snapshots of the plan. Only the plan is printed otherwise")
+	cmdSnapshotPrune.Flags().Duration("pause", 30*time.Second, "How long to wait between deletions")
+
+	cmdSnapshot.AddCommand(cmdSnapshotPrune)
+}
+
+func setupCloneSubCommand() {
+	cmdSnapshotClone.Flags().StringP("snapshot", "s", "", "Snapshot to clone (required)")
+	err := cmdSnapshotClone.MarkFlagRequired("snapshot")
+	if err != nil {
+		fmt.Printf("Error binding snapshot configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotClone.Flags().StringP("repository", "r", "", "Snapshot repository holding the snapshot (required)")
+	err = cmdSnapshotClone.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotClone.Flags().String("target", "", "Name of the new snapshot (required)")
+	err = cmdSnapshotClone.MarkFlagRequired("target")
+	if err != nil {
+		fmt.Printf("Error binding target configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotClone.Flags().StringSliceP("index", "i", []string{}, "Index to clone into the new snapshot. Can be repeated. (required)")
+	err = cmdSnapshotClone.MarkFlagRequired("index")
+	if err != nil {
+		fmt.Printf("Error binding index configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshot.AddCommand(cmdSnapshotClone)
+}
+
+func setupCopySubCommand() {
+	cmdSnapshotCopy.Flags().StringP("snapshot", "s", "", "Snapshot to copy (required)")
+	err := cmdSnapshotCopy.MarkFlagRequired("snapshot")
+	if err != nil {
+		fmt.Printf("Error binding snapshot configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotCopy.Flags().StringP("repository", "r", "", "Snapshot repository holding the snapshot (required)")
+	err = cmdSnapshotCopy.MarkFlagRequired("repository")
+	if err != nil {
+		fmt.Printf("Error binding repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotCopy.Flags().String("target-repository", "", "Snapshot repository to copy the snapshot to (required)")
+	err = cmdSnapshotCopy.MarkFlagRequired("target-repository")
+	if err != nil {
+		fmt.Printf("Error binding target-repository configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotCopy.Flags().String("scratch-cluster", "", "Cluster of the configuration file to restore the indices into and take the new snapshot from, with access to both repositories (required)")
+	err = cmdSnapshotCopy.MarkFlagRequired("scratch-cluster")
+	if err != nil {
+		fmt.Printf("Error binding scratch-cluster configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdSnapshotCopy.Flags().String("target-snapshot", "", "Name of the new snapshot. Defaults to the name of the copied snapshot")
+	cmdSnapshotCopy.Flags().StringSliceP("index", "i", []string{}, "Index or index pattern to copy. Can be repeated. Defaults to all indices")
+	cmdSnapshotCopy.Flags().Bool("delete-restored", false, "Delete the restored indices from the scratch cluster once the copy is verified")
+	cmdSnapshotCopy.Flags().Duration("poll-interval", 10*time.Second, "How often to check on the restore and the snapshot")
+
+	cmdSnapshot.AddCommand(cmdSnapshotCopy)
+}
+
 func setupListSubCommand() {
 	cmdSnapshotList.Flags().StringP("repository", "r", "", "Snapshot repository to query (required)")
 	err := cmdSnapshotList.MarkFlagRequired("repository")
@@ -88,9 +191,31 @@ func setupListSubCommand() {
 		fmt.Printf("Error binding repository configuration flag: %s \n", err)
 		os.Exit(1)
 	}
+
+	cmdSnapshotList.Flags().String("state", "", "Only list snapshots in this state, i.e. SUCCESS, PARTIAL or FAILED")
+	cmdSnapshotList.Flags().String("since", "", "Only list snapshots started since this duration ago, i.e. 72h, or this date, i.e. 2021-03-01")
+	cmdSnapshotList.Flags().String("index", "", "Only list snapshots containing an index matching this name or pattern")
+	cmdSnapshotList.Flags().String("slm-policy", "", "Only list snapshots taken by this SLM policy")
+	cmdSnapshotList.Flags().Int("limit", 10, "Number of most recent snapshots to list. All snapshots if 0")
 	cmdSnapshot.AddCommand(cmdSnapshotList)
 }
 
+func parseSince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	if duration, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	if date, err := time.Parse(time.RFC3339, since); err == nil {
+		return date, nil
+	}
+
+	return time.Parse("2006-01-02", since)
+}
+
 func setupRestoreSubCommand() {
 	cmdSnapshotRestore.Flags().StringP("snapshot", "s", "", "Snapshot name to query (required)")
 	err := cmdSnapshotRestore.MarkFlagRequired("snapshot")
@@ -107,22 +232,95 @@ func setupRestoreSubCommand() {
 	}
 
 	cmdSnapshotRestore.Flags().StringP("prefix", "", "restored_", "What to prefix on the restored index")
-	err = cmdSnapshotRestore.MarkFlagRequired("prefix")
-	if err != nil {
-		fmt.Printf("Error binding prefix configuration flag: %s \n", err)
-		os.Exit(1)
-	}
 
-	cmdSnapshotRestore.Flags().StringP("index", "i", "", "Which index to restore from the snapshot")
+	cmdSnapshotRestore.Flags().StringP("index", "i", "", "Which index, index pattern or data stream to restore from the snapshot")
 	err = cmdSnapshotRestore.MarkFlagRequired("index")
 	if err != nil {
 		fmt.Printf("Error binding index configuration flag: %s \n", err)
 		os.Exit(1)
 	}
 
+	cmdSnapshotRestore.Flags().String("rename-pattern", "", "Regular expression to rename restored indices and data streams with. Takes precedence over --prefix")
+	cmdSnapshotRestore.Flags().String("rename-replacement", "", "Replacement for --rename-pattern, i.e. restored_$1")
+	cmdSnapshotRestore.Flags().Bool("in-place", false, "Restore over the existing index of the same name, closing it first. Takes precedence over renaming")
+	cmdSnapshotRestore.Flags().Bool("include-global-state", false, "Also restore the cluster state, i.e. persistent settings, templates and ILM policies")
+	cmdSnapshotRestore.Flags().Bool("partial", false, "Restore indices with missing primary shards instead of failing")
+	cmdSnapshotRestore.Flags().Bool("no-aliases", false, "Do not restore the aliases of restored indices")
+	cmdSnapshotRestore.Flags().StringSlice("ignore-index-settings", []string{}, "Index settings to reset to their defaults on restored indices. Can be repeated.")
+	cmdSnapshotRestore.Flags().StringSlice("feature-states", []string{}, "Feature states to restore, i.e. security. Can be repeated.")
+
+	cmdSnapshotRestore.Flags().Bool("wait", false, "Wait for the restore to complete, printing its progress")
+	cmdSnapshotRestore.Flags().Duration("poll-interval", 10*time.Second, "How often to check on the restore when waiting")
+	cmdSnapshotRestore.Flags().Duration("timeout", 0, "How long to wait for the restore to complete. No limit if 0")
+
 	cmdSnapshot.AddCommand(cmdSnapshotRestore)
 }
 
+func getRestoreOptions(cmd *cobra.Command) vulcanizer.RestoreOptions {
+	renamePattern, err := cmd.Flags().GetString("rename-pattern")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: rename-pattern. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	renameReplacement, err := cmd.Flags().GetString("rename-replacement")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: rename-replacement. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if (renamePattern == "") != (renameReplacement == "") {
+		fmt.Println("Both --rename-pattern and --rename-replacement are required to rename restored indices.")
+		os.Exit(1)
+	}
+
+	includeGlobalState, err := cmd.Flags().GetBool("include-global-state")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: include-global-state. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	partial, err := cmd.Flags().GetBool("partial")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: partial. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	noAliases, err := cmd.Flags().GetBool("no-aliases")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: no-aliases. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	ignoreIndexSettings, err := cmd.Flags().GetStringSlice("ignore-index-settings")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: ignore-index-settings. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	featureStates, err := cmd.Flags().GetStringSlice("feature-states")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: feature-states. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	opts := vulcanizer.RestoreOptions{
+		RenamePattern:       renamePattern,
+		RenameReplacement:   renameReplacement,
+		IncludeGlobalState:  includeGlobalState,
+		Partial:             partial,
+		IgnoreIndexSettings: ignoreIndexSettings,
+		FeatureStates:       featureStates,
+	}
+
+	if noAliases {
+		includeAliases := false
+		opts.IncludeAliases = &includeAliases
+	}
+
+	return opts
+}
+
 var cmdSnapshotStatus = &cobra.Command{
 	Use:   "status",
 	Short: "Display info about a snapshot.",
@@ -162,13 +360,104 @@ var cmdSnapshotStatus = &cobra.Command{
 		}
 
 		fmt.Println(renderTable(results, []string{"Metric", "Value"}))
+
+		shards, err := cmd.Flags().GetBool("shards")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: shards. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if shards {
+			printSnapshotShards(v, repository, snapshotName)
+		}
+
+		diagnose, err := cmd.Flags().GetBool("diagnose")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: diagnose. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		if diagnose {
+			printSnapshotDiagnosis(v, repository, snapshotName)
+		}
 	},
 }
 
+func printSnapshotShards(v *vulcanizer.Client, repository, snapshotName string) {
+	status, err := v.GetSnapshotDetailedStatus(repository, snapshotName)
+	if err != nil {
+		fmt.Printf("Error getting snapshot shards. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	header := []string{"Index", "Shard", "Stage", "Node", "Files", "Bytes", "Started", "Elapsed", "Reason"}
+	rows := [][]string{}
+	for _, index := range status.Indices {
+		for _, shard := range index.Shards {
+			row := []string{
+				shard.Index,
+				strconv.Itoa(shard.Shard),
+				shard.Stage,
+				shard.NodeID,
+				fmt.Sprintf("%d/%d", shard.Stats.FilesCopied, shard.Stats.FilesToCopy),
+				fmt.Sprintf("%s/%s", humanizeBytes(shard.Stats.BytesCopied), humanizeBytes(shard.Stats.BytesToCopy)),
+				shard.Stats.StartTime.Format(time.RFC3339),
+				shard.Stats.Elapsed.Round(time.Second).String(),
+				shard.Reason,
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	fmt.Println(renderTable(rows, header))
+}
+
+func printSnapshotDiagnosis(v *vulcanizer.Client, repository, snapshotName string) {
+	diagnosis, err := v.DiagnoseSnapshot(repository, snapshotName)
+	if err != nil {
+		fmt.Printf("Error diagnosing snapshot. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(diagnosis.Failures) == 0 {
+		fmt.Println("No shard failures to diagnose.")
+		return
+	}
+
+	fmt.Printf("The cluster is %s.\n", diagnosis.ClusterStatus)
+
+	header := []string{"Index", "Shard", "Node", "Primary", "Reason", "Action", "Suggestion"}
+	rows := [][]string{}
+	for _, d := range diagnosis.Failures {
+		node := d.NodeName
+		if !d.NodePresent {
+			node = fmt.Sprintf("%s (left)", d.NodeID)
+		}
+
+		action := "investigate"
+		if d.Retry {
+			action = "retry"
+		}
+
+		row := []string{
+			d.Index,
+			strconv.Itoa(d.Shard),
+			node,
+			d.PrimaryState,
+			d.Reason,
+			action,
+			d.Suggestion,
+		}
+		rows = append(rows, row)
+	}
+
+	fmt.Println(renderTable(rows, header))
+}
+
 var cmdSnapshotRestore = &cobra.Command{
 	Use:   "restore",
 	Short: "Restore a snapshot.",
-	Long:  `This command will restore a specific index from a snapshot to the cluster.`,
+	Long:  `This command will restore a specific index from a snapshot to the cluster, under a new name or in place over the existing closed index.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		v := getClient()
@@ -197,20 +486,89 @@ var cmdSnapshotRestore = &cobra.Command{
 			os.Exit(1)
 		}
 
-		err = v.RestoreSnapshotIndices(repository, snapshotName, []string{index}, prefix, nil)
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: wait. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		pollInterval, err := cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: poll-interval. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: timeout. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts := getRestoreOptions(cmd)
+
+		// The restored indices to watch when waiting. A custom rename pattern
+		// can't be applied to index patterns, so all recoveries from the snapshot are watched.
+		var restoredIndices []string
+
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: in-place. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		restoreStart := time.Now()
+		if inPlace {
+			err = v.RestoreSnapshotInPlace(repository, snapshotName, index, opts)
+			restoredIndices = []string{index}
+		} else {
+			if opts.RenamePattern == "" {
+				opts.RenamePattern = "(.+)"
+				opts.RenameReplacement = fmt.Sprintf("%s$1", prefix)
+				restoredIndices = []string{prefix + index}
+			}
+
+			opts.Indices = []string{index}
+			err = v.RestoreSnapshot(repository, snapshotName, opts)
+		}
 		if err != nil {
 			fmt.Printf("Error while calling restore snapshot API. Error: %s\n", err)
 			os.Exit(1)
 		}
 
 		fmt.Println("Restore operation called successfully.")
+		if !wait {
+			return
+		}
+
+		err = v.WaitForRestore(repository, snapshotName, vulcanizer.RestoreWaitOptions{Indices: restoredIndices, StartedAfter: restoreStart, PollInterval: pollInterval, Timeout: timeout}, func(recoveries []vulcanizer.ShardRecovery) {
+			if len(recoveries) == 0 {
+				fmt.Println("Waiting for the restore to start")
+				return
+			}
+
+			var done, bytesRecovered, bytesTotal int
+			for _, r := range recoveries {
+				if r.Stage == "done" {
+					done++
+				}
+				bytesRecovered += r.BytesRecovered
+				bytesTotal += r.BytesTotal
+			}
+			fmt.Printf("Restore: %d/%d shards done, %s of %s recovered\n", done, len(recoveries), humanizeBytes(int64(bytesRecovered)), humanizeBytes(int64(bytesTotal)))
+		})
+		if err != nil {
+			fmt.Printf("Error waiting for restore: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Restore completed.")
 	},
 }
 
 var cmdSnapshotList = &cobra.Command{
 	Use:   "list",
 	Short: "Display the snapshots of the cluster.",
-	Long:  `List the 10 most recent snapshots of the given repository`,
+	Long:  `List the most recent snapshots of the given repository, 10 by default`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		v := getClient()
@@ -221,18 +579,58 @@ var cmdSnapshotList = &cobra.Command{
 			os.Exit(1)
 		}
 
-		snapshots, err := v.GetSnapshots(repository)
+		opts := vulcanizer.SnapshotListOptions{Order: "desc"}
+
+		opts.State, err = cmd.Flags().GetString("state")
 		if err != nil {
-			fmt.Printf("Could not query snapshots. Error: %s\n", err)
+			fmt.Printf("Could not retrieve argument: state. Error: %s\n", err)
 			os.Exit(1)
 		}
 
-		header := []string{"State", "Name", "Finished", "Duration"}
+		since, err := cmd.Flags().GetString("since")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: since. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts.Since, err = parseSince(since)
+		if err != nil {
+			fmt.Printf("Could not parse argument: since. Error: %s\n", err)
+			os.Exit(1)
+		}
 
-		if len(snapshots) > 10 {
-			snapshots = snapshots[len(snapshots)-10:]
+		opts.Index, err = cmd.Flags().GetString("index")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: index. Error: %s\n", err)
+			os.Exit(1)
 		}
 
+		opts.SLMPolicy, err = cmd.Flags().GetString("slm-policy")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: slm-policy. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts.Size, err = cmd.Flags().GetInt("limit")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: limit. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		page, err := v.ListSnapshots(repository, opts)
+		if err != nil {
+			fmt.Printf("Could not query snapshots. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		// List from the oldest to the most recent snapshot.
+		snapshots := make([]vulcanizer.Snapshot, 0, len(page.Snapshots))
+		for i := len(page.Snapshots) - 1; i >= 0; i-- {
+			snapshots = append(snapshots, page.Snapshots[i])
+		}
+
+		header := []string{"State", "Name", "Finished", "Duration"}
+
 		rows := [][]string{}
 		for _, snapshot := range snapshots {
 			duration, _ := time.ParseDuration(fmt.Sprintf("%dms", snapshot.GetDuration()))
@@ -281,6 +679,24 @@ var cmdSnapshotCreate = &cobra.Command{
 			os.Exit(1)
 		}
 
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: wait. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		pollInterval, err := cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: poll-interval. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: timeout. Error: %s\n", err)
+			os.Exit(1)
+		}
+
 		if allIndices {
 			err = v.SnapshotAllIndices(repository, snapshotName)
 			if err != nil {
@@ -302,6 +718,23 @@ var cmdSnapshotCreate = &cobra.Command{
 
 			fmt.Println("Snapshot operation started.")
 		}
+
+		if !wait {
+			return
+		}
+
+		snapshot, err := v.WaitForSnapshot(repository, snapshotName, pollInterval, timeout, func(progress vulcanizer.SnapshotProgress) {
+			fmt.Printf("Snapshot %s: %d/%d shards done, %d failed, %s of %s processed\n", progress.State, progress.ShardsDone, progress.ShardsTotal, progress.ShardsFailed, humanizeBytes(progress.ProcessedBytes), humanizeBytes(progress.TotalBytes))
+		})
+		if err != nil {
+			fmt.Printf("Error waiting for snapshot: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Snapshot completed with state %s: %d shards successful, %d failed.\n", snapshot.State, snapshot.Shards.Successful, snapshot.Shards.Failed)
+		if snapshot.State != "SUCCESS" {
+			os.Exit(1)
+		}
 	},
 }
 
@@ -333,3 +766,222 @@ var cmdSnapshotDelete = &cobra.Command{
 		fmt.Println("Delete operation called successfully.")
 	},
 }
+
+var cmdSnapshotPrune = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the snapshots not kept by retention rules.",
+	Long:  `This command prints which snapshots of the repository the retention rules keep and delete. With --yes and without --dry-run, it then deletes them one at a time.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		repository, err := cmd.Flags().GetString("repository")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: repository. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		rules := vulcanizer.SnapshotRetentionRules{}
+		for flag, value := range map[string]*int{
+			"keep-last":   &rules.KeepLast,
+			"keep-daily":  &rules.KeepDailyDays,
+			"keep-weekly": &rules.KeepWeeklyWeeks,
+			"min-count":   &rules.MinCount,
+			"max-count":   &rules.MaxCount,
+		} {
+			*value, err = cmd.Flags().GetInt(flag)
+			if err != nil {
+				fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+				os.Exit(1)
+			}
+		}
+
+		rules.NamePattern, err = cmd.Flags().GetString("name-pattern")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: name-pattern. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		rules.DeleteFailed, err = cmd.Flags().GetBool("delete-failed")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: delete-failed. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: dry-run. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: yes. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		pause, err := cmd.Flags().GetDuration("pause")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: pause. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		decisions, err := v.PlanSnapshotRetention(repository, rules)
+		if err != nil {
+			fmt.Printf("Error planning snapshot retention: %s\n", err)
+			os.Exit(1)
+		}
+
+		header := []string{"Name", "State", "Started", "Action", "Reason"}
+		rows := [][]string{}
+		toDelete := []vulcanizer.Snapshot{}
+		for _, d := range decisions {
+			action := "keep"
+			if d.Delete {
+				action = "delete"
+				toDelete = append(toDelete, d.Snapshot)
+			}
+
+			row := []string{
+				d.Snapshot.Name,
+				d.Snapshot.State,
+				d.Snapshot.StartTime.Format(time.RFC3339),
+				action,
+				d.Reason,
+			}
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+		fmt.Printf("%d snapshots to keep, %d to delete.\n", len(decisions)-len(toDelete), len(toDelete))
+
+		if len(toDelete) == 0 {
+			return
+		}
+
+		if dryRun {
+			fmt.Println("Dry run, no snapshot deleted.")
+			return
+		}
+
+		if !yes {
+			fmt.Println("No snapshot deleted, run again with --yes to delete them.")
+			return
+		}
+
+		err = v.PruneSnapshots(repository, toDelete, pause, func(snapshot vulcanizer.Snapshot) {
+			fmt.Printf("Deleted snapshot %s\n", snapshot.Name)
+		})
+		if err != nil {
+			fmt.Printf("Error pruning snapshots: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Prune completed.")
+	},
+}
+
+var cmdSnapshotClone = &cobra.Command{
+	Use:   "clone",
+	Short: "Clone indices of a snapshot into a new snapshot.",
+	Long:  `This command will create a new snapshot in the same repository holding the given indices of a snapshot, sharing its files.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		snapshotName, err := cmd.Flags().GetString("snapshot")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: snapshot. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		repository, err := cmd.Flags().GetString("repository")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: repository. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		target, err := cmd.Flags().GetString("target")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: target. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		indices, err := cmd.Flags().GetStringSlice("index")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: index. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		err = v.CloneSnapshot(repository, snapshotName, target, indices)
+		if err != nil {
+			fmt.Printf("Error while cloning snapshot. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Snapshot %s cloned to %s.\n", snapshotName, target)
+	},
+}
+
+var cmdSnapshotCopy = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy a snapshot to another repository through a scratch cluster.",
+	Long:  `This command will restore indices of a snapshot of the cluster into the scratch cluster, which must have access to both repositories, then snapshot them into the target repository and verify every shard of the source snapshot was copied.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		scratchCluster, err := cmd.Flags().GetString("scratch-cluster")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: scratch-cluster. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		scratch := clientFrom(getClusterConfiguration(scratchCluster))
+
+		opts := vulcanizer.SnapshotCopyOptions{}
+		for flag, value := range map[string]*string{
+			"snapshot":          &opts.SourceSnapshot,
+			"repository":        &opts.SourceRepository,
+			"target-repository": &opts.TargetRepository,
+			"target-snapshot":   &opts.TargetSnapshot,
+		} {
+			var err error
+			*value, err = cmd.Flags().GetString(flag)
+			if err != nil {
+				fmt.Printf("Could not retrieve argument: %s. Error: %s\n", flag, err)
+				os.Exit(1)
+			}
+		}
+
+		if opts.TargetSnapshot == "" {
+			opts.TargetSnapshot = opts.SourceSnapshot
+		}
+
+		opts.Indices, err = cmd.Flags().GetStringSlice("index")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: index. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts.DeleteRestored, err = cmd.Flags().GetBool("delete-restored")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: delete-restored. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		opts.PollInterval, err = cmd.Flags().GetDuration("poll-interval")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: poll-interval. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		result, err := v.CopySnapshot(scratch, opts)
+		if err != nil {
+			fmt.Printf("Error while copying snapshot. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Snapshot %s/%s copied to %s/%s: %d indices, %d of %d primary shards.\n", opts.SourceRepository, opts.SourceSnapshot, opts.TargetRepository, opts.TargetSnapshot, len(result.Indices), result.TargetSnapshot.Shards.Successful, result.PrimaryShards)
+	},
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+var rateMetrics = []string{"indexing.rate", "search.rate", "get.rate"}
+
+func init() {
+	cmdIndexStats.Flags().String("sort", "store.size", fmt.Sprintf("Metric to sort by in descending order. One of: %s", strings.Join(append(vulcanizer.IndexStatsMetricNames(), rateMetrics...), ", ")))
+	cmdIndexStats.Flags().Bool("primaries", false, "Display metrics of primary shards only instead of all shard copies")
+	cmdIndexStats.Flags().Int("limit", 0, "Only display this many indices")
+	cmdIndexStats.Flags().Duration("sample", 0, "Sample the stats twice with this interval in between to compute indexing, search and get rates, i.e. 10s")
+
+	cmdIndices.AddCommand(cmdIndexStats)
+}
+
+var cmdIndexStats = &cobra.Command{
+	Use:   "stats",
+	Short: "Display the stats of the indices of the cluster",
+	Long:  `Show store size, traffic, cache and segment metrics of all indices or of the given name or pattern, sorted by any metric`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		sortBy, err := cmd.Flags().GetString("sort")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: sort. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		primaries, err := cmd.Flags().GetBool("primaries")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: primaries. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: limit. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		sample, err := cmd.Flags().GetDuration("sample")
+		if err != nil {
+			fmt.Printf("Could not retrieve argument: sample. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		isRate := false
+		for _, rate := range rateMetrics {
+			if sortBy == rate {
+				isRate = true
+			}
+		}
+
+		if isRate && sample == 0 {
+			fmt.Printf("Sorting by %s requires --sample\n", sortBy)
+			os.Exit(1)
+		}
+
+		if _, err := (vulcanizer.IndexStatsMetrics{}).Metric(sortBy); err != nil && !isRate {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		index := ""
+		if len(args) > 0 {
+			index = args[0]
+		}
+
+		stats, err := v.GetIndexStats(index)
+		if err != nil {
+			fmt.Printf("Error getting index stats: %s\n", err)
+			os.Exit(1)
+		}
+
+		rates := map[string]vulcanizer.IndexStatsRates{}
+		if sample > 0 {
+			fmt.Printf("Sampling index stats over %s...\n", sample)
+			start := time.Now()
+			time.Sleep(sample)
+
+			previous := stats
+			stats, err = v.GetIndexStats(index)
+			if err != nil {
+				fmt.Printf("Error getting index stats: %s\n", err)
+				os.Exit(1)
+			}
+
+			elapsed := time.Since(start)
+			previousByName := map[string]vulcanizer.IndexStats{}
+			for _, s := range previous {
+				previousByName[s.Name] = s
+			}
+			// Indices created in between have no baseline to compute rates against.
+			for _, s := range stats {
+				if p, ok := previousByName[s.Name]; ok {
+					rates[s.Name] = s.RatesSince(p, elapsed)
+				}
+			}
+		}
+
+		metrics := func(s vulcanizer.IndexStats) vulcanizer.IndexStatsMetrics {
+			if primaries {
+				return s.Primaries
+			}
+			return s.Total
+		}
+
+		sortValue := func(s vulcanizer.IndexStats) float64 {
+			switch sortBy {
+			case "indexing.rate":
+				return rates[s.Name].IndexingPerSecond
+			case "search.rate":
+				return rates[s.Name].SearchPerSecond
+			case "get.rate":
+				return rates[s.Name].GetPerSecond
+			}
+			value, _ := metrics(s).Metric(sortBy)
+			return float64(value)
+		}
+
+		sort.SliceStable(stats, func(i, j int) bool {
+			return sortValue(stats[i]) > sortValue(stats[j])
+		})
+
+		if limit > 0 && len(stats) > limit {
+			stats = stats[:limit]
+		}
+
+		header := []string{"Index", "Docs", "Deleted", "Store", "Indexing", "Search", "Get", "Query Cache", "Fielddata", "Segments", "Segments Memory", "Refreshes", "Flushes"}
+		if sample > 0 {
+			header = append(header, "Indexing/s", "Search/s", "Get/s")
+		}
+
+		rows := [][]string{}
+		for _, s := range stats {
+			m := metrics(s)
+			row := []string{
+				s.Name,
+				strconv.FormatInt(m.DocsCount, 10),
+				strconv.FormatInt(m.DocsDeleted, 10),
+				humanizeBytes(m.StoreSizeBytes),
+				strconv.FormatInt(m.IndexingTotal, 10),
+				strconv.FormatInt(m.SearchQueryTotal, 10),
+				strconv.FormatInt(m.GetTotal, 10),
+				humanizeBytes(m.QueryCacheMemoryBytes),
+				humanizeBytes(m.FielddataMemoryBytes),
+				strconv.FormatInt(m.SegmentsCount, 10),
+				humanizeBytes(m.SegmentsMemoryBytes),
+				strconv.FormatInt(m.RefreshTotal, 10),
+				strconv.FormatInt(m.FlushTotal, 10),
+			}
+
+			if r, ok := rates[s.Name]; ok {
+				row = append(row,
+					fmt.Sprintf("%.1f", r.IndexingPerSecond),
+					fmt.Sprintf("%.1f", r.SearchPerSecond),
+					fmt.Sprintf("%.1f", r.GetPerSecond),
+				)
+			} else if sample > 0 {
+				row = append(row, "new", "new", "new")
+			}
+
+			rows = append(rows, row)
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/github/vulcanizer"
+	"github.com/spf13/cobra"
+)
+
+const (
+	legacyTemplateType     = "legacy"
+	composableTemplateType = "composable"
+	componentTemplateType  = "component"
+)
+
+func init() {
+	cmdTemplatesGet.Flags().StringP("type", "t", composableTemplateType, "Type of template: legacy, composable or component")
+	cmdTemplatesDelete.Flags().StringP("type", "t", composableTemplateType, "Type of template: legacy, composable or component")
+
+	cmdTemplatesPut.Flags().StringP("type", "t", composableTemplateType, "Type of template: legacy, composable or component")
+	cmdTemplatesPut.Flags().String("file", "", "Path to a JSON file holding the template body (required)")
+	err := cmdTemplatesPut.MarkFlagRequired("file")
+	if err != nil {
+		fmt.Printf("Error binding file configuration flag: %s \n", err)
+		os.Exit(1)
+	}
+
+	cmdTemplates.AddCommand(cmdTemplatesList, cmdTemplatesGet, cmdTemplatesPut, cmdTemplatesDelete, cmdTemplatesSimulate)
+	rootCmd.AddCommand(cmdTemplates)
+}
+
+func getTemplateType(cmd *cobra.Command) string {
+	templateType, err := cmd.Flags().GetString("type")
+	if err != nil {
+		fmt.Printf("Could not retrieve argument: type. Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	switch templateType {
+	case legacyTemplateType, composableTemplateType, componentTemplateType:
+		return templateType
+	default:
+		fmt.Printf("Unknown template type %s. Use one of legacy, composable or component.\n", templateType)
+		os.Exit(1)
+	}
+
+	return ""
+}
+
+func optionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+var cmdTemplates = &cobra.Command{
+	Use:   "templates",
+	Short: "Interact with the index templates of the cluster.",
+	Long:  `Use the list, get, put, delete and simulate subcommands.`,
+}
+
+var cmdTemplatesList = &cobra.Command{
+	Use:   "list",
+	Short: "List the index and component templates of the cluster",
+	Long:  `Show legacy, composable and component templates, optionally filtered by a name or wildcard expression. Composable and component templates are only listed on Elasticsearch 7.8 or later.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		header := []string{"Type", "Name", "Index Patterns", "Priority/Order", "Version", "Composed Of"}
+		rows := [][]string{}
+
+		composable, err := v.GetComposableIndexTemplates(name)
+		if err != nil && err != vulcanizer.ErrComposableTemplatesUnsupported {
+			fmt.Printf("Error getting composable index templates: %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, t := range composable {
+			rows = append(rows, []string{composableTemplateType, t.Name, strings.Join(t.IndexPatterns, ", "), optionalInt(t.Priority), optionalInt(t.Version), strings.Join(t.ComposedOf, ", ")})
+		}
+
+		components, err := v.GetComponentTemplates(name)
+		if err != nil && err != vulcanizer.ErrComposableTemplatesUnsupported {
+			fmt.Printf("Error getting component templates: %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, t := range components {
+			rows = append(rows, []string{componentTemplateType, t.Name, "", "", optionalInt(t.Version), ""})
+		}
+
+		legacy, err := v.GetLegacyIndexTemplates(name)
+		if err != nil {
+			fmt.Printf("Error getting legacy index templates: %s\n", err)
+			os.Exit(1)
+		}
+
+		for _, t := range legacy {
+			rows = append(rows, []string{legacyTemplateType, t.Name, strings.Join(t.IndexPatterns, ", "), strconv.Itoa(t.Order), optionalInt(t.Version), ""})
+		}
+
+		fmt.Println(renderTable(rows, header))
+	},
+}
+
+var cmdTemplatesGet = &cobra.Command{
+	Use:   "get",
+	Short: "Display the given template",
+	Long:  `Given a template name, shows its body as JSON.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		var templates interface{}
+		var count int
+		var err error
+
+		switch getTemplateType(cmd) {
+		case legacyTemplateType:
+			var legacy []vulcanizer.LegacyIndexTemplate
+			legacy, err = v.GetLegacyIndexTemplates(args[0])
+			templates, count = legacy, len(legacy)
+		case composableTemplateType:
+			var composable []vulcanizer.ComposableIndexTemplate
+			composable, err = v.GetComposableIndexTemplates(args[0])
+			templates, count = composable, len(composable)
+		case componentTemplateType:
+			var components []vulcanizer.ComponentTemplate
+			components, err = v.GetComponentTemplates(args[0])
+			templates, count = components, len(components)
+		}
+
+		if err != nil {
+			fmt.Printf("Error getting template: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		if count == 0 {
+			fmt.Printf("No template found: %s\n", args[0])
+			os.Exit(1)
+		}
+
+		pretty, err := json.MarshalIndent(templates, "", "  ")
+		if err != nil {
+			fmt.Printf("Error formatting template: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(pretty))
+	},
+}
+
+var cmdTemplatesPut = &cobra.Command{
+	Use:   "put",
+	Short: "Create or update the given template",
+	Long:  `Given a template name and a JSON file holding its body, creates or replaces the template.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		templateType := getTemplateType(cmd)
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Printf("Could not retrieve required argument: file. Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Error reading template file: %s\n", err)
+			os.Exit(1)
+		}
+
+		switch templateType {
+		case legacyTemplateType:
+			var template vulcanizer.LegacyIndexTemplate
+			err = json.Unmarshal(body, &template)
+			if err == nil {
+				template.Name = args[0]
+				err = v.PutLegacyIndexTemplate(template)
+			}
+		case composableTemplateType:
+			var template vulcanizer.ComposableIndexTemplate
+			err = json.Unmarshal(body, &template)
+			if err == nil {
+				template.Name = args[0]
+				err = v.PutComposableIndexTemplate(template)
+			}
+		case componentTemplateType:
+			var template vulcanizer.ComponentTemplate
+			err = json.Unmarshal(body, &template)
+			if err == nil {
+				template.Name = args[0]
+				err = v.PutComponentTemplate(template)
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("Error putting template: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Template %s saved successfully.\n", args[0])
+	},
+}
+
+var cmdTemplatesDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the given template",
+	Long:  `Given a template name, deletes the template.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		var err error
+		switch getTemplateType(cmd) {
+		case legacyTemplateType:
+			err = v.DeleteLegacyIndexTemplate(args[0])
+		case composableTemplateType:
+			err = v.DeleteComposableIndexTemplate(args[0])
+		case componentTemplateType:
+			err = v.DeleteComponentTemplate(args[0])
+		}
+
+		if err != nil {
+			fmt.Printf("Error deleting template: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Template %s deleted successfully.\n", args[0])
+	},
+}
+
+var cmdTemplatesSimulate = &cobra.Command{
+	Use:   "simulate",
+	Short: "Show which template a new index would match",
+	Long:  `Given an index name, shows which templates would apply to it if it were created now, and the resulting settings, mappings and aliases on Elasticsearch 7.9 or later.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		v := getClient()
+
+		simulated, err := v.SimulateIndexTemplate(args[0])
+		if err != nil {
+			fmt.Printf("Error simulating index: %s - %s\n", args[0], err)
+			os.Exit(1)
+		}
+
+		overlapping := []string{}
+		for _, o := range simulated.Overlapping {
+			overlapping = append(overlapping, fmt.Sprintf("%s (%s)", o.Name, strings.Join(o.IndexPatterns, ", ")))
+		}
+
+		rows := [][]string{
+			{"Composable template", simulated.MatchedTemplate},
+			{"Legacy templates", strings.Join(simulated.MatchedLegacyTemplates, ", ")},
+			{"Overlapping", strings.Join(overlapping, "\n")},
+		}
+		fmt.Println(renderTable(rows, []string{"Match", "Templates"}))
+
+		if simulated.Template.Settings == nil && simulated.Template.Mappings == nil && simulated.Template.Aliases == nil {
+			return
+		}
+
+		pretty, err := json.MarshalIndent(simulated.Template, "", "  ")
+		if err != nil {
+			fmt.Printf("Error formatting template: %s\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(pretty))
+	},
+}
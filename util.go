@@ -1,9 +1,15 @@
 package vulcanizer
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -94,3 +100,1424 @@ func combineErrors(errs []error) error {
 func escapeIndexName(index string) string {
 	return strings.ReplaceAll(index, ".", "\\.")
 }
+
+// Returns the node holding the most started shards of the given index.
+func nodeWithMostShards(shards []Shard, index string) string {
+	counts := map[string]int{}
+	for _, shard := range shards {
+		if shard.Index == index && shard.State == "STARTED" && shard.Node != "" {
+			counts[shard.Node]++
+		}
+	}
+
+	var node string
+	for name, count := range counts {
+		if count > counts[node] || (count == counts[node] && name < node) {
+			node = name
+		}
+	}
+	return node
+}
+
+// Returns the value to restore a setting to, nil if it was not set.
+func settingOrNull(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// Returns the actions moving every alias of an `<index>/_alias` response from
+// the source to the target index, keeping their filter, routing and flags, and
+// the names of the aliases.
+func aliasMoveActions(body []byte, source, target string) ([]AliasAction, []string) {
+	actions := []AliasAction{}
+	names := []string{}
+	gjson.GetBytes(body, fmt.Sprintf("%s.aliases", escapeIndexName(source))).ForEach(func(name, alias gjson.Result) bool {
+		add := AliasAction{
+			ActionType:    AddAlias,
+			IndexName:     target,
+			AliasName:     name.String(),
+			IndexRouting:  alias.Get("index_routing").String(),
+			SearchRouting: alias.Get("search_routing").String(),
+		}
+
+		if filter := alias.Get("filter"); filter.IsObject() {
+			add.Filter = map[string]interface{}{}
+			_ = json.Unmarshal([]byte(filter.Raw), &add.Filter)
+		}
+
+		if writeIndex := alias.Get("is_write_index"); writeIndex.Exists() {
+			value := writeIndex.Bool()
+			add.IsWriteIndex = &value
+		}
+
+		if hidden := alias.Get("is_hidden"); hidden.Exists() {
+			value := hidden.Bool()
+			add.IsHidden = &value
+		}
+
+		actions = append(actions, AliasAction{ActionType: RemoveAlias, IndexName: source, AliasName: name.String()}, add)
+		names = append(names, name.String())
+		return true
+	})
+
+	return actions, names
+}
+
+// Checks that a started copy of every shard of the index is on the given node
+// and that no shard of the index is still relocating.
+func shardsGatheredOnNode(shards []Shard, index, node string) bool {
+	required := map[string]bool{}
+	for _, shard := range shards {
+		if shard.Index != index {
+			continue
+		}
+
+		if shard.State == "RELOCATING" || shard.State == "INITIALIZING" {
+			return false
+		}
+
+		if _, ok := required[shard.Shard]; !ok {
+			required[shard.Shard] = false
+		}
+
+		if shard.Node == node && shard.State == "STARTED" {
+			required[shard.Shard] = true
+		}
+	}
+
+	if len(required) == 0 {
+		return false
+	}
+
+	for _, found := range required {
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Aggregates the segments of primary shards per index and flags force merge candidates.
+func buildSegmentReport(shardSegments []ShardSegments, opts SegmentReportOptions) []IndexSegmentReport {
+	if opts.MaxSegmentsPerShard == 0 {
+		opts.MaxSegmentsPerShard = 50
+	}
+
+	if opts.MaxDeletedDocsRatio == 0 {
+		opts.MaxDeletedDocsRatio = 0.2
+	}
+
+	reports := map[string]*IndexSegmentReport{}
+	for _, shard := range shardSegments {
+		if !shard.Primary {
+			continue
+		}
+
+		report, ok := reports[shard.Index]
+		if !ok {
+			report = &IndexSegmentReport{Index: shard.Index}
+			reports[shard.Index] = report
+		}
+
+		docs, deletedDocs, sizeBytes := shard.Totals()
+		report.Shards++
+		report.Segments += len(shard.Segments)
+		report.Docs += docs
+		report.DeletedDocs += deletedDocs
+		report.SizeBytes += sizeBytes
+
+		if len(shard.Segments) > report.MaxSegmentsPerShard {
+			report.MaxSegmentsPerShard = len(shard.Segments)
+		}
+	}
+
+	results := make([]IndexSegmentReport, 0, len(reports))
+	for _, report := range reports {
+		if total := report.Docs + report.DeletedDocs; total > 0 {
+			report.DeletedDocsRatio = float64(report.DeletedDocs) / float64(total)
+		}
+
+		if report.MaxSegmentsPerShard > opts.MaxSegmentsPerShard {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("%d segments in a shard exceeds %d", report.MaxSegmentsPerShard, opts.MaxSegmentsPerShard))
+		}
+
+		if report.DeletedDocsRatio > opts.MaxDeletedDocsRatio {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("%.1f%% deleted documents exceeds %.1f%%", report.DeletedDocsRatio*100, opts.MaxDeletedDocsRatio*100))
+		}
+
+		report.ForceMergeCandidate = len(report.Reasons) > 0
+		results = append(results, *report)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Index < results[j].Index
+	})
+
+	return results
+}
+
+func indexStatsMetricsFromJSON(stats gjson.Result) IndexStatsMetrics {
+	return IndexStatsMetrics{
+		DocsCount:             stats.Get("docs.count").Int(),
+		DocsDeleted:           stats.Get("docs.deleted").Int(),
+		StoreSizeBytes:        stats.Get("store.size_in_bytes").Int(),
+		IndexingTotal:         stats.Get("indexing.index_total").Int(),
+		IndexingTimeMillis:    stats.Get("indexing.index_time_in_millis").Int(),
+		SearchQueryTotal:      stats.Get("search.query_total").Int(),
+		SearchQueryTimeMillis: stats.Get("search.query_time_in_millis").Int(),
+		SearchFetchTotal:      stats.Get("search.fetch_total").Int(),
+		GetTotal:              stats.Get("get.total").Int(),
+		GetTimeMillis:         stats.Get("get.time_in_millis").Int(),
+		QueryCacheMemoryBytes: stats.Get("query_cache.memory_size_in_bytes").Int(),
+		QueryCacheHitCount:    stats.Get("query_cache.hit_count").Int(),
+		QueryCacheMissCount:   stats.Get("query_cache.miss_count").Int(),
+		QueryCacheEvictions:   stats.Get("query_cache.evictions").Int(),
+		FielddataMemoryBytes:  stats.Get("fielddata.memory_size_in_bytes").Int(),
+		FielddataEvictions:    stats.Get("fielddata.evictions").Int(),
+		SegmentsCount:         stats.Get("segments.count").Int(),
+		SegmentsMemoryBytes:   stats.Get("segments.memory_in_bytes").Int(),
+		RefreshTotal:          stats.Get("refresh.total").Int(),
+		RefreshTimeMillis:     stats.Get("refresh.total_time_in_millis").Int(),
+		FlushTotal:            stats.Get("flush.total").Int(),
+		FlushTimeMillis:       stats.Get("flush.total_time_in_millis").Int(),
+	}
+}
+
+// Compares an Elasticsearch version number such as "7.10.2" to the given major and minor version.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+
+	versionMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+
+	versionMinor := 0
+	if len(parts) > 1 {
+		versionMinor, _ = strconv.Atoi(parts[1])
+	}
+
+	return versionMajor > major || (versionMajor == major && versionMinor >= minor)
+}
+
+// Checks whether an index name matches a template pattern, which only supports `*` wildcards.
+func matchesIndexPattern(pattern, name string) bool {
+	expression := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	matched, _ := regexp.MatchString(fmt.Sprintf("^%s$", expression), name)
+	return matched
+}
+
+// Returns the name of the highest priority composable template matching the index name.
+func matchComposableTemplate(templates []ComposableIndexTemplate, indexName string) string {
+	matched := ""
+	matchedPriority := -1
+	for _, template := range templates {
+		priority := 0
+		if template.Priority != nil {
+			priority = *template.Priority
+		}
+
+		for _, pattern := range template.IndexPatterns {
+			if matchesIndexPattern(pattern, indexName) && priority > matchedPriority {
+				matched = template.Name
+				matchedPriority = priority
+			}
+		}
+	}
+	return matched
+}
+
+// Returns the names of the legacy templates matching the index name, in the order they are applied.
+func matchLegacyTemplates(templates []LegacyIndexTemplate, indexName string) []string {
+	matched := []LegacyIndexTemplate{}
+	for _, template := range templates {
+		for _, pattern := range template.IndexPatterns {
+			if matchesIndexPattern(pattern, indexName) {
+				matched = append(matched, template)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Order < matched[j].Order
+	})
+
+	names := make([]string, 0, len(matched))
+	for _, template := range matched {
+		names = append(names, template.Name)
+	}
+	return names
+}
+
+// Returns the recoveries restoring the given indices from the snapshot that
+// started after the given time, and whether all of them are done. A restore
+// without recoveries yet is not done.
+func snapshotRecoveries(recoveries []ShardRecovery, repository, snapshot string, indices []string, startedAfter time.Time) ([]ShardRecovery, bool) {
+	matching := []ShardRecovery{}
+	done := true
+	for _, recovery := range recoveries {
+		if recovery.Type != "snapshot" || recovery.Repository != repository || recovery.Snapshot != snapshot {
+			continue
+		}
+
+		// Older versions don't report the start time, so their recoveries can't be told apart.
+		if !startedAfter.IsZero() && recovery.StartTimeMillis != 0 && recovery.StartTimeMillis < startedAfter.UnixNano()/int64(time.Millisecond) {
+			continue
+		}
+
+		if len(indices) > 0 {
+			found := false
+			for _, pattern := range indices {
+				if matchesIndexPattern(pattern, recovery.Index) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		matching = append(matching, recovery)
+		if recovery.Stage != "done" {
+			done = false
+		}
+	}
+
+	return matching, done && len(matching) > 0
+}
+
+// Compares the shards of each index in a copied snapshot to the number of
+// shards expected from the source snapshot, and describes the differences.
+func snapshotCopyMismatches(expected map[string]int, target SnapshotDetailedStatus) []string {
+	copied := map[string]SnapshotIndexStatus{}
+	for _, index := range target.Indices {
+		copied[index.Name] = index
+	}
+
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mismatches := []string{}
+	for _, name := range names {
+		index, ok := copied[name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s is missing", name))
+			continue
+		}
+
+		if index.ShardsDone != expected[name] || index.ShardsFailed > 0 {
+			mismatches = append(mismatches, fmt.Sprintf("%s has %d of %d shards done, %d failed", name, index.ShardsDone, expected[name], index.ShardsFailed))
+		}
+	}
+
+	return mismatches
+}
+
+// Decides which snapshots to keep and delete according to the retention rules,
+// from the most recent snapshot to the oldest. Snapshots not matching the name
+// pattern and running snapshots are left out of the plan.
+func planSnapshotRetention(snapshots []Snapshot, rules SnapshotRetentionRules, namePattern *regexp.Regexp, now time.Time) []SnapshotRetentionDecision {
+	decisions := []SnapshotRetentionDecision{}
+	for _, snapshot := range snapshots {
+		if snapshot.State == "IN_PROGRESS" {
+			continue
+		}
+
+		if namePattern != nil && !namePattern.MatchString(snapshot.Name) {
+			continue
+		}
+
+		decisions = append(decisions, SnapshotRetentionDecision{Snapshot: snapshot, Delete: true})
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Snapshot.StartTime.After(decisions[j].Snapshot.StartTime)
+	})
+
+	dailySince := now.AddDate(0, 0, -rules.KeepDailyDays)
+	weeklySince := now.AddDate(0, 0, -7*rules.KeepWeeklyWeeks)
+	days := map[string]bool{}
+	weeks := map[string]bool{}
+	kept := 0
+
+	for i := range decisions {
+		d := &decisions[i]
+		if d.Snapshot.State != "SUCCESS" && d.Snapshot.State != "PARTIAL" {
+			d.Delete = rules.DeleteFailed
+			d.Reason = fmt.Sprintf("state %s", d.Snapshot.State)
+			continue
+		}
+
+		start := d.Snapshot.StartTime.UTC()
+		day := start.Format("2006-01-02")
+		year, week := start.ISOWeek()
+		weekKey := fmt.Sprintf("%d-W%02d", year, week)
+
+		switch {
+		case kept < rules.KeepLast:
+			d.Reason = fmt.Sprintf("one of the last %d", rules.KeepLast)
+		case rules.KeepDailyDays > 0 && start.After(dailySince) && !days[day]:
+			d.Reason = fmt.Sprintf("daily snapshot of %s", day)
+		case rules.KeepWeeklyWeeks > 0 && start.After(weeklySince) && !weeks[weekKey]:
+			d.Reason = fmt.Sprintf("weekly snapshot of %s", weekKey)
+		case kept < rules.MinCount:
+			d.Reason = fmt.Sprintf("minimum count of %d", rules.MinCount)
+		default:
+			d.Reason = "not kept by any rule"
+			continue
+		}
+
+		d.Delete = false
+		days[day] = true
+		weeks[weekKey] = true
+		kept++
+
+		if rules.MaxCount > 0 && kept > rules.MaxCount {
+			d.Delete = true
+			d.Reason = fmt.Sprintf("exceeds maximum count of %d", rules.MaxCount)
+		}
+	}
+
+	return decisions
+}
+
+// Returns the snapshots matching the client side filters of the options, and
+// the SLM policy filter as well if Elasticsearch did not apply it.
+func filterSnapshots(snapshots []Snapshot, opts SnapshotListOptions, filterPolicy bool) []Snapshot {
+	filtered := []Snapshot{}
+	for _, snapshot := range snapshots {
+		if filterPolicy && opts.SLMPolicy != "" && snapshot.Metadata["policy"] != opts.SLMPolicy {
+			continue
+		}
+
+		if opts.State != "" && !strings.EqualFold(snapshot.State, opts.State) {
+			continue
+		}
+
+		if !opts.Since.IsZero() && snapshot.StartTime.Before(opts.Since) {
+			continue
+		}
+
+		if opts.Index != "" {
+			found := false
+			for _, index := range snapshot.Indices {
+				if matchesIndexPattern(opts.Index, index) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+
+		filtered = append(filtered, snapshot)
+	}
+	return filtered
+}
+
+// Sorts the snapshots if Elasticsearch did not, then returns the page after
+// the cursor. Client side cursors are the offset of the page.
+func pageSnapshots(snapshots []Snapshot, opts SnapshotListOptions, sortSnapshots bool) (SnapshotPage, error) {
+	if sortSnapshots {
+		keys := map[string]func(s Snapshot) int64{
+			"start_time":         func(s Snapshot) int64 { return s.StartTime.UnixNano() },
+			"duration":           func(s Snapshot) int64 { return int64(s.DurationMillis) },
+			"index_count":        func(s Snapshot) int64 { return int64(len(s.Indices)) },
+			"shard_count":        func(s Snapshot) int64 { return int64(s.Shards.Total) },
+			"failed_shard_count": func(s Snapshot) int64 { return int64(s.Shards.Failed) },
+		}
+
+		key, ok := keys[opts.Sort]
+		if !ok && opts.Sort != "name" {
+			return SnapshotPage{}, fmt.Errorf("Unknown snapshot sort: %s", opts.Sort)
+		}
+
+		sort.SliceStable(snapshots, func(i, j int) bool {
+			a, b := snapshots[i], snapshots[j]
+			if opts.Order == "desc" {
+				a, b = b, a
+			}
+
+			if opts.Sort == "name" || key(a) == key(b) {
+				return a.Name < b.Name
+			}
+			return key(a) < key(b)
+		})
+	}
+
+	offset := 0
+	if opts.After != "" {
+		var err error
+		offset, err = strconv.Atoi(opts.After)
+		if err != nil || offset < 0 {
+			return SnapshotPage{}, fmt.Errorf("Invalid snapshot cursor: %s", opts.After)
+		}
+	}
+
+	if offset > len(snapshots) {
+		offset = len(snapshots)
+	}
+
+	end := len(snapshots)
+	if opts.Size > 0 && offset+opts.Size < end {
+		end = offset + opts.Size
+	}
+
+	page := SnapshotPage{
+		Snapshots: snapshots[offset:end],
+		Total:     len(snapshots),
+		Remaining: len(snapshots) - end,
+	}
+
+	if page.Remaining > 0 {
+		page.Next = strconv.Itoa(end)
+	}
+
+	return page, nil
+}
+
+func snapshotFileStatsFromJSON(stats gjson.Result) SnapshotFileStats {
+	fileStats := SnapshotFileStats{
+		StartTime: time.Unix(0, stats.Get("start_time_in_millis").Int()*int64(time.Millisecond)).UTC(),
+		Elapsed:   time.Duration(stats.Get("time_in_millis").Int()) * time.Millisecond,
+	}
+
+	// Elasticsearch 7.4 moved the counts into nested objects, and leaves out
+	// the processed counts once they equal the incremental ones.
+	if stats.Get("total").IsObject() {
+		processed := stats.Get("processed")
+		if !processed.Exists() {
+			processed = stats.Get("incremental")
+		}
+
+		fileStats.FilesToCopy = int(stats.Get("incremental.file_count").Int())
+		fileStats.FilesCopied = int(processed.Get("file_count").Int())
+		fileStats.BytesToCopy = stats.Get("incremental.size_in_bytes").Int()
+		fileStats.BytesCopied = processed.Get("size_in_bytes").Int()
+		fileStats.TotalBytes = stats.Get("total.size_in_bytes").Int()
+	} else {
+		fileStats.FilesToCopy = int(stats.Get("number_of_files").Int())
+		fileStats.FilesCopied = int(stats.Get("processed_files").Int())
+		fileStats.BytesToCopy = stats.Get("total_size_in_bytes").Int()
+		fileStats.BytesCopied = stats.Get("processed_size_in_bytes").Int()
+		fileStats.TotalBytes = fileStats.BytesToCopy
+	}
+
+	return fileStats
+}
+
+// Names of the exceptions thrown by repositories and their storage, which retrying won't fix.
+var snapshotStorageErrors = []string{
+	"RepositoryException",
+	"RepositoryVerificationException",
+	"BlobStoreException",
+	"IOException",
+	"FileSystemException",
+	"NoSuchFileException",
+	"FileNotFoundException",
+	"AccessDeniedException",
+	"AmazonS3Exception",
+	"SdkClientException",
+	"StorageException",
+}
+
+// Returns the unqualified name of the exception a failure reason starts with,
+// e.g. "IOException" for "java.io.IOException: failed to write blob".
+func exceptionType(reason string) string {
+	if i := strings.IndexAny(reason, "[:"); i >= 0 {
+		reason = reason[:i]
+	}
+	reason = strings.TrimSpace(reason)
+	return reason[strings.LastIndex(reason, ".")+1:]
+}
+
+// Correlates the shard failures of a snapshot with the nodes and shards of the cluster.
+func diagnoseSnapshotFailures(snapshot Snapshot, nodes []Node, shards []Shard) []SnapshotFailureDiagnosis {
+	diagnoses := make([]SnapshotFailureDiagnosis, 0, len(snapshot.Failures))
+	for _, failure := range snapshot.Failures {
+		d := SnapshotFailureDiagnosis{
+			Index:  failure.Index,
+			Shard:  failure.ShardID,
+			NodeID: failure.NodeID,
+			Reason: failure.Reason,
+			Status: failure.Status,
+		}
+
+		for _, node := range nodes {
+			if node.ID != "" && node.ID == failure.NodeID {
+				d.NodeName = node.Name
+				d.NodePresent = true
+				break
+			}
+		}
+
+		for _, shard := range shards {
+			if shard.Index == failure.Index && shard.Shard == strconv.Itoa(failure.ShardID) {
+				d.IndexExists = true
+				if shard.Type == "p" {
+					d.PrimaryState = shard.State
+				}
+			}
+		}
+
+		reason := strings.ToLower(failure.Reason)
+		storageError := false
+		failureType := exceptionType(failure.Reason)
+		for _, exception := range snapshotStorageErrors {
+			if failureType == exception {
+				storageError = true
+				break
+			}
+		}
+
+		switch {
+		case !d.IndexExists:
+			d.Suggestion = "The index no longer exists, retry the snapshot without it"
+			d.Retry = true
+		case storageError:
+			d.Suggestion = "The repository storage failed, investigate it with `repository doctor` before retrying"
+		case failure.NodeID != "" && !d.NodePresent:
+			d.Suggestion = "The node holding the shard left the cluster, retry the snapshot"
+			d.Retry = true
+		case d.PrimaryState != "STARTED":
+			d.Suggestion = fmt.Sprintf("The primary shard is %s, retry the snapshot once it is allocated", strings.ToLower(d.PrimaryState))
+			d.Retry = true
+		case strings.Contains(reason, "aborted"):
+			d.Suggestion = "The snapshot was aborted, retry it"
+			d.Retry = true
+		default:
+			d.Suggestion = "Unknown cause, check the logs of the node"
+		}
+
+		diagnoses = append(diagnoses, d)
+	}
+
+	return diagnoses
+}
+
+// Returns the actions turning the current aliases into the desired mapping of
+// alias names to indices, sorted by alias with removals first.
+func diffAliases(current []Alias, desired map[string][]string) []AliasAction {
+	held := map[string]map[string]bool{}
+	for _, alias := range current {
+		if _, ok := desired[alias.Name]; !ok {
+			continue
+		}
+
+		if held[alias.Name] == nil {
+			held[alias.Name] = map[string]bool{}
+		}
+		held[alias.Name][alias.IndexName] = true
+	}
+
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	actions := []AliasAction{}
+	for _, name := range names {
+		wanted := map[string]bool{}
+		for _, index := range desired[name] {
+			wanted[index] = true
+		}
+
+		removed := []string{}
+		for index := range held[name] {
+			if !wanted[index] {
+				removed = append(removed, index)
+			}
+		}
+		sort.Strings(removed)
+
+		added := []string{}
+		for index := range wanted {
+			if !held[name][index] {
+				added = append(added, index)
+			}
+		}
+		sort.Strings(added)
+
+		for _, index := range removed {
+			actions = append(actions, AliasAction{ActionType: RemoveAlias, IndexName: index, AliasName: name})
+		}
+		for _, index := range added {
+			actions = append(actions, AliasAction{ActionType: AddAlias, IndexName: index, AliasName: name})
+		}
+	}
+
+	return actions
+}
+
+// Returns the sorted names of the deciders that prevent or throttle the allocation on any node.
+func blockingDeciders(explanation AllocationExplanation) []string {
+	seen := map[string]bool{}
+	for _, decision := range explanation.NodeAllocationDecisions {
+		for _, decider := range decision.Deciders {
+			if decider.Decision != "YES" {
+				seen[decider.Decider] = true
+			}
+		}
+	}
+
+	deciders := make([]string, 0, len(seen))
+	for decider := range seen {
+		deciders = append(deciders, decider)
+	}
+	sort.Strings(deciders)
+
+	return deciders
+}
+
+// Returns the remediation suggested by an allocation explanation and the node it applies to, if any.
+func suggestRemediation(explanation AllocationExplanation) (ShardRemediation, string) {
+	switch explanation.CanAllocate {
+	case "throttled", "allocation_delayed":
+		return RemediationWait, ""
+	case "no_valid_shard_copy":
+		if !explanation.Primary {
+			return RemediationNone, ""
+		}
+		for _, decision := range explanation.NodeAllocationDecisions {
+			if decision.Store != nil && decision.Store.Found && decision.Store.StoreException == "" {
+				return RemediationAllocateStalePrimary, decision.NodeName
+			}
+		}
+		return RemediationNone, ""
+	}
+
+	for _, decider := range blockingDeciders(explanation) {
+		if decider == "max_retry" {
+			return RemediationRetryFailed, ""
+		}
+	}
+
+	return RemediationNone, ""
+}
+
+// Groups unassigned shards by allocation decision and blocking deciders, largest group first.
+func groupUnassignedShards(shards []UnassignedShard) []UnassignedShardGroup {
+	groups := []UnassignedShardGroup{}
+	positions := map[string]int{}
+	for _, shard := range shards {
+		deciders := blockingDeciders(shard.Explanation)
+		key := shard.Explanation.CanAllocate + "|" + strings.Join(deciders, ",")
+
+		position, ok := positions[key]
+		if !ok {
+			position = len(groups)
+			positions[key] = position
+			groups = append(groups, UnassignedShardGroup{
+				CanAllocate: shard.Explanation.CanAllocate,
+				Deciders:    deciders,
+			})
+		}
+		groups[position].Shards = append(groups[position].Shards, shard)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Shards) > len(groups[j].Shards)
+	})
+
+	return groups
+}
+
+// Returns the value of a flat setting from a `_cluster/settings?include_defaults=true&flat_settings=true`
+// response and where it came from, taking transient over persistent over defaults.
+func effectiveSetting(body []byte, key string) (string, string) {
+	escapedKey := strings.ReplaceAll(key, ".", "\\.")
+	for _, source := range []string{"transient", "persistent", "defaults"} {
+		value := gjson.GetBytes(body, source+"."+escapedKey)
+		if value.Exists() {
+			return value.String(), source
+		}
+	}
+
+	return "", ""
+}
+
+// Returns the effective disk watermarks from a `_cluster/settings?include_defaults=true&flat_settings=true` response.
+func diskWatermarksFromSettings(body []byte) DiskWatermarks {
+	low, _ := effectiveSetting(body, SettingWatermarkLow)
+	high, _ := effectiveSetting(body, SettingWatermarkHigh)
+	floodStage, _ := effectiveSetting(body, SettingWatermarkFloodStage)
+
+	return DiskWatermarks{Low: low, High: high, FloodStage: floodStage}
+}
+
+// Returns the effective allocation settings from a `_cluster/settings?include_defaults=true&flat_settings=true` response.
+func allocationSettingsFromJSON(body []byte) (AllocationSettings, error) {
+	settings := AllocationSettings{
+		DiskWatermarks: diskWatermarksFromSettings(body),
+		Sources:        map[string]string{},
+	}
+
+	for _, name := range []string{SettingWatermarkLow, SettingWatermarkHigh, SettingWatermarkFloodStage, SettingNodeConcurrentRecoveries, SettingClusterConcurrentRebalance, SettingRecoveryMaxBytesPerSec} {
+		value, source := effectiveSetting(body, name)
+		if source != "" {
+			settings.Sources[name] = source
+		}
+
+		var err error
+		switch name {
+		case SettingNodeConcurrentRecoveries:
+			if value != "" {
+				settings.NodeConcurrentRecoveries, err = strconv.Atoi(value)
+			}
+		case SettingClusterConcurrentRebalance:
+			if value != "" {
+				settings.ClusterConcurrentRebalance, err = strconv.Atoi(value)
+			}
+		case SettingRecoveryMaxBytesPerSec:
+			settings.RecoveryMaxBytesPerSec = value
+		}
+		if err != nil {
+			return AllocationSettings{}, fmt.Errorf("Invalid value %q for %s", value, name)
+		}
+	}
+
+	return settings, nil
+}
+
+// Returns all the flat settings of a settings object, list values joined with commas.
+func flatSettings(settings gjson.Result) map[string]string {
+	values := map[string]string{}
+	settings.ForEach(func(key, value gjson.Result) bool {
+		if value.IsArray() {
+			items := []string{}
+			for _, item := range value.Array() {
+				items = append(items, item.String())
+			}
+			values[key.String()] = strings.Join(items, ",")
+		} else {
+			values[key.String()] = value.String()
+		}
+		return true
+	})
+
+	return values
+}
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"pb", 1 << 50},
+	{"tb", 1 << 40},
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// Parses a human readable size as returned by the cat APIs, i.e. "1.2gb".
+func parseByteSize(size string) (int64, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(size, unit.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("Invalid size %q", size)
+			}
+			return int64(value * unit.multiplier), nil
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid size %q", size)
+}
+
+// Returns the disk usage percentage a watermark corresponds to on a disk of the given size.
+func watermarkUsedPercent(watermark string, totalBytes int64) (float64, bool) {
+	watermark = strings.TrimSpace(watermark)
+	if watermark == "" {
+		return 0, false
+	}
+
+	if strings.HasSuffix(watermark, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(watermark, "%"), 64)
+		return percent, err == nil
+	}
+
+	if ratio, err := strconv.ParseFloat(watermark, 64); err == nil {
+		return ratio * 100, true
+	}
+
+	// Absolute watermarks are the free space to keep.
+	free, err := parseByteSize(watermark)
+	if err != nil || totalBytes <= 0 {
+		return 0, false
+	}
+
+	return float64(totalBytes-free) / float64(totalBytes) * 100, true
+}
+
+// Returns the node of a started or relocating shard copy, the source node when relocating.
+func shardNode(shard Shard) string {
+	if shard.State != "STARTED" && shard.State != "RELOCATING" {
+		return ""
+	}
+
+	return strings.Fields(shard.Node + " ")[0]
+}
+
+// Builds a balance report from the data nodes, the shards, the index stats and the disk watermarks.
+func buildBalanceReport(nodes []Node, shards []Shard, stats []IndexStats, watermarks DiskWatermarks, opts BalanceReportOptions) BalanceReport {
+	report := BalanceReport{Watermarks: watermarks}
+
+	// Only data nodes are listed by _cat/allocation.
+	positions := map[string]int{}
+	totals := map[string]int64{}
+	for _, node := range nodes {
+		if node.Shards == "" {
+			continue
+		}
+
+		balance := NodeBalance{Name: node.Name}
+		balance.DiskPercent, _ = strconv.ParseFloat(node.DiskPercent, 64)
+		totals[node.Name], _ = parseByteSize(node.DiskTotal)
+
+		// _cat/nodes returns abbreviated node IDs.
+		for _, index := range stats {
+			for _, shard := range index.Shards {
+				if node.ID != "" && strings.HasPrefix(shard.Node, node.ID) {
+					balance.ShardBytes += shard.Metrics.StoreSizeBytes
+				}
+			}
+		}
+
+		positions[node.Name] = len(report.Nodes)
+		report.Nodes = append(report.Nodes, balance)
+	}
+
+	if len(report.Nodes) == 0 {
+		return report
+	}
+
+	type indexNode struct{ index, node string }
+	copies := map[indexNode]*IndexConcentration{}
+	indexCopies := map[string]int{}
+	for _, shard := range shards {
+		node := shardNode(shard)
+		position, ok := positions[node]
+		if !ok {
+			continue
+		}
+
+		report.Nodes[position].Shards++
+		indexCopies[shard.Index]++
+
+		key := indexNode{shard.Index, node}
+		if copies[key] == nil {
+			copies[key] = &IndexConcentration{Index: shard.Index, Node: node}
+		}
+		copies[key].Copies++
+		if shard.Type == "p" {
+			report.Nodes[position].Primaries++
+			copies[key].Primaries++
+		}
+	}
+
+	minShards, maxShards := report.Nodes[0].Shards, report.Nodes[0].Shards
+	minDisk, maxDisk := report.Nodes[0].DiskPercent, report.Nodes[0].DiskPercent
+	for _, node := range report.Nodes {
+		report.MeanShards += float64(node.Shards)
+		report.MeanDiskPercent += node.DiskPercent
+		if node.Shards < minShards {
+			minShards = node.Shards
+		}
+		if node.Shards > maxShards {
+			maxShards = node.Shards
+		}
+		minDisk, maxDisk = math.Min(minDisk, node.DiskPercent), math.Max(maxDisk, node.DiskPercent)
+	}
+	report.MeanShards /= float64(len(report.Nodes))
+	report.MeanDiskPercent /= float64(len(report.Nodes))
+	report.DiskSkew = maxDisk - minDisk
+	if report.MeanShards > 0 {
+		report.ShardSkew = float64(maxShards-minShards) / report.MeanShards
+	}
+
+	levels := []struct{ name, watermark string }{
+		{"flood_stage", watermarks.FloodStage},
+		{"high", watermarks.High},
+		{"low", watermarks.Low},
+	}
+	for i := range report.Nodes {
+		node := &report.Nodes[i]
+		if report.MeanShards > 0 {
+			node.ShardDeviation = (float64(node.Shards) - report.MeanShards) / report.MeanShards
+		}
+		node.DiskDeviation = node.DiskPercent - report.MeanDiskPercent
+
+		for _, level := range levels {
+			threshold, ok := watermarkUsedPercent(level.watermark, totals[node.Name])
+			if ok && node.DiskPercent >= threshold-opts.WatermarkMargin {
+				node.Watermark = level.name
+				node.WatermarkExceeded = node.DiskPercent >= threshold
+				break
+			}
+		}
+	}
+
+	for _, concentration := range copies {
+		concentration.FairShare = (indexCopies[concentration.Index] + len(report.Nodes) - 1) / len(report.Nodes)
+		if concentration.Primaries > 1 || concentration.Copies > concentration.FairShare {
+			report.Concentrations = append(report.Concentrations, *concentration)
+		}
+	}
+	sort.Slice(report.Concentrations, func(i, j int) bool {
+		a, b := report.Concentrations[i], report.Concentrations[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Node < b.Node
+	})
+
+	return report
+}
+
+// Node filters of the allocation filtering settings, by attribute.
+type allocationFilter struct {
+	require map[string][]string
+	include map[string][]string
+	exclude map[string][]string
+}
+
+// Allocation rules of the cluster and its indices a rebalancing plan must respect.
+type allocationRules struct {
+	cluster             allocationFilter
+	totalShardsPerNode  int
+	awarenessAttributes []string
+	sameHost            bool
+
+	indices                 map[string]allocationFilter
+	indexTotalShardsPerNode map[string]int
+	tierPreference          map[string][]string
+}
+
+// Reads the require, include and exclude filters from flat settings under the given prefix.
+func allocationFilterFromSettings(settings map[string]string, prefix string) allocationFilter {
+	filter := allocationFilter{require: map[string][]string{}, include: map[string][]string{}, exclude: map[string][]string{}}
+	for kind, filters := range map[string]map[string][]string{"require": filter.require, "include": filter.include, "exclude": filter.exclude} {
+		for key, value := range settings {
+			if !strings.HasPrefix(key, prefix+kind+".") || strings.TrimSpace(value) == "" {
+				continue
+			}
+
+			attribute := strings.TrimPrefix(key, prefix+kind+".")
+			if attribute == "_tier_preference" {
+				continue
+			}
+			for _, pattern := range strings.Split(value, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					filters[attribute] = append(filters[attribute], pattern)
+				}
+			}
+		}
+	}
+
+	return filter
+}
+
+// Builds the allocation rules from a `_cluster/settings?include_defaults=true&flat_settings=true`
+// response and a `_settings/index.routing.allocation.*?flat_settings=true` response.
+func allocationRulesFromSettings(clusterBody, indexBody []byte) allocationRules {
+	settings := map[string]string{}
+	for _, source := range []string{"defaults", "persistent", "transient"} {
+		for key, value := range flatSettings(gjson.GetBytes(clusterBody, source)) {
+			settings[key] = value
+		}
+	}
+
+	rules := allocationRules{
+		cluster:                 allocationFilterFromSettings(settings, "cluster.routing.allocation."),
+		sameHost:                settings["cluster.routing.allocation.same_shard.host"] == "true",
+		indices:                 map[string]allocationFilter{},
+		indexTotalShardsPerNode: map[string]int{},
+		tierPreference:          map[string][]string{},
+	}
+	rules.totalShardsPerNode, _ = strconv.Atoi(settings["cluster.routing.allocation.total_shards_per_node"])
+	for _, attribute := range strings.Split(settings["cluster.routing.allocation.awareness.attributes"], ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			rules.awarenessAttributes = append(rules.awarenessAttributes, attribute)
+		}
+	}
+
+	gjson.ParseBytes(indexBody).ForEach(func(index, value gjson.Result) bool {
+		indexSettings := flatSettings(value.Get("settings"))
+		rules.indices[index.String()] = allocationFilterFromSettings(indexSettings, "index.routing.allocation.")
+		if limit, err := strconv.Atoi(indexSettings["index.routing.allocation.total_shards_per_node"]); err == nil && limit > 0 {
+			rules.indexTotalShardsPerNode[index.String()] = limit
+		}
+		if tiers := indexSettings["index.routing.allocation.include._tier_preference"]; tiers != "" {
+			rules.tierPreference[index.String()] = strings.Split(tiers, ",")
+		}
+		return true
+	})
+
+	return rules
+}
+
+// Returns the values of a node for an allocation filtering or awareness attribute.
+func nodeAttributeValues(node NodeInfo, attribute string) []string {
+	switch attribute {
+	case "_name":
+		return []string{node.Name}
+	case "_id":
+		return []string{node.ID}
+	case "_ip":
+		return []string{node.IP}
+	case "_host":
+		return []string{node.Host, node.IP}
+	}
+
+	if value, ok := node.Attributes[attribute]; ok {
+		return []string{value}
+	}
+	return nil
+}
+
+// Checks whether a node matches one of the patterns of an attribute.
+func nodeMatches(node NodeInfo, attribute string, patterns []string) bool {
+	for _, value := range nodeAttributeValues(node, attribute) {
+		for _, pattern := range patterns {
+			if matchesIndexPattern(pattern, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks whether a node passes the require, include and exclude filters.
+func (f allocationFilter) allows(node NodeInfo) bool {
+	for attribute, patterns := range f.require {
+		for _, pattern := range patterns {
+			if !nodeMatches(node, attribute, []string{pattern}) {
+				return false
+			}
+		}
+	}
+
+	if len(f.include) > 0 {
+		included := false
+		for attribute, patterns := range f.include {
+			if nodeMatches(node, attribute, patterns) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for attribute, patterns := range f.exclude {
+		if nodeMatches(node, attribute, patterns) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the first tier of the preference that has nodes, "" if the index has no tier preference.
+func preferredTier(tiers []string, nodes map[string]NodeInfo) string {
+	for _, tier := range tiers {
+		tier = strings.TrimSpace(tier)
+		for _, node := range nodes {
+			for _, role := range node.Roles {
+				if role == tier {
+					return tier
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// A shard copy tracked by the rebalancing planner.
+type plannedCopy struct {
+	shard Shard
+	id    int
+	bytes int64
+	node  string
+	moved bool
+}
+
+// Plans the moves evening out the load of the data nodes. See `PlanRebalance`.
+func planRebalance(nodes []Node, infos []NodeInfo, shards []Shard, rules allocationRules, watermarks DiskWatermarks, opts RebalancePlanOptions) RebalancePlan {
+	plan := RebalancePlan{Metric: opts.Metric, Moves: []ShardMove{}}
+
+	nodeInfos := map[string]NodeInfo{}
+	for _, info := range infos {
+		nodeInfos[info.Name] = info
+	}
+
+	// Only data nodes are listed by _cat/allocation.
+	loads := map[string]*NodeLoad{}
+	names := []string{}
+	for _, node := range nodes {
+		if node.Shards == "" {
+			continue
+		}
+
+		load := &NodeLoad{Name: node.Name}
+		load.DiskUsedBytes, _ = parseByteSize(node.DiskUsed)
+		load.DiskTotalBytes, _ = parseByteSize(node.DiskTotal)
+		loads[node.Name] = load
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+
+	copies := []*plannedCopy{}
+	for _, shard := range shards {
+		id, err := strconv.Atoi(shard.Shard)
+		if err != nil {
+			continue
+		}
+
+		shardCopy := &plannedCopy{shard: shard, id: id, node: shardNode(shard)}
+		shardCopy.bytes, _ = parseByteSize(shard.Store)
+		copies = append(copies, shardCopy)
+		if load, ok := loads[shardCopy.node]; ok {
+			load.Shards++
+		}
+	}
+
+	snapshot := func() []NodeLoad {
+		result := make([]NodeLoad, 0, len(names))
+		for _, name := range names {
+			result = append(result, *loads[name])
+		}
+		return result
+	}
+	plan.Before = snapshot()
+
+	load := func(name string) float64 {
+		if opts.Metric == BalanceDisk {
+			return loads[name].DiskPercent()
+		}
+		return float64(loads[name].Shards)
+	}
+
+	lowWatermark := func(name string) (float64, bool) {
+		return watermarkUsedPercent(watermarks.Low, loads[name].DiskTotalBytes)
+	}
+
+	// Checks the allocation rules for moving a shard copy to a node.
+	allowed := func(moving *plannedCopy, target string) bool {
+		info, ok := nodeInfos[target]
+		if !ok {
+			return false
+		}
+
+		if !rules.cluster.allows(info) || !rules.indices[moving.shard.Index].allows(info) {
+			return false
+		}
+
+		if tiers := rules.tierPreference[moving.shard.Index]; len(tiers) > 0 {
+			tier := preferredTier(tiers, nodeInfos)
+			hasTier := false
+			for _, role := range info.Roles {
+				if role == tier || role == "data" {
+					hasTier = true
+				}
+			}
+			if tier != "" && !hasTier {
+				return false
+			}
+		}
+
+		sameShard := []*plannedCopy{}
+		indexCopiesOnTarget := 0
+		for _, other := range copies {
+			if other.shard.Index != moving.shard.Index {
+				continue
+			}
+			if other.node == target {
+				indexCopiesOnTarget++
+			}
+			if other.id == moving.id && other != moving {
+				sameShard = append(sameShard, other)
+			}
+		}
+
+		for _, other := range sameShard {
+			if other.node == target {
+				return false
+			}
+			if rules.sameHost && other.node != "" && nodeInfos[other.node].Host == info.Host {
+				return false
+			}
+		}
+
+		if limit := rules.indexTotalShardsPerNode[moving.shard.Index]; limit > 0 && indexCopiesOnTarget+1 > limit {
+			return false
+		}
+		if rules.totalShardsPerNode > 0 && loads[target].Shards+1 > rules.totalShardsPerNode {
+			return false
+		}
+
+		for _, attribute := range rules.awarenessAttributes {
+			targetValue, ok := info.Attributes[attribute]
+			if !ok {
+				return false
+			}
+
+			values := map[string]bool{}
+			for _, name := range names {
+				if value, ok := nodeInfos[name].Attributes[attribute]; ok {
+					values[value] = true
+				}
+			}
+
+			sameValue := 1
+			for _, other := range sameShard {
+				if other.node != "" && nodeInfos[other.node].Attributes[attribute] == targetValue {
+					sameValue++
+				}
+			}
+			if sameValue > (len(sameShard)+1+len(values)-1)/len(values) {
+				return false
+			}
+		}
+
+		if threshold, ok := lowWatermark(target); ok && loads[target].DiskTotalBytes > 0 {
+			after := loads[target].DiskUsedBytes + moving.bytes
+			if float64(after)/float64(loads[target].DiskTotalBytes)*100 >= threshold {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// Checks whether moving a shard copy between two nodes lowers the load of the most loaded one.
+	improves := func(moving *plannedCopy, from, to string) bool {
+		if opts.Metric == BalanceDisk {
+			target := loads[to]
+			if moving.bytes <= 0 || target.DiskTotalBytes <= 0 {
+				return false
+			}
+			return float64(target.DiskUsedBytes+moving.bytes)/float64(target.DiskTotalBytes)*100 < load(from)
+		}
+		return load(from)-load(to) >= 2
+	}
+
+	for opts.MaxMoves <= 0 || len(plan.Moves) < opts.MaxMoves {
+		ordered := append([]string{}, names...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return load(ordered[i]) > load(ordered[j])
+		})
+
+		if len(ordered) < 2 || load(ordered[0])-load(ordered[len(ordered)-1]) <= opts.Tolerance {
+			break
+		}
+
+		var move *ShardMove
+		for _, from := range ordered {
+			candidates := []*plannedCopy{}
+			for _, shardCopy := range copies {
+				if shardCopy.node == from && shardCopy.shard.State == "STARTED" && !shardCopy.moved {
+					candidates = append(candidates, shardCopy)
+				}
+			}
+			sort.SliceStable(candidates, func(i, j int) bool {
+				if candidates[i].bytes != candidates[j].bytes {
+					return candidates[i].bytes > candidates[j].bytes
+				}
+				if candidates[i].shard.Index != candidates[j].shard.Index {
+					return candidates[i].shard.Index < candidates[j].shard.Index
+				}
+				return candidates[i].id < candidates[j].id
+			})
+
+			for i := len(ordered) - 1; i >= 0 && move == nil; i-- {
+				to := ordered[i]
+				if to == from || load(to) >= load(from) {
+					continue
+				}
+
+				for _, candidate := range candidates {
+					if !improves(candidate, from, to) || !allowed(candidate, to) {
+						continue
+					}
+
+					move = &ShardMove{
+						Index:    candidate.shard.Index,
+						Shard:    candidate.id,
+						Primary:  candidate.shard.Type == "p",
+						Bytes:    candidate.bytes,
+						FromNode: from,
+						ToNode:   to,
+					}
+					candidate.node = to
+					candidate.moved = true
+					loads[from].Shards--
+					loads[from].DiskUsedBytes -= candidate.bytes
+					loads[to].Shards++
+					loads[to].DiskUsedBytes += candidate.bytes
+					break
+				}
+			}
+
+			if move != nil {
+				break
+			}
+		}
+
+		if move == nil {
+			break
+		}
+		plan.Moves = append(plan.Moves, *move)
+	}
+
+	plan.After = snapshot()
+	return plan
+}
+
+// Returns the recoveries moving the shards of the given moves to their target node.
+func movesRecoveries(moves []ShardMove, recoveries []ShardRecovery) []ShardRecovery {
+	active := []ShardRecovery{}
+	for _, recovery := range recoveries {
+		for _, move := range moves {
+			if recovery.Index == move.Index && recovery.Shard == strconv.Itoa(move.Shard) && recovery.TargetNode == move.ToNode {
+				active = append(active, recovery)
+				break
+			}
+		}
+	}
+
+	return active
+}
+
+// Returns the moves whose shard is not started on the target node yet, as "index/shard to node".
+func pendingMoves(moves []ShardMove, shards []Shard) []string {
+	pending := []string{}
+	for _, move := range moves {
+		moved := false
+		for _, shard := range shards {
+			if shard.Index == move.Index && shard.Shard == strconv.Itoa(move.Shard) && shard.Node == move.ToNode && shard.State == "STARTED" {
+				moved = true
+				break
+			}
+		}
+
+		if !moved {
+			pending = append(pending, fmt.Sprintf("%s/%d to %s", move.Index, move.Shard, move.ToNode))
+		}
+	}
+
+	return pending
+}
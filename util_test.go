@@ -1,8 +1,13 @@
 package vulcanizer
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/tidwall/gjson"
 )
@@ -74,3 +79,719 @@ func TestEscapeIndexName(t *testing.T) {
 		t.Errorf("Index name changed when it shouldn't have.")
 	}
 }
+
+func TestNodeWithMostShards(t *testing.T) {
+	shards := []Shard{
+		{Index: "octocat", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "octocat", Shard: "1", Type: "p", State: "STARTED", Node: "node-b"},
+		{Index: "octocat", Shard: "2", Type: "r", State: "STARTED", Node: "node-b"},
+		{Index: "other", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "other", Shard: "1", Type: "p", State: "STARTED", Node: "node-a"},
+	}
+
+	if node := nodeWithMostShards(shards, "octocat"); node != "node-b" {
+		t.Errorf("Expected node-b, got %s", node)
+	}
+
+	if node := nodeWithMostShards(shards, "missing"); node != "" {
+		t.Errorf("Expected no node, got %s", node)
+	}
+}
+
+func TestShardsGatheredOnNode(t *testing.T) {
+	gathered := []Shard{
+		{Index: "octocat", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "octocat", Shard: "0", Type: "r", State: "STARTED", Node: "node-b"},
+		{Index: "octocat", Shard: "1", Type: "r", State: "STARTED", Node: "node-a"},
+		{Index: "octocat", Shard: "1", Type: "p", State: "STARTED", Node: "node-c"},
+	}
+
+	if !shardsGatheredOnNode(gathered, "octocat", "node-a") {
+		t.Errorf("Expected all shards to be gathered on node-a")
+	}
+
+	if shardsGatheredOnNode(gathered, "octocat", "node-b") {
+		t.Errorf("Expected shards not to be gathered on node-b")
+	}
+
+	relocating := append(gathered, Shard{Index: "octocat", Shard: "1", Type: "p", State: "RELOCATING", Node: "node-c"})
+	if shardsGatheredOnNode(relocating, "octocat", "node-a") {
+		t.Errorf("Expected relocating shards to block the shrink")
+	}
+}
+
+func TestBuildSegmentReport(t *testing.T) {
+	shardSegments := []ShardSegments{
+		{Index: "busy", Shard: 0, Primary: true, Segments: []Segment{{NumDocs: 10}, {NumDocs: 10}, {NumDocs: 10}}},
+		{Index: "busy", Shard: 0, Primary: false, Segments: []Segment{{NumDocs: 30, DeletedDocs: 30}}},
+		{Index: "deleted", Shard: 0, Primary: true, Segments: []Segment{{NumDocs: 50, DeletedDocs: 50, SizeBytes: 100}}},
+		{Index: "healthy", Shard: 0, Primary: true, Segments: []Segment{{NumDocs: 99, DeletedDocs: 1}}},
+	}
+
+	reports := buildSegmentReport(shardSegments, SegmentReportOptions{MaxSegmentsPerShard: 2})
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 index reports, got %d", len(reports))
+	}
+
+	if !reports[0].ForceMergeCandidate || reports[0].Segments != 3 || reports[0].DeletedDocs != 0 {
+		t.Errorf("Expected busy to be flagged for its segment count only, got %+v", reports[0])
+	}
+
+	if !reports[1].ForceMergeCandidate || reports[1].DeletedDocsRatio != 0.5 || reports[1].SizeBytes != 100 {
+		t.Errorf("Expected deleted to be flagged for its deleted documents, got %+v", reports[1])
+	}
+
+	if reports[2].ForceMergeCandidate {
+		t.Errorf("Expected healthy not to be flagged, got %+v", reports[2])
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		expected     bool
+	}{
+		{"7.10.2", 7, 8, true},
+		{"7.8.0", 7, 8, true},
+		{"7.7.1", 7, 8, false},
+		{"8.0.0", 7, 14, true},
+		{"6.8.23", 7, 0, false},
+		{"bogus", 5, 0, false},
+	}
+
+	for _, tc := range tests {
+		if actual := versionAtLeast(tc.version, tc.major, tc.minor); actual != tc.expected {
+			t.Errorf("versionAtLeast(%s, %d, %d): expected %v, got %v", tc.version, tc.major, tc.minor, tc.expected, actual)
+		}
+	}
+}
+
+func TestMatchLegacyTemplates(t *testing.T) {
+	templates := []LegacyIndexTemplate{
+		{Name: "specific", IndexPatterns: []string{"logs-web-*"}, Order: 10},
+		{Name: "catchall", IndexPatterns: []string{"*"}, Order: 0},
+		{Name: "other", IndexPatterns: []string{"metrics-*", "logs.web"}, Order: 5},
+	}
+
+	matched := matchLegacyTemplates(templates, "logs-web-2021")
+	if len(matched) != 2 || matched[0] != "catchall" || matched[1] != "specific" {
+		t.Errorf("Expected catchall then specific, got %v", matched)
+	}
+
+	if matchesIndexPattern("logs.web", "logsxweb") {
+		t.Errorf("Expected dots in patterns to be matched literally")
+	}
+}
+
+func TestSnapshotRecoveries(t *testing.T) {
+	recoveries := []ShardRecovery{
+		{Index: "restored_logs", Shard: "0", Type: "snapshot", Stage: "done", Repository: "backups", Snapshot: "nightly"},
+		{Index: "restored_logs", Shard: "1", Type: "snapshot", Stage: "index", Repository: "backups", Snapshot: "nightly"},
+		{Index: "restored_logs", Shard: "0", Type: "peer", Stage: "index", Repository: "n/a", Snapshot: "n/a"},
+		{Index: "restored_metrics", Shard: "0", Type: "snapshot", Stage: "done", Repository: "backups", Snapshot: "nightly"},
+		{Index: "restored_logs", Shard: "0", Type: "snapshot", Stage: "index", Repository: "backups", Snapshot: "weekly"},
+	}
+
+	matching, done := snapshotRecoveries(recoveries, "backups", "nightly", nil, time.Time{})
+	if len(matching) != 3 || done {
+		t.Errorf("Expected 3 unfinished recoveries, got %d (done: %v)", len(matching), done)
+	}
+
+	matching, done = snapshotRecoveries(recoveries, "backups", "nightly", []string{"restored_met*"}, time.Time{})
+	if len(matching) != 1 || !done {
+		t.Errorf("Expected 1 finished recovery, got %d (done: %v)", len(matching), done)
+	}
+
+	_, done = snapshotRecoveries(recoveries, "backups", "hourly", nil, time.Time{})
+	if done {
+		t.Errorf("Expected a restore without recoveries not to be done")
+	}
+
+	// Done recoveries left over from an earlier restore of the same snapshot.
+	restoreStart := time.Unix(1600000000, 0)
+	previous := []ShardRecovery{
+		{Index: "restored_logs", Shard: "0", Type: "snapshot", Stage: "done", Repository: "backups", Snapshot: "nightly", StartTimeMillis: 1500000000000},
+		{Index: "restored_logs", Shard: "1", Type: "snapshot", Stage: "done", Repository: "backups", Snapshot: "nightly", StartTimeMillis: 1500000000000},
+	}
+
+	matching, done = snapshotRecoveries(previous, "backups", "nightly", nil, restoreStart)
+	if len(matching) != 0 || done {
+		t.Errorf("Expected recoveries of an earlier restore to be ignored, got %d (done: %v)", len(matching), done)
+	}
+
+	previous[0].StartTimeMillis = 1600000001000
+	previous[0].Stage = "index"
+	matching, done = snapshotRecoveries(previous, "backups", "nightly", nil, restoreStart)
+	if len(matching) != 1 || done {
+		t.Errorf("Expected 1 unfinished recovery of this restore, got %d (done: %v)", len(matching), done)
+	}
+}
+
+func TestPlanSnapshotRetention(t *testing.T) {
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	snapshot := func(name, state string, hoursAgo int) Snapshot {
+		return Snapshot{Name: name, State: state, StartTime: now.Add(-time.Duration(hoursAgo) * time.Hour)}
+	}
+
+	snapshots := []Snapshot{
+		snapshot("nightly-0301", "SUCCESS", 9*24+10),
+		snapshot("nightly-0303", "SUCCESS", 7*24+10),
+		snapshot("nightly-0308", "SUCCESS", 2*24+10),
+		snapshot("nightly-0309", "FAILED", 24+10),
+		snapshot("nightly-0309b", "SUCCESS", 24+9),
+		snapshot("nightly-0309c", "SUCCESS", 24+8),
+		snapshot("nightly-0310", "SUCCESS", 10),
+		snapshot("nightly-0310b", "IN_PROGRESS", 1),
+		snapshot("manual", "SUCCESS", 5),
+	}
+
+	decisions := planSnapshotRetention(snapshots, SnapshotRetentionRules{KeepLast: 1, KeepDailyDays: 3, KeepWeeklyWeeks: 2, DeleteFailed: true}, regexp.MustCompile("^nightly-"), now)
+
+	expected := map[string]bool{
+		"nightly-0310":  false,
+		"nightly-0309c": false,
+		"nightly-0309b": true,
+		"nightly-0309":  true,
+		"nightly-0308":  false,
+		"nightly-0303":  false,
+		"nightly-0301":  true,
+	}
+
+	if len(decisions) != len(expected) {
+		t.Fatalf("Expected %d decisions, got %+v", len(expected), decisions)
+	}
+
+	if decisions[0].Snapshot.Name != "nightly-0310" || decisions[len(decisions)-1].Snapshot.Name != "nightly-0301" {
+		t.Errorf("Expected decisions from most recent to oldest, got %+v", decisions)
+	}
+
+	for _, d := range decisions {
+		if d.Delete != expected[d.Snapshot.Name] {
+			t.Errorf("Expected delete %v for %s, got %v (%s)", expected[d.Snapshot.Name], d.Snapshot.Name, d.Delete, d.Reason)
+		}
+	}
+
+	decisions = planSnapshotRetention(snapshots, SnapshotRetentionRules{KeepLast: 5, MaxCount: 2, MinCount: 1}, nil, now)
+	kept := 0
+	for _, d := range decisions {
+		if !d.Delete && d.Snapshot.State == "SUCCESS" {
+			kept++
+		}
+
+		if d.Snapshot.Name == "nightly-0309" && d.Delete {
+			t.Errorf("Expected the failed snapshot to be kept without DeleteFailed, got %+v", d)
+		}
+	}
+
+	if kept != 2 || decisions[0].Snapshot.Name != "manual" || decisions[0].Delete {
+		t.Errorf("Expected the 2 most recent snapshots to be kept, got %+v", decisions)
+	}
+}
+
+func TestDiagnoseSnapshotFailures(t *testing.T) {
+	snapshot := Snapshot{}
+	err := json.Unmarshal([]byte(`{"failures":[
+		{"index":"logs-1","shard_id":0,"node_id":"aBcD1234","reason":"IOException[failed to write blob]","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"logs-1","shard_id":1,"node_id":"zZzZ9999","reason":"node shutdown","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"logs-2","shard_id":0,"node_id":"aBcD1234","reason":"primary shard is not allocated","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"deleted","shard_id":0,"node_id":"aBcD1234","reason":"index not found","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"logs-1","shard_id":0,"node_id":"aBcD5678","reason":"aborted by the deletion of the snapshot from the repository","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"logs-1","shard_id":1,"node_id":"aBcD1234","reason":"aborted after the master logged an IOException","status":"INTERNAL_SERVER_ERROR"},
+		{"index":"logs-1","shard_id":1,"node_id":"aBcD1234","reason":"java.nio.file.NoSuchFileException: /mnt/backups/index-5","status":"INTERNAL_SERVER_ERROR"}
+	]}`), &snapshot)
+	if err != nil {
+		t.Fatalf("Unexpected error unmarshaling snapshot: %s", err)
+	}
+
+	nodes := []Node{{Name: "node-a", ID: "aBcD1234"}}
+	shards := []Shard{
+		{Index: "logs-1", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "logs-1", Shard: "1", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "logs-2", Shard: "0", Type: "p", State: "UNASSIGNED"},
+	}
+
+	diagnoses := diagnoseSnapshotFailures(snapshot, nodes, shards)
+	if len(diagnoses) != 7 {
+		t.Fatalf("Expected 7 diagnoses, got %+v", diagnoses)
+	}
+
+	if diagnoses[0].Retry || !diagnoses[0].NodePresent || diagnoses[0].NodeName != "node-a" {
+		t.Errorf("Expected a storage error not to be retried, got %+v", diagnoses[0])
+	}
+
+	if !diagnoses[1].Retry || diagnoses[1].NodePresent {
+		t.Errorf("Expected a node that left to be retried, got %+v", diagnoses[1])
+	}
+
+	if !diagnoses[2].Retry || diagnoses[2].PrimaryState != "UNASSIGNED" {
+		t.Errorf("Expected an unassigned primary to be retried, got %+v", diagnoses[2])
+	}
+
+	if !diagnoses[3].Retry || diagnoses[3].IndexExists {
+		t.Errorf("Expected a deleted index to be retried, got %+v", diagnoses[3])
+	}
+
+	// Another node sharing the 4 character prefix of node-a, and a mention of the repository that is no storage error.
+	if !diagnoses[4].Retry || diagnoses[4].NodePresent {
+		t.Errorf("Expected a node that left to be retried, got %+v", diagnoses[4])
+	}
+
+	// Only mentions an exception, the failure itself is no storage error.
+	if !diagnoses[5].Retry {
+		t.Errorf("Expected an aborted snapshot to be retried, got %+v", diagnoses[5])
+	}
+
+	if diagnoses[6].Retry {
+		t.Errorf("Expected a fully qualified storage exception not to be retried, got %+v", diagnoses[6])
+	}
+}
+
+func TestExceptionType(t *testing.T) {
+	tests := map[string]string{
+		"IOException[failed to write blob]":                                   "IOException",
+		"RepositoryException[[backups] could not write blob]":                 "RepositoryException",
+		"java.nio.file.NoSuchFileException: /mnt/backups/index-5":             "NoSuchFileException",
+		"IndexShardSnapshotFailedException[Failed]; nested: IOException[...]": "IndexShardSnapshotFailedException",
+		"aborted after the master logged an IOException":                      "aborted after the master logged an IOException",
+		"": "",
+	}
+
+	for reason, expected := range tests {
+		if actual := exceptionType(reason); actual != expected {
+			t.Errorf("Expected exception type %q for %q, got %q", expected, reason, actual)
+		}
+	}
+}
+
+func TestDiffAliases(t *testing.T) {
+	current := []Alias{
+		{Name: "logs", IndexName: "logs-2021.01"},
+		{Name: "logs", IndexName: "logs-2021.02"},
+		{Name: "products", IndexName: "products_v1"},
+		{Name: "legacy", IndexName: "legacy_v1"},
+		{Name: "unmanaged", IndexName: "unmanaged_v1"},
+	}
+
+	desired := map[string][]string{
+		"logs":     {"logs-2021.02", "logs-2021.03"},
+		"products": {"products_v1"},
+		"legacy":   {},
+		"search":   {"products_v1"},
+	}
+
+	actions := diffAliases(current, desired)
+
+	expected := []AliasAction{
+		{ActionType: RemoveAlias, IndexName: "legacy_v1", AliasName: "legacy"},
+		{ActionType: RemoveAlias, IndexName: "logs-2021.01", AliasName: "logs"},
+		{ActionType: AddAlias, IndexName: "logs-2021.03", AliasName: "logs"},
+		{ActionType: AddAlias, IndexName: "products_v1", AliasName: "search"},
+	}
+
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected %d actions, got %+v", len(expected), actions)
+	}
+
+	for i := range expected {
+		if actions[i].ActionType != expected[i].ActionType || actions[i].IndexName != expected[i].IndexName || actions[i].AliasName != expected[i].AliasName {
+			t.Errorf("Expected action %d to be %+v, got %+v", i, expected[i], actions[i])
+		}
+	}
+}
+
+func TestSuggestRemediation(t *testing.T) {
+	tests := []struct {
+		name                string
+		explanation         AllocationExplanation
+		expectedRemediation ShardRemediation
+		expectedNode        string
+	}{
+		{
+			name:                "throttled",
+			explanation:         AllocationExplanation{CanAllocate: "throttled"},
+			expectedRemediation: RemediationWait,
+		},
+		{
+			name: "max retries exceeded",
+			explanation: AllocationExplanation{
+				CanAllocate: "no",
+				NodeAllocationDecisions: []NodeAllocationDecision{
+					{NodeName: "node-1", Deciders: []AllocationDecider{{Decider: "max_retry", Decision: "NO"}}},
+				},
+			},
+			expectedRemediation: RemediationRetryFailed,
+		},
+		{
+			name: "stale primary copy",
+			explanation: AllocationExplanation{
+				CanAllocate: "no_valid_shard_copy",
+				Primary:     true,
+				NodeAllocationDecisions: []NodeAllocationDecision{
+					{NodeName: "node-1", Store: &ShardStoreInfo{Found: false}},
+					{NodeName: "node-2", Store: &ShardStoreInfo{Found: true}},
+				},
+			},
+			expectedRemediation: RemediationAllocateStalePrimary,
+			expectedNode:        "node-2",
+		},
+		{
+			name: "no copy left",
+			explanation: AllocationExplanation{
+				CanAllocate: "no_valid_shard_copy",
+				Primary:     true,
+				NodeAllocationDecisions: []NodeAllocationDecision{
+					{NodeName: "node-1", Store: &ShardStoreInfo{Found: false}},
+				},
+			},
+			expectedRemediation: RemediationNone,
+		},
+		{
+			name: "disk full",
+			explanation: AllocationExplanation{
+				CanAllocate: "no",
+				NodeAllocationDecisions: []NodeAllocationDecision{
+					{NodeName: "node-1", Deciders: []AllocationDecider{{Decider: "disk_threshold", Decision: "NO"}}},
+				},
+			},
+			expectedRemediation: RemediationNone,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			remediation, node := suggestRemediation(tc.explanation)
+			if remediation != tc.expectedRemediation || node != tc.expectedNode {
+				t.Errorf("Expected %q on %q, got %q on %q", tc.expectedRemediation, tc.expectedNode, remediation, node)
+			}
+		})
+	}
+}
+
+func TestGroupUnassignedShards(t *testing.T) {
+	diskFull := AllocationExplanation{
+		CanAllocate: "no",
+		NodeAllocationDecisions: []NodeAllocationDecision{
+			{NodeName: "node-1", Deciders: []AllocationDecider{{Decider: "disk_threshold", Decision: "NO"}}},
+			{NodeName: "node-2", Deciders: []AllocationDecider{{Decider: "disk_threshold", Decision: "NO"}, {Decider: "same_shard", Decision: "NO"}}},
+		},
+	}
+
+	shards := []UnassignedShard{
+		{Shard: Shard{Index: "a", Shard: "0"}, Explanation: AllocationExplanation{CanAllocate: "no_valid_shard_copy"}},
+		{Shard: Shard{Index: "b", Shard: "0"}, Explanation: diskFull},
+		{Shard: Shard{Index: "b", Shard: "1"}, Explanation: diskFull},
+	}
+
+	groups := groupUnassignedShards(shards)
+
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %+v", groups)
+	}
+
+	if groups[0].CanAllocate != "no" || strings.Join(groups[0].Deciders, ",") != "disk_threshold,same_shard" || len(groups[0].Shards) != 2 {
+		t.Errorf("Unexpected first group, got %+v", groups[0])
+	}
+
+	if groups[1].CanAllocate != "no_valid_shard_copy" || len(groups[1].Deciders) != 0 || len(groups[1].Shards) != 1 {
+		t.Errorf("Unexpected second group, got %+v", groups[1])
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"162b":  162,
+		"1kb":   1024,
+		"1.5mb": 1572864,
+		"2GB":   2147483648,
+		"1.5tb": 1649267441664,
+	}
+
+	for size, expected := range tests {
+		bytes, err := parseByteSize(size)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %s", size, err)
+		}
+		if bytes != expected {
+			t.Errorf("Expected %s to be %d bytes, got %d", size, expected, bytes)
+		}
+	}
+
+	_, err := parseByteSize("lots")
+	if err == nil {
+		t.Errorf("Expected an error parsing an invalid size")
+	}
+}
+
+func TestWatermarkUsedPercent(t *testing.T) {
+	tests := []struct {
+		watermark  string
+		totalBytes int64
+		expected   float64
+		ok         bool
+	}{
+		{"85%", 0, 85, true},
+		{"0.9", 0, 90, true},
+		{"25gb", 100 << 30, 75, true},
+		{"25gb", 0, 0, false},
+		{"", 100, 0, false},
+	}
+
+	for _, tc := range tests {
+		percent, ok := watermarkUsedPercent(tc.watermark, tc.totalBytes)
+		if ok != tc.ok || math.Abs(percent-tc.expected) > 0.001 {
+			t.Errorf("Expected %q on %d bytes to be %f (%t), got %f (%t)", tc.watermark, tc.totalBytes, tc.expected, tc.ok, percent, ok)
+		}
+	}
+}
+
+func TestEffectiveSetting(t *testing.T) {
+	body := []byte(`{"persistent":{"indices.recovery.max_bytes_per_sec":"100mb"},"transient":{},"defaults":{"indices.recovery.max_bytes_per_sec":"40mb","cluster.routing.allocation.node_concurrent_recoveries":"2"}}`)
+
+	value, source := effectiveSetting(body, "indices.recovery.max_bytes_per_sec")
+	if value != "100mb" || source != "persistent" {
+		t.Errorf("Expected 100mb from persistent, got %s from %s", value, source)
+	}
+
+	value, source = effectiveSetting(body, "cluster.routing.allocation.node_concurrent_recoveries")
+	if value != "2" || source != "defaults" {
+		t.Errorf("Expected 2 from defaults, got %s from %s", value, source)
+	}
+
+	value, source = effectiveSetting(body, "cluster.routing.allocation.cluster_concurrent_rebalance")
+	if value != "" || source != "" {
+		t.Errorf("Expected no value, got %s from %s", value, source)
+	}
+}
+
+func TestBuildBalanceReport(t *testing.T) {
+	nodes := []Node{
+		{Name: "node-a", Shards: "3", DiskPercent: "60", DiskTotal: "100gb"},
+		{Name: "node-b", Shards: "2", DiskPercent: "50", DiskTotal: "100gb"},
+		{Name: "node-c", Shards: "1", DiskPercent: "40", DiskTotal: "100gb"},
+		{Name: "master-1"},
+	}
+
+	shards := []Shard{
+		{Index: "logs", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "logs", Shard: "0", Type: "r", State: "STARTED", Node: "node-b"},
+		{Index: "logs", Shard: "1", Type: "p", State: "RELOCATING", Node: "node-a -> 10.0.0.3 cccc node-c"},
+		{Index: "logs", Shard: "1", Type: "r", State: "STARTED", Node: "node-b"},
+		{Index: "metrics", Shard: "0", Type: "p", State: "STARTED", Node: "node-a"},
+		{Index: "metrics", Shard: "0", Type: "r", State: "INITIALIZING", Node: "node-c"},
+		{Index: "metrics", Shard: "0", Type: "r", State: "UNASSIGNED"},
+	}
+
+	report := buildBalanceReport(nodes, shards, nil, DiskWatermarks{Low: "55%", High: "90%"}, BalanceReportOptions{WatermarkMargin: 10})
+
+	if len(report.Nodes) != 3 {
+		t.Fatalf("Expected 3 data nodes, got %+v", report.Nodes)
+	}
+
+	expectedShards := []int{3, 2, 0}
+	for i, node := range report.Nodes {
+		if node.Shards != expectedShards[i] {
+			t.Errorf("Expected %s to have %d shards, got %d", node.Name, expectedShards[i], node.Shards)
+		}
+	}
+
+	if report.MeanShards != 5.0/3 || math.Abs(report.ShardSkew-1.8) > 0.001 || report.DiskSkew != 20 {
+		t.Errorf("Unexpected skew, got %+v", report)
+	}
+
+	if report.Nodes[0].Watermark != "low" || !report.Nodes[0].WatermarkExceeded {
+		t.Errorf("Expected node-a over the low watermark, got %+v", report.Nodes[0])
+	}
+
+	if report.Nodes[1].Watermark != "low" || report.Nodes[1].WatermarkExceeded {
+		t.Errorf("Expected node-b close to the low watermark, got %+v", report.Nodes[1])
+	}
+
+	if report.Nodes[2].Watermark != "" {
+		t.Errorf("Expected node-c far from the watermarks, got %+v", report.Nodes[2])
+	}
+
+	if len(report.Concentrations) != 1 || report.Concentrations[0].Index != "logs" || report.Concentrations[0].Node != "node-a" || report.Concentrations[0].Primaries != 2 || report.Concentrations[0].FairShare != 2 {
+		t.Errorf("Unexpected concentrations, got %+v", report.Concentrations)
+	}
+}
+
+func TestAllocationRulesFromSettings(t *testing.T) {
+	clusterBody := []byte(`{"persistent":{"cluster.routing.allocation.exclude._name":"node-x","cluster.routing.allocation.awareness.attributes":"zone"},"transient":{"cluster.routing.allocation.exclude._name":"node-a, node-b"},"defaults":{"cluster.routing.allocation.awareness.attributes":[],"cluster.routing.allocation.same_shard.host":"false","cluster.routing.allocation.total_shards_per_node":"-1"}}`)
+	indexBody := []byte(`{"logs":{"settings":{"index.routing.allocation.require.box":"hot","index.routing.allocation.total_shards_per_node":"2","index.routing.allocation.include._tier_preference":"data_hot,data_warm"}},"metrics":{"settings":{}}}`)
+
+	rules := allocationRulesFromSettings(clusterBody, indexBody)
+
+	if strings.Join(rules.cluster.exclude["_name"], ",") != "node-a,node-b" {
+		t.Errorf("Expected the transient exclude to win, got %+v", rules.cluster.exclude)
+	}
+
+	if strings.Join(rules.awarenessAttributes, ",") != "zone" || rules.sameHost || rules.totalShardsPerNode != -1 {
+		t.Errorf("Unexpected cluster rules, got %+v", rules)
+	}
+
+	if strings.Join(rules.indices["logs"].require["box"], ",") != "hot" || rules.indexTotalShardsPerNode["logs"] != 2 {
+		t.Errorf("Unexpected index rules, got %+v", rules.indices["logs"])
+	}
+
+	if strings.Join(rules.tierPreference["logs"], ",") != "data_hot,data_warm" || len(rules.indices["logs"].include) != 0 {
+		t.Errorf("Unexpected tier preference, got %+v", rules.tierPreference)
+	}
+}
+
+func TestAllocationFilterAllows(t *testing.T) {
+	node := NodeInfo{Name: "node-a", IP: "10.0.0.1", Host: "host-a", Attributes: map[string]string{"zone": "us-east-1a", "box": "hot"}}
+
+	tests := []struct {
+		name     string
+		filter   allocationFilter
+		expected bool
+	}{
+		{"no filters", allocationFilter{}, true},
+		{"required attribute", allocationFilter{require: map[string][]string{"box": {"hot"}}}, true},
+		{"missing required attribute", allocationFilter{require: map[string][]string{"box": {"warm"}}}, false},
+		{"included by wildcard", allocationFilter{include: map[string][]string{"zone": {"us-west-*", "us-east-*"}}}, true},
+		{"not included", allocationFilter{include: map[string][]string{"_name": {"node-b"}}}, false},
+		{"excluded by ip", allocationFilter{exclude: map[string][]string{"_ip": {"10.0.0.1"}}}, false},
+		{"excluded by host", allocationFilter{exclude: map[string][]string{"_host": {"host-a"}}}, false},
+		{"not excluded", allocationFilter{exclude: map[string][]string{"_name": {"node-b"}}}, true},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.filter.allows(node) != tc.expected {
+				t.Errorf("Expected %t for %+v", tc.expected, tc.filter)
+			}
+		})
+	}
+}
+
+func TestPlanRebalanceConstraints(t *testing.T) {
+	nodes := []Node{
+		{Name: "node-a", Shards: "4", DiskUsed: "40gb", DiskTotal: "100gb"},
+		{Name: "node-b", Shards: "0", DiskUsed: "10gb", DiskTotal: "100gb"},
+		{Name: "node-c", Shards: "0", DiskUsed: "10gb", DiskTotal: "100gb"},
+	}
+
+	infos := []NodeInfo{
+		{Name: "node-a", Attributes: map[string]string{"zone": "a"}},
+		{Name: "node-b", Attributes: map[string]string{"zone": "b"}},
+		{Name: "node-c", Attributes: map[string]string{"zone": "a"}},
+	}
+
+	shards := []Shard{
+		{Index: "logs", Shard: "0", Type: "p", State: "STARTED", Store: "4gb", Node: "node-a"},
+		{Index: "logs", Shard: "1", Type: "p", State: "STARTED", Store: "3gb", Node: "node-a"},
+		{Index: "logs", Shard: "2", Type: "p", State: "STARTED", Store: "2gb", Node: "node-a"},
+		{Index: "logs", Shard: "2", Type: "r", State: "UNASSIGNED"},
+		{Index: "metrics", Shard: "0", Type: "p", State: "STARTED", Store: "1gb", Node: "node-a"},
+	}
+
+	watermarks := DiskWatermarks{Low: "85%"}
+
+	t.Run("shard count", func(t *testing.T) {
+		plan := planRebalance(nodes, infos, shards, allocationRules{}, watermarks, RebalancePlanOptions{Metric: BalanceShards})
+
+		if len(plan.Moves) != 2 {
+			t.Fatalf("Expected 2 moves, got %+v", plan.Moves)
+		}
+
+		if plan.Moves[0].Index != "logs" || plan.Moves[0].Shard != 0 || plan.Moves[0].ToNode != "node-c" || plan.Moves[1].Shard != 1 || plan.Moves[1].ToNode != "node-b" {
+			t.Errorf("Unexpected moves, got %+v", plan.Moves)
+		}
+
+		if plan.Before[0].Shards != 4 || plan.After[0].Shards != 2 || plan.After[1].Shards != 1 || plan.After[2].Shards != 1 {
+			t.Errorf("Unexpected loads, before %+v after %+v", plan.Before, plan.After)
+		}
+	})
+
+	t.Run("max moves", func(t *testing.T) {
+		plan := planRebalance(nodes, infos, shards, allocationRules{}, watermarks, RebalancePlanOptions{Metric: BalanceShards, MaxMoves: 1})
+
+		if len(plan.Moves) != 1 {
+			t.Errorf("Expected 1 move, got %+v", plan.Moves)
+		}
+	})
+
+	t.Run("excluded node", func(t *testing.T) {
+		rules := allocationRules{cluster: allocationFilter{exclude: map[string][]string{"_name": {"node-c"}}}}
+		plan := planRebalance(nodes, infos, shards, rules, watermarks, RebalancePlanOptions{Metric: BalanceShards})
+
+		for _, move := range plan.Moves {
+			if move.ToNode == "node-c" {
+				t.Errorf("Expected no move to the excluded node, got %+v", plan.Moves)
+			}
+		}
+	})
+
+	t.Run("awareness", func(t *testing.T) {
+		awareShards := []Shard{
+			{Index: "logs", Shard: "0", Type: "p", State: "STARTED", Store: "4gb", Node: "node-a"},
+			{Index: "logs", Shard: "0", Type: "r", State: "STARTED", Store: "4gb", Node: "node-b"},
+			{Index: "logs", Shard: "1", Type: "p", State: "STARTED", Store: "3gb", Node: "node-a"},
+			{Index: "logs", Shard: "1", Type: "r", State: "STARTED", Store: "3gb", Node: "node-b"},
+			{Index: "metrics", Shard: "0", Type: "p", State: "STARTED", Store: "1gb", Node: "node-a"},
+		}
+		awareInfos := []NodeInfo{
+			{Name: "node-a", Attributes: map[string]string{"zone": "a"}},
+			{Name: "node-b", Attributes: map[string]string{"zone": "b"}},
+			{Name: "node-c", Attributes: map[string]string{"zone": "b"}},
+		}
+		rules := allocationRules{awarenessAttributes: []string{"zone"}}
+		plan := planRebalance(nodes, awareInfos, awareShards, rules, watermarks, RebalancePlanOptions{Metric: BalanceShards})
+
+		// The logs shards already have a copy in zone b, so only metrics can move to node-c.
+		if len(plan.Moves) != 1 || plan.Moves[0].Index != "metrics" || plan.Moves[0].ToNode != "node-c" {
+			t.Errorf("Expected only metrics to move to node-c, got %+v", plan.Moves)
+		}
+	})
+
+	t.Run("disk", func(t *testing.T) {
+		plan := planRebalance(nodes, infos, shards, allocationRules{}, watermarks, RebalancePlanOptions{Metric: BalanceDisk, Tolerance: 5})
+
+		if len(plan.Moves) == 0 || plan.Moves[0].Bytes != 4<<30 {
+			t.Fatalf("Expected the biggest shard to move first, got %+v", plan.Moves)
+		}
+
+		for i, load := range plan.After {
+			if load.DiskPercent() > plan.Before[0].DiskPercent() {
+				t.Errorf("Expected node %d to stay below the most loaded node, got %+v", i, load)
+			}
+		}
+	})
+
+	t.Run("low watermark", func(t *testing.T) {
+		plan := planRebalance(nodes, infos, shards, allocationRules{}, DiskWatermarks{Low: "12%"}, RebalancePlanOptions{Metric: BalanceShards})
+
+		for _, move := range plan.Moves {
+			if move.Bytes > 1<<30 {
+				t.Errorf("Expected only shards keeping the target below the low watermark to move, got %+v", plan.Moves)
+			}
+		}
+	})
+}
+
+func TestMovesRecoveries(t *testing.T) {
+	moves := []ShardMove{{Index: "logs", Shard: 0, FromNode: "node-a", ToNode: "node-b"}}
+	recoveries := []ShardRecovery{
+		{Index: "logs", Shard: "0", TargetNode: "node-b"},
+		{Index: "logs", Shard: "0", TargetNode: "node-c"},
+		{Index: "logs", Shard: "1", TargetNode: "node-b"},
+	}
+
+	active := movesRecoveries(moves, recoveries)
+	if len(active) != 1 || active[0].TargetNode != "node-b" || active[0].Shard != "0" {
+		t.Errorf("Unexpected recoveries, got %+v", active)
+	}
+}
+
+func TestAllocationSettingsFromJSON_InvalidValue(t *testing.T) {
+	body := []byte(`{"persistent":{},"transient":{"cluster.routing.allocation.cluster_concurrent_rebalance":"lots"},"defaults":{}}`)
+
+	_, err := allocationSettingsFromJSON(body)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid concurrent rebalance value")
+	}
+}